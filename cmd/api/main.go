@@ -1,65 +1,181 @@
 package main
 
 import (
+	"context"
 	"database/sql" //package provides a generic api that allows for interacting with the databases in a vendor-neutral way
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq" //This is a driver; this is the go package for the sql database driver; third-party package
+	_ "github.com/lib/pq"  //This is a driver; this is the go package for the sql database driver; third-party package
+	_ "modernc.org/sqlite" //This is the SQLite driver; it is written in pure go so no C compiler is needed
 
 	"readinglist/internal/api"
 	"readinglist/internal/data"
+	"readinglist/internal/mailer"
+	"readinglist/internal/migrate"
 )
 
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("Error loading .env file")
-	}
-
 	var cfg api.Config
 
-	dbHost := os.Getenv("DB_HOST")
-	dbPort := os.Getenv("DB_PORT")
-	dbUser := os.Getenv("DB_USER")
-	dbPassword := os.Getenv("DB_PASSWORD")
-	dbName := os.Getenv("DB_NAME")
-
-	cfg.Dsn = fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", dbUser, dbPassword, dbHost, dbPort, dbName)
-
 	flag.IntVar(&cfg.Port, "port", 3000, "API server port")
 	flag.StringVar(&cfg.Env, "env", "dev", "Environment (dev|stage|prod)")
+	flag.StringVar(&cfg.Store, "store", "db", "Where the books are kept (db|memory), postgres is the same as db")
+	flag.StringVar(&cfg.Dsn, "dsn", "", "Database connection string, postgres://... or sqlite://path/to.db (defaults to the DB_* settings in .env)")
+	flag.DurationVar(&cfg.QueryTimeout, "db-query-timeout", 3*time.Second, "Maximum time a single database query can run")
+
+	flag.DurationVar(&cfg.TrashRetention, "trash-retention", 30*24*time.Hour, "How long deleted books are kept in the trash before they are purged (0 keeps them forever)")
+	flag.DurationVar(&cfg.TrashPurgeInterval, "trash-purge-interval", time.Hour, "How often the trash is checked for books to purge")
+
+	flag.StringVar(&cfg.WebURL, "web-url", "http://localhost", "Base URL of the cmd/web frontend, used for the book links in the feeds")
+	flag.StringVar(&cfg.APIURL, "api-url", "", "Base URL clients reach this API on, used for the links in emails to users (defaults to http://localhost:<port>)")
+
+	flag.StringVar(&cfg.SMTP.Host, "smtp-host", "", "SMTP server for the emails to users (without one they are written to -mail-dir or the log)")
+	flag.IntVar(&cfg.SMTP.Port, "smtp-port", 587, "SMTP server port")
+	flag.StringVar(&cfg.SMTP.Username, "smtp-username", "", "SMTP username")
+	flag.StringVar(&cfg.SMTP.Password, "smtp-password", "", "SMTP password")
+	flag.StringVar(&cfg.SMTP.Sender, "smtp-sender", "Reading List <no-reply@readinglist.local>", "The From address of the emails to users")
+	flag.StringVar(&cfg.MailDir, "mail-dir", "", "Without -smtp-host, write the emails to users to this directory as .eml files instead of the log")
+
+	defaultPermissions := flag.String("default-permissions", "books:read,books:write", "Comma separated permissions new users get when they sign up (books:read, books:write, admin)")
+	anonymousPermissions := flag.String("anonymous-permissions", "books:read", "Comma separated permissions for requests without a token, empty for none")
+
+	migrateOnStart := flag.Bool("migrate-on-start", false, "Apply any pending database migrations before the server starts (always done for SQLite)")
+
 	flag.Parse()
 
 	fmt.Println("hello")
 
 	logger := log.New(os.Stdout, "", log.Ldate|log.Ltime)
 
-	//below opens the database connection
-	db, err := sql.Open("postgres", cfg.Dsn)
-	if err != nil {
-		logger.Fatal(err)
+	//the links in emails can't come from the request's Host header, anyone signing up can set that to a server of their own
+	if cfg.APIURL == "" {
+		cfg.APIURL = fmt.Sprintf("http://localhost:%d", cfg.Port)
 	}
+	cfg.APIURL = strings.TrimRight(cfg.APIURL, "/")
 
-	err = db.Ping() //this tests the connection
-	if err != nil {
-		logger.Fatal(err)
+	var err error
+	if cfg.DefaultPermissions, err = parsePermissions(*defaultPermissions); err != nil {
+		logger.Fatalf("-default-permissions: %v", err)
+	}
+	if cfg.AnonymousPermissions, err = parsePermissions(*anonymousPermissions); err != nil {
+		logger.Fatalf("-anonymous-permissions: %v", err)
 	}
 
-	defer db.Close() //this closes the connection
+	//the store flag picks where the books are kept
+	//memory needs no database (or .env file) at all, which is handy for frontend work and testing, but nothing is saved
+	//db uses the database in the dsn; the scheme at the start of it picks postgres or sqlite
+	var models data.Models
 
-	logger.Printf("database connection pool established")
+	var migrator *migrate.Migrator
+
+	//anything left over after the flags is a subcommand: migrate or permissions
+	if flag.NArg() > 0 && flag.Arg(0) != "migrate" && flag.Arg(0) != "permissions" {
+		logger.Fatalf("unknown command %q", flag.Arg(0))
+	}
+
+	switch cfg.Store {
+	//postgres was the name before SQLite came along; it still works, and the dsn picks the database either way
+	case "db", "postgres":
+		db, driver, err := openDB(&cfg)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		defer db.Close() //this closes the connection
+
+		logger.Printf("%s database connection pool established", driver)
+
+		migrator, err = migrate.New(db, driver, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		if flag.Arg(0) == "migrate" {
+			if err := runMigrate(migrator, flag.Args()[1:]); err != nil {
+				logger.Fatal(err)
+			}
+			return
+		}
+
+		//a brand new SQLite file has no tables yet, so its schema is always brought up to date on the way up
+		//for postgres it is opt-in, because usually the migrations are run on purpose before a new version is deployed
+		if *migrateOnStart || driver == "sqlite" {
+			if err := migrator.Up(context.Background()); err != nil {
+				logger.Fatal(err)
+			}
+		}
+
+		if version, err := migrator.Version(context.Background()); err != nil {
+			logger.Fatal(err)
+		} else if version < migrator.Latest() {
+			logger.Printf("warning: the database schema is at version %d but the latest is %d, run: api migrate up", version, migrator.Latest())
+		}
+
+		switch driver {
+		case "sqlite":
+			models = data.NewSQLiteModels(db, cfg.QueryTimeout)
+		default:
+			models = data.NewModels(db, cfg.QueryTimeout)
+		}
+
+		if flag.Arg(0) == "permissions" {
+			if err := runPermissions(models, flag.Args()[1:]); err != nil {
+				logger.Fatal(err)
+			}
+			return
+		}
+
+	case "memory":
+		if flag.Arg(0) == "migrate" {
+			logger.Fatal("there is nothing to migrate in the in-memory store")
+		}
+		if flag.Arg(0) == "permissions" {
+			logger.Fatal("the in-memory store only lasts as long as the server, so its permissions can't be changed from outside it")
+		}
+
+		logger.Printf("using the in-memory store, books will be lost when the server stops")
+
+		models = data.NewMemoryModels()
+
+	default:
+		logger.Fatalf("unknown store %q, it must be db (or postgres) or memory", cfg.Store)
+	}
+
+	//emails go to a real mail server when there is one, while developing they are only written out so they can be read
+	var mail mailer.Mailer = mailer.Log{Logger: logger, Dir: cfg.MailDir, Sender: cfg.SMTP.Sender}
+	if cfg.SMTP.Host != "" {
+		mail = mailer.SMTP{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			Sender:   cfg.SMTP.Sender,
+		}
+	}
 
 	app := &api.Application{
-		Config: cfg,
-		Logger: logger,
-		Models: data.NewModels(db),
+		Config:   cfg,
+		Logger:   logger,
+		Models:   models,
+		Migrator: migrator,
+		Mailer:   mail,
 	}
 
+	//a ticker panics on an interval that isn't positive, so this is checked before the purger starts
+	if cfg.TrashPurgeInterval <= 0 {
+		logger.Fatal("-trash-purge-interval must be greater than zero")
+	}
+
+	go app.RunTrashPurger(context.Background())
+
 	addr := fmt.Sprintf(":%d", cfg.Port)
 
 	srv := &http.Server{
@@ -74,3 +190,78 @@ func main() {
 	err = srv.ListenAndServe()
 	logger.Fatal(err)
 }
+
+// parsePermissions turns the comma separated list from a flag into permission codes, checking each one exists
+func parsePermissions(list string) (data.Permissions, error) {
+	permissions := data.Permissions{}
+
+	for _, code := range strings.Split(list, ",") {
+		code = strings.TrimSpace(code)
+		if code == "" {
+			continue
+		}
+		if !data.ValidPermission(code) {
+			return nil, fmt.Errorf("unknown permission %q, it must be one of %s", code, strings.Join(data.PermissionCodes, ", "))
+		}
+		permissions = append(permissions, code)
+	}
+
+	return permissions, nil
+}
+
+// openDB opens the connection pool for the dsn and returns the name of the driver it used
+// sqlite://path/to.db opens (or creates) a SQLite file, anything else is handed to the postgres driver
+// when no dsn was given on the command line it is built from the DB_* settings in the .env file
+func openDB(cfg *api.Config) (*sql.DB, string, error) {
+	if cfg.Dsn == "" {
+		if err := godotenv.Load(); err != nil {
+			return nil, "", errors.New("error loading .env file")
+		}
+
+		dbHost := os.Getenv("DB_HOST")
+		dbPort := os.Getenv("DB_PORT")
+		dbUser := os.Getenv("DB_USER")
+		dbPassword := os.Getenv("DB_PASSWORD")
+		dbName := os.Getenv("DB_NAME")
+
+		cfg.Dsn = fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", dbUser, dbPassword, dbHost, dbPort, dbName)
+	}
+
+	driver, dsn := "postgres", cfg.Dsn
+
+	if path, ok := strings.CutPrefix(cfg.Dsn, "sqlite://"); ok {
+		driver, dsn = "sqlite", sqliteDSN(path)
+	}
+
+	//below opens the database connection
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if driver == "sqlite" {
+		//SQLite only lets one connection write at a time, so a single connection avoids "database is locked" errors
+		db.SetMaxOpenConns(1)
+	}
+
+	err = db.Ping() //this tests the connection
+	if err != nil {
+		db.Close()
+		return nil, "", err
+	}
+
+	return db, driver, nil
+}
+
+// sqliteDSN turns the path from sqlite://path/to.db into the connection string the driver expects
+// foreign keys are off by default in SQLite so they are switched on, and times are stored in a format SQLite can compare
+func sqliteDSN(path string) string {
+	path, query, _ := strings.Cut(path, "?")
+
+	params := "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_time_format=sqlite"
+	if query != "" {
+		params += "&" + query
+	}
+
+	return "file:" + path + "?" + params
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"readinglist/internal/migrate"
+)
+
+// runMigrate handles the migrate subcommand, e.g. api -dsn=... migrate up
+//
+//	up       applies every migration that hasn't been applied yet
+//	down     undoes the most recent migration
+//	status   lists every migration and when it was applied
+//	to N     moves up or down to version N (0 undoes everything)
+func runMigrate(migrator *migrate.Migrator, args []string) error {
+	ctx := context.Background()
+
+	if len(args) == 0 {
+		return errors.New("usage: api migrate up|down|status|to N")
+	}
+
+	switch args[0] {
+	case "up":
+		if err := migrator.Up(ctx); err != nil {
+			return err
+		}
+
+	case "down":
+		if err := migrator.Down(ctx); err != nil {
+			return err
+		}
+
+	case "to":
+		if len(args) != 2 {
+			return errors.New("usage: api migrate to N")
+		}
+
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < 0 {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+
+		if err := migrator.To(ctx, version); err != nil {
+			return err
+		}
+
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		tw.Flush()
+
+		return nil
+
+	default:
+		return fmt.Errorf("unknown migrate command %q, it must be up, down, status or to N", args[0])
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("schema is at version %d (latest is %d)\n", version, migrator.Latest())
+
+	return nil
+}
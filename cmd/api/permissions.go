@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"readinglist/internal/data"
+)
+
+// runPermissions handles the permissions subcommand, e.g. api -dsn=... permissions grant alice@example.com admin
+// it is how the first admin is made; after that admins can use /v1/users/{id}/permissions instead
+//
+//	list EMAIL               prints the user's permissions
+//	grant EMAIL CODE...      gives the user the permissions
+//	revoke EMAIL CODE...     takes them away
+func runPermissions(models data.Models, args []string) error {
+	ctx := context.Background()
+
+	if len(args) < 2 {
+		return errors.New("usage: api permissions list|grant|revoke EMAIL [PERMISSION...]")
+	}
+
+	command, email, codes := args[0], args[1], args[2:]
+
+	user, err := models.Users.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, data.ErrRecordNotFound) {
+			return fmt.Errorf("there is no user with the email address %q", email)
+		}
+		return err
+	}
+
+	for _, code := range codes {
+		if !data.ValidPermission(code) {
+			return fmt.Errorf("unknown permission %q, it must be one of %s", code, strings.Join(data.PermissionCodes, ", "))
+		}
+	}
+
+	switch command {
+	case "list":
+		//nothing to change, the permissions are printed below
+
+	case "grant", "revoke":
+		if len(codes) == 0 {
+			return fmt.Errorf("usage: api permissions %s EMAIL PERMISSION...", command)
+		}
+
+		if command == "grant" {
+			err = models.Permissions.AddForUser(ctx, user.ID, codes...)
+		} else {
+			err = models.Permissions.RemoveForUser(ctx, user.ID, codes...)
+		}
+		if err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf("unknown permissions command %q, it must be list, grant or revoke", command)
+	}
+
+	permissions, err := models.Permissions.GetAllForUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s has: %s\n", user.Email, strings.Join(permissions, ", "))
+	if !user.Activated {
+		fmt.Println("the account hasn't been activated yet, the permissions only count once it is")
+	}
+
+	return nil
+}
@@ -8,6 +8,9 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+
+	"readinglist/internal/data"
+	"readinglist/internal/validator"
 )
 
 // these functions are all methods on the application type
@@ -101,7 +104,25 @@ func (app *application) bookCreate(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// bookForm holds what was typed into the create form along with any problems with it
+// the values are kept as strings so the form can be shown again exactly as it was typed when something is wrong
+type bookForm struct {
+	Title       string
+	Author      string
+	Pages       string
+	Published   string
+	Genres      string
+	Rating      string
+	ISBN        string
+	FieldErrors map[string]string
+}
+
 func (app *application) bookCreateForm(w http.ResponseWriter, r *http.Request) {
+	app.renderCreateForm(w, http.StatusOK, bookForm{})
+}
+
+// renderCreateForm shows the create page with the form values and errors filled in
+func (app *application) renderCreateForm(w http.ResponseWriter, status int, form bookForm) {
 	files := []string{
 		"./ui/html/base.html",
 		"./ui/html/partials/nav.html",
@@ -115,13 +136,18 @@ func (app *application) bookCreateForm(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// nil is used here because we don't have any data we want to pass in
-	err = ts.ExecuteTemplate(w, "base", nil)
+	//the template is executed into a buffer first so a template error doesn't leave half a page and the wrong status code behind
+	buf := new(bytes.Buffer)
+
+	err = ts.ExecuteTemplate(buf, "base", form)
 	if err != nil {
 		log.Println(err)
 		http.Error(w, "Internal Sever Error", 500)
 		return
 	}
+
+	w.WriteHeader(status)
+	buf.WriteTo(w)
 }
 
 func (app *application) bookCreateProcess(w http.ResponseWriter, r *http.Request) {
@@ -134,36 +160,68 @@ func (app *application) bookCreateProcess(w http.ResponseWriter, r *http.Request
 	}
 
 	//the value in the Get method needs to match the name attribute in the html form
-	title := r.PostForm.Get("title")
+	form := bookForm{
+		Title:     r.PostForm.Get("title"),
+		Author:    r.PostForm.Get("author"),
+		Pages:     r.PostForm.Get("pages"),
+		Published: r.PostForm.Get("published"),
+		Genres:    r.PostForm.Get("genres"),
+		Rating:    r.PostForm.Get("rating"),
+		ISBN:      r.PostForm.Get("isbn"),
+	}
 
-	author := r.PostForm.Get("author")
+	//the same rules the api uses are checked here so the user gets told about every problem on the form at once
+	v := validator.New()
 
-	//published and pages needs to include error handling because they are being converted from one data type to another
-	published, err := strconv.Atoi(r.PostForm.Get("published"))
+	//published, pages and rating need error handling because they are being converted from one data type to another
+	//if they aren't numbers that is added to the validator instead of stopping with a 400
+	published, err := strconv.Atoi(form.Published)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
+		v.AddError("published", "must be a whole number")
 	}
 
-	pages, err := strconv.Atoi(r.PostForm.Get("pages"))
+	pages, err := strconv.Atoi(form.Pages)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
+		v.AddError("pages", "must be a whole number")
+	}
+
+	//an empty rating is allowed and counts as not rated
+	var rating float64
+	if form.Rating != "" {
+		rating, err = strconv.ParseFloat(form.Rating, 32)
+		if err != nil {
+			v.AddError("rating", "must be a number")
+		}
 	}
 
 	//genres is being split apart at each comma and converting it into a slice of strings
-	genres := strings.Split(r.PostForm.Get("genres"), ",")
+	genres := []string{}
+	for _, genre := range strings.Split(form.Genres, ",") {
+		if genre = strings.TrimSpace(genre); genre != "" {
+			genres = append(genres, genre)
+		}
+	}
 
-	rating, err := strconv.ParseFloat(r.PostForm.Get("rating"), 32)
-	if err != nil {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
+	book := &data.Book{
+		Title:     form.Title,
+		Author:    form.Author,
+		Pages:     pages,
+		Published: published,
+		Genres:    genres,
+		Rating:    float32(rating),
+		ISBN:      form.ISBN,
 	}
 
-	isbn := r.PostForm.Get("isbn")
+	data.ValidateBook(v, book)
+
+	if !v.Valid() {
+		form.FieldErrors = v.Errors
+		app.renderCreateForm(w, http.StatusUnprocessableEntity, form)
+		return
+	}
 
 	//below is an anonymous struct - those have to be instantiated right away
-	book := struct {
+	input := struct {
 		Title     string   `json:"title"`
 		Author    string   `json:"author"`
 		Pages     int      `json:"pages"`
@@ -172,28 +230,31 @@ func (app *application) bookCreateProcess(w http.ResponseWriter, r *http.Request
 		Rating    float32  `json:"rating"`
 		ISBN      string   `json:"isbn"`
 	}{ //this is a struct literal
-		Title:     title,
-		Author:    author,
-		Pages:     pages,
-		Published: published,
-		Genres:    genres,
-		Rating:    float32(rating),
-		ISBN:      isbn,
+		Title:     book.Title,
+		Author:    book.Author,
+		Pages:     book.Pages,
+		Published: book.Published,
+		Genres:    book.Genres,
+		Rating:    book.Rating,
+		ISBN:      book.ISBN,
 	}
 
-	data, err := json.Marshal(book)
+	body, err := json.Marshal(input)
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
-	req, err := http.NewRequest("POST", app.readinglist.Endpoint, bytes.NewBuffer(data))
+	req, err := http.NewRequest("POST", app.readinglist.Endpoint, bytes.NewBuffer(body))
 	if err != nil {
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 		return
 	}
 
 	req.Header.Set("Content-type", "application/json")
+	if app.readinglist.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+app.readinglist.Token)
+	}
 
 	//below creates the client
 	client := &http.Client{}
@@ -205,6 +266,19 @@ func (app *application) bookCreateProcess(w http.ResponseWriter, r *http.Request
 
 	defer resp.Body.Close()
 
+	//the api checks the same rules, so if it still says no (e.g. it's running a newer version) its errors are shown on the form
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		var validationResp struct {
+			Errors map[string]string `json:"errors"`
+		}
+
+		if err := json.NewDecoder(resp.Body).Decode(&validationResp); err == nil && len(validationResp.Errors) > 0 {
+			form.FieldErrors = validationResp.Errors
+			app.renderCreateForm(w, http.StatusUnprocessableEntity, form)
+			return
+		}
+	}
+
 	if resp.StatusCode != http.StatusCreated {
 		log.Printf("unexpected status: %s", resp.Status)
 		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
@@ -15,9 +15,11 @@ type application struct {
 func main() {
 	addr := flag.String("addr", ":80", "HTTP network address")                                                        //using a flag means we can change it with command line arguments
 	endpoint := flag.String("endpoint", "http://localhost:4000/v1/books", "Endpoint for the readinglist web service") //this defines the endpoint for the readinglist
+	token := flag.String("api-token", "", "Bearer token the web service needs to add books (from POST /v1/tokens/authentication)")
+	flag.Parse()
 
 	app := &application{
-		readinglist: &models.ReadinglistModel{Endpoint: *endpoint}, //this sets the endpoint as a pointer to the endpoint flag that was passed in
+		readinglist: &models.ReadinglistModel{Endpoint: *endpoint, Token: *token}, //this sets the endpoint and token from the flags that were passed in
 	}
 
 	srv := &http.Server{
@@ -4,6 +4,7 @@ import BookDetail from './components/BookDetail'
 import Books from './components/Books'
 import AddBook from './components/AddBook'
 import NavBar from './components/NavBar'
+import SignIn from './components/SignIn'
 
 function App() {
 
@@ -15,6 +16,7 @@ function App() {
           <Route path="/books/:bookId" element={<BookDetail />} />
           <Route path="/" element={<Books />} />
           <Route path="/books/add" element={<AddBook />} />
+          <Route path="/signin" element={<SignIn />} />
         </Routes>
       </div>
     </Router>
@@ -1,10 +1,12 @@
+import { useState } from 'react';
 import { useForm } from 'react-hook-form';
-import { createBook } from '../services/bookService';
+import { authErrorMessage, createBook } from '../services/bookService';
 import { useNavigate } from 'react-router-dom';
 
 const AddBook = () => {
     const { register, handleSubmit, formState: { errors } } = useForm();
     const navigate = useNavigate();
+    const [error, setError] = useState<string | null>(null)
 
     const onSubmit = async (data) => {
         console.log(data)
@@ -27,11 +29,14 @@ const AddBook = () => {
             navigate('/')
         } catch (error) {
             console.error('Failed to create book:', error)
+            setError(authErrorMessage(error) ?? 'Failed to create book: ' + error)
         }
     }
 
     return (
         <form onSubmit={handleSubmit(onSubmit)}>
+            {error && <p>{error}</p>}
+
             <label htmlFor='title'>Title</label>
             <input id='title' {...register('title',
                 { required: true }
@@ -1,5 +1,5 @@
 import { useEffect, useState } from 'react';
-import { getBookById, updateBookById } from '../services/bookService';
+import { authErrorMessage, getBookById, isEditConflict, updateBookById } from '../services/bookService';
 import { useParams } from 'react-router-dom';
 import { TableCell, TableContainer, Paper, Table, TableBody, TableHead, TableRow, TextField } from '@mui/material';
 
@@ -29,21 +29,23 @@ const BookDetail = () => {
     const { bookId } = useParams<{ bookId: string }>();
     const [book, setBook] = useState<Book>(initialBookState);
     const [editState, setEditState] = useState<Record<string, boolean>>({})
+    const [etag, setEtag] = useState<string | undefined>()
 
-    useEffect(() => {
+    const loadBook = () => {
         console.log('Fetching book with ID: ', bookId)
         getBookById(Number(bookId))
             .then(data => {
                 console.log('Book data received: ', data)
                 setBook(data.book)
-                console.log(book)
+                setEtag(data.etag)
             })
             .catch(error => {
                 console.error('Error fetching book:', error);
             }
             )
+    }
 
-    }, [bookId])
+    useEffect(loadBook, [bookId])
 
     const toggleEdit = (field: string) => {
         setEditState(prev => ({ ...prev, [field]: !prev[field] }))
@@ -58,9 +60,22 @@ const BookDetail = () => {
     const handleBlur = (field: string) => {
         toggleEdit(field);
         if (book) {
-            updateBookById(book.id, { [field]: book[field] }).catch(error => {
-                console.error(`Failed to update ${field}:`, error);
-            });
+            updateBookById(book.id, { [field]: book[field] }, etag)
+                .then(data => setEtag(data.etag))
+                .catch(error => {
+                    if (isEditConflict(error)) {
+                        alert('This book was changed by someone else. It has been reloaded, please make your change again.');
+                        loadBook();
+                        return;
+                    }
+                    const message = authErrorMessage(error);
+                    if (message) {
+                        alert(message);
+                        loadBook();
+                        return;
+                    }
+                    console.error(`Failed to update ${field}:`, error);
+                });
         }
     }
 
@@ -1,5 +1,5 @@
 import React, { useMemo, useEffect, useState } from "react";
-import { getBooks, deleteBook } from "../services/bookService";
+import { getBooks, deleteBook, authErrorMessage } from "../services/bookService";
 import Table from '@mui/material/Table';
 import TableBody from '@mui/material/TableBody';
 import TableCell from '@mui/material/TableCell';
@@ -27,6 +27,7 @@ interface Book {
 export const Books: React.FC = () => {
     const [books, setBooks] = useState<Book[]>([]);
     const [error, setError] = useState<string | null>(null)
+    const [deleteError, setDeleteError] = useState<string | null>(null)
     const [searchTerm, setSearchTerm] = useState<string | number>("")
     const [sortColumn, setSortColumn] = useState<string>("id")
     const [sortOrder, setSortOrder] = useState<string>("asc")
@@ -52,12 +53,14 @@ export const Books: React.FC = () => {
     }
 
     const handleDelete = async (id) => {
+        setDeleteError(null)
         try {
             await deleteBook(id)
             setBooks(books.filter(book => book.id !== id))
             console.log('Book deleted successfully')
         } catch (error) {
             console.error('Error deleting book:', error)
+            setDeleteError(authErrorMessage(error) ?? 'Failed to delete book: ' + error)
         }
     }
 
@@ -108,6 +111,7 @@ export const Books: React.FC = () => {
                 <h1>Book List</h1>
                 <input type="text" value={searchTerm} onChange={(e) => setSearchTerm(e.target.value)} placeholder="Search Books" />
             </header>
+            {deleteError && <p>{deleteError}</p>}
             <TableContainer component={Paper}>
                 <Table aria-label="simple table">
                     <TableHead>
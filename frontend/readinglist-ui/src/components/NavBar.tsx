@@ -1,13 +1,16 @@
 import { AppBar, Toolbar, Button, useMediaQuery, IconButton, Menu, MenuItem } from '@mui/material';
 import MenuIcon from '@mui/icons-material/Menu';
 import { useTheme } from '@mui/material/styles';
-import { Link } from 'react-router-dom';
+import { Link, useLocation, useNavigate } from 'react-router-dom';
 import { useState } from 'react';
+import { isSignedIn, signOut } from '../services/bookService';
 
 const NavBar = () => {
     const theme = useTheme();
     const isMobile = useMediaQuery((theme.breakpoints.down('sm')));
     const [anchorEl, setAnchorEl] = useState<null | HTMLElement>(null);
+    const navigate = useNavigate();
+    useLocation(); //this re-renders the bar when the page changes, which is when signing in or out changes which button shows
 
     const handleMenu = (event) => {
         setAnchorEl(event.currentTarget);
@@ -17,6 +20,16 @@ const NavBar = () => {
         setAnchorEl(null)
     }
 
+    const handleSignOut = async () => {
+        handleClose()
+        try {
+            await signOut()
+        } catch (error) {
+            console.error('Failed to sign out:', error)
+        }
+        navigate('/')
+    }
+
     return (
         <AppBar position="fixed">
             <Toolbar>
@@ -47,12 +60,18 @@ const NavBar = () => {
                             >
                                 <MenuItem onClick={handleClose} component={Link} to="/">Home</MenuItem>
                                 <MenuItem onClick={handleClose} component={Link} to="/books/add">Add Book</MenuItem>
+                                {isSignedIn()
+                                    ? <MenuItem onClick={handleSignOut}>Sign Out</MenuItem>
+                                    : <MenuItem onClick={handleClose} component={Link} to="/signin">Sign In</MenuItem>}
                             </Menu>
                         </>
                     ) : (
                         <>
                             <Button color="inherit" component={Link} to="/">Home</Button>
                             <Button color="inherit" component={Link} to="/books/add">Add Book</Button>
+                            {isSignedIn()
+                                ? <Button color="inherit" onClick={handleSignOut}>Sign Out</Button>
+                                : <Button color="inherit" component={Link} to="/signin">Sign In</Button>}
                         </>
                     )
                 }
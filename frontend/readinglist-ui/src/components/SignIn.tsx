@@ -0,0 +1,49 @@
+import { useState } from 'react';
+import { useForm } from 'react-hook-form';
+import { useNavigate } from 'react-router-dom';
+import axios from 'axios';
+import { signIn } from '../services/bookService';
+
+const SignIn = () => {
+    const { register, handleSubmit, formState: { errors } } = useForm();
+    const navigate = useNavigate();
+    const [error, setError] = useState<string | null>(null)
+
+    const onSubmit = async (data) => {
+        setError(null)
+        try {
+            await signIn(data.email, data.password)
+            navigate('/')
+        } catch (error) {
+            //a 401 is a wrong email or password, and a 422 one that can't be right, like a password that is too short
+            if (axios.isAxiosError(error) && (error.response?.status === 401 || error.response?.status === 422)) {
+                setError('The email address or password is wrong.')
+            } else {
+                console.error('Failed to sign in:', error)
+                setError('Failed to sign in: ' + error)
+            }
+        }
+    }
+
+    return (
+        <form onSubmit={handleSubmit(onSubmit)}>
+            {error && <p>{error}</p>}
+
+            <label htmlFor='email'>Email</label>
+            <input id='email' type='email' autoComplete='username' {...register('email',
+                { required: true }
+            )} />
+            {errors.email && <span>This field is required.</span>}
+
+            <label htmlFor='password'>Password</label>
+            <input id='password' type='password' autoComplete='current-password' {...register('password',
+                { required: true }
+            )} />
+            {errors.password && <span>This field is required.</span>}
+
+            <button type='submit'>Sign In</button>
+        </form>
+    )
+}
+
+export default SignIn;
@@ -2,21 +2,82 @@
 import axios from 'axios'
 
 const API_URL = 'http://localhost:3001/v1/books';
+const TOKENS_URL = 'http://localhost:3001/v1/tokens';
 
+// adding, changing and deleting books needs a signed-in user, so every request carries the token from signIn if there is one
+axios.interceptors.request.use((config) => {
+    const token = localStorage.getItem('authToken');
+    if (token) {
+        config.headers.Authorization = `Bearer ${token}`;
+    }
+    return config;
+});
+
+// an expired or revoked token gets a 401 even when reading the books, so it is dropped and the user is treated as signed out
+axios.interceptors.response.use(undefined, (error) => {
+    if (axios.isAxiosError(error) && error.response?.data?.error?.code === 'invalid_token') {
+        localStorage.removeItem('authToken');
+    }
+    return Promise.reject(error);
+});
+
+export const isSignedIn = () => localStorage.getItem('authToken') !== null;
+
+// a 401 means the user has to sign in before they can make the change and a 403 that their account isn't allowed to,
+// e.g. it hasn't been activated yet; anything else isn't about signing in, so there is no message for it
+export const authErrorMessage = (error): string | null => {
+    if (!axios.isAxiosError(error)) {
+        return null;
+    }
+    switch (error.response?.status) {
+        case 401:
+            return 'Please sign in to make changes to the books.';
+        case 403:
+            return error.response.data?.error?.message ?? 'Your account is not allowed to make this change.';
+        default:
+            return null;
+    }
+}
+
+export const signIn = async (email: string, password: string) => {
+    const response = await axios.post(`${TOKENS_URL}/authentication`, { email, password });
+    localStorage.setItem('authToken', response.data.authentication_token.token);
+    return response.data;
+}
+
+export const signOut = async () => {
+    try {
+        await axios.delete(`${TOKENS_URL}/current`);
+    } finally {
+        localStorage.removeItem('authToken');
+    }
+}
+
+// the api sends the books a page at a time, so this keeps asking for the next page until it has had the last one
+// the list searches and sorts them itself, so it needs every book and not just the first page
+// 100 is the biggest page the api allows; an empty library has no metadata, so a missing last_page means this was the only page
 export const getBooks = async () => {
     try {
-        const response = await axios.get(API_URL);
-        return response.data;
+        const books = [];
+        for (let page = 1; ; page++) {
+            const response = await axios.get(API_URL, { params: { page, page_size: 100 } });
+            books.push(...(response.data.books ?? []));
+            if (page >= (response.data.metadata?.last_page ?? 0)) {
+                return { books };
+            }
+        }
     } catch (error) {
         throw error;
     }
 };
 
+// the ETag header holds the version of the book; it is returned alongside the data
+// so it can be sent back in If-Match when the book is updated or deleted
 export const getBookById = async (id: number) => {
     try {
         const response = await axios.get(`${API_URL}/${id}`)
         console.log("API:", response.data.book)
-        return response.data;
+        return { ...response.data, etag: response.headers['etag'] };
     } catch (error) {
         throw new Error('Failed to fetch book details');
     }
@@ -32,19 +93,25 @@ export const createBook = async (bookData) => {
     }
 }
 
-export const updateBookById = async (id: number, bookData) => {
+// a 409 or 412 means someone else changed the book since it was fetched
+export const isEditConflict = (error) =>
+    axios.isAxiosError(error) && (error.response?.status === 409 || error.response?.status === 412);
+
+export const updateBookById = async (id: number, bookData, etag?: string) => {
     try {
-        const response = await axios.put(`${API_URL}/${id}`, bookData)
-        return response.data;
+        const headers = etag ? { 'If-Match': etag } : {};
+        const response = await axios.put(`${API_URL}/${id}`, bookData, { headers })
+        return { ...response.data, etag: response.headers['etag'] };
     } catch (error) {
         console.error('Failed to update book:', error);
-        throw new Error('Failed to update book details')
+        throw error;
     }
 }
 
-export const deleteBook = async (id: number) => {
+export const deleteBook = async (id: number, etag?: string) => {
     try {
-        const response = await axios.delete(`${API_URL}/${id}`)
+        const headers = etag ? { 'If-Match': etag } : {};
+        const response = await axios.delete(`${API_URL}/${id}`, { headers })
         return response.data;
     } catch (error) {
         console.error('Failed to delete book:', error)
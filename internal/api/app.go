@@ -3,28 +3,57 @@ package api
 import (
 	"log"
 	"net/http"
+	"time"
+
 	"readinglist/internal/data"
+	"readinglist/internal/mailer"
+	"readinglist/internal/migrate"
 )
 
 const version = "2.0.0"
 
 type Config struct {
-	Port int
-	Env  string
-	Dsn  string // short for data name service; aka a data connection string; this will be passed in so we can connect to the database
+	Port         int
+	Env          string
+	Dsn          string        // short for data name service; aka a data connection string; this will be passed in so we can connect to the database
+	Store        string        // where the books are kept: db (the database in the dsn, postgres is accepted for it too) or memory
+	QueryTimeout time.Duration // how long a single database query can run before it is cancelled
+
+	TrashRetention     time.Duration // how long a deleted book stays in the trash before it is purged; 0 keeps it forever
+	TrashPurgeInterval time.Duration // how often the purger looks for books that have been in the trash too long
+
+	WebURL string // where the cmd/web frontend is running, the feeds link to the book pages there
+	APIURL string // where clients reach this api, e.g. https://api.example.com; the links in the emails to users are built from it
+
+	// SMTP is the mail server the emails to users go through; with no host they are written to MailDir or the log instead
+	SMTP struct {
+		Host     string
+		Port     int
+		Username string
+		Password string
+		Sender   string
+	}
+	MailDir string // where the development mailer writes the emails as .eml files, empty logs them
+
+	DefaultPermissions   data.Permissions // what a new user is granted when they sign up
+	AnonymousPermissions data.Permissions // what a request without a token is allowed to do, see requirePermission
 }
 
 type Application struct {
-	Config Config
-	Logger *log.Logger
-	Models data.Models
+	Config   Config
+	Logger   *log.Logger
+	Models   data.Models
+	Migrator *migrate.Migrator // this is nil for the in-memory store because it has no schema
+	Mailer   mailer.Mailer
 }
 
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
+		//browsers hide response headers from scripts unless they are listed here; the UI needs the ETag to send it back in If-Match
+		w.Header().Set("Access-Control-Expose-Headers", "ETag, Location, Content-Disposition, WWW-Authenticate")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -33,3 +62,15 @@ func corsMiddleware(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// recordActor puts the email address of the signed in user in the request context with data.WithActor,
+// so the book stores can save who made each change in the book's history
+// it runs after authenticate; an anonymous request (only possible if -anonymous-permissions has books:write) is saved without an actor
+func recordActor(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user := contextGetUser(r); !user.IsAnonymous() {
+			r = r.WithContext(data.WithActor(r.Context(), user.Email))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"readinglist/internal/data"
+	"readinglist/internal/validator"
+)
+
+// userContextKey is where authenticate puts the user the request is signed in as
+const userContextKey = contextKey("user")
+
+func contextSetUser(r *http.Request, user *data.User) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userContextKey, user))
+}
+
+// contextGetUser returns the user authenticate found; every request goes through authenticate, so a request without one is a bug
+func contextGetUser(r *http.Request) *data.User {
+	user, ok := r.Context().Value(userContextKey).(*data.User)
+	if !ok {
+		panic("missing user value in request context")
+	}
+	return user
+}
+
+// bearerToken returns the token in an "Authorization: Bearer <token>" header
+// present is false when there is no bearer token at all; other schemes (e.g. the Basic some e-reader apps send for OPDS) count as no token
+// ok is false when the header says Bearer but there is no token after it
+func bearerToken(r *http.Request) (token string, present, ok bool) {
+	scheme, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", false, true
+	}
+
+	token = strings.TrimSpace(token)
+	return token, true, token != ""
+}
+
+// authenticate works out who the request is from: the user the bearer token was made for, or data.AnonymousUser when there is no token
+// a token that is malformed, expired or revoked is a 401 straight away rather than being treated as anonymous,
+// so a client with a stale token finds out instead of getting confusing 401s (or less data) further on
+func (app *Application) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//the response depends on who is asking, so caches mustn't give one user's response to another
+		w.Header().Add("Vary", "Authorization")
+
+		token, present, ok := bearerToken(r)
+		if !ok {
+			app.invalidAuthenticationToken(w, r)
+			return
+		}
+		if !present {
+			next.ServeHTTP(w, contextSetUser(r, data.AnonymousUser))
+			return
+		}
+
+		v := validator.New()
+		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
+			app.invalidAuthenticationToken(w, r)
+			return
+		}
+
+		user, err := app.Models.Users.GetForToken(r.Context(), data.ScopeAuthentication, token)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.invalidAuthenticationToken(w, r)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		next.ServeHTTP(w, contextSetUser(r, user))
+	})
+}
+
+// requireAuthenticatedUser lets the request through only when it was sent with a valid token
+func (app *Application) requireAuthenticatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if contextGetUser(r).IsAnonymous() {
+			app.authenticationRequired(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireActivatedUser is requireAuthenticatedUser for a user who has also activated their account
+func (app *Application) requireActivatedUser(next http.HandlerFunc) http.HandlerFunc {
+	return app.requireAuthenticatedUser(func(w http.ResponseWriter, r *http.Request) {
+		if !contextGetUser(r).Activated {
+			app.inactiveAccount(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requirePermission lets the request through only when the user has the permission (one of the data.Permission codes)
+// anonymous requests get the permissions in Config.AnonymousPermissions, so e.g. guests can read the books without signing in;
+// anyone else has to be signed in with an activated account that has been granted the permission
+func (app *Application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if app.Config.AnonymousPermissions.Include(code) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := contextGetUser(r)
+
+		switch {
+		case user.IsAnonymous():
+			app.authenticationRequired(w, r)
+			return
+		case !user.Activated:
+			app.inactiveAccount(w, r)
+			return
+		}
+
+		permissions, err := app.Models.Permissions.GetAllForUser(r.Context(), user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if !permissions.Include(code) {
+			app.notPermitted(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireBooksPermission wraps the routes that both read and change books: reading needs books:read, anything else books:write
+// GET, HEAD and OPTIONS are the only methods that don't change anything
+func (app *Application) requireBooksPermission(next http.HandlerFunc) http.HandlerFunc {
+	read := app.requirePermission(data.PermissionBooksRead, next)
+	write := app.requirePermission(data.PermissionBooksWrite, next)
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			read.ServeHTTP(w, r)
+		default:
+			write.ServeHTTP(w, r)
+		}
+	}
+}
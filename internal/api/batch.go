@@ -0,0 +1,285 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"readinglist/internal/data"
+	"readinglist/internal/validator"
+)
+
+// maxBatchOperations caps the size of a batch so one request can't hold a transaction open for too long
+const maxBatchOperations = 500
+
+// errBatchOperationFailed is returned inside the transaction to roll it back once an operation has failed
+// what went wrong has already been written to the operation's result by then
+var errBatchOperationFailed = errors.New("batch operation failed")
+
+// batchOperation is one entry in the array sent to POST /v1/books/batch, e.g.
+//
+//	[
+//		{"op": "create", "book": {"title": "Dune", "published": 1965, "pages": 412, "genres": ["sci-fi"]}},
+//		{"op": "update", "id": 3, "version": 2, "book": {"rating": 4.5}},
+//		{"op": "delete", "id": 7}
+//	]
+//
+// version is optional and does the same job as an If-Match header: the operation fails if the book has changed since
+type batchOperation struct {
+	Op      string    `json:"op"`
+	ID      int64     `json:"id"`
+	Version *int32    `json:"version"`
+	Book    bookInput `json:"book"`
+}
+
+// batchResult says what happened to one operation; index is its position in the array that was sent
+// status is the http status the operation would have got as a request of its own
+// the error and errors fields use the same format as the error responses in errors.go
+type batchResult struct {
+	Index   int               `json:"index"`
+	Op      string            `json:"op"`
+	Status  int               `json:"status"`
+	ID      int64             `json:"id,omitempty"`
+	Version int32             `json:"version,omitempty"`
+	Error   envelope          `json:"error,omitempty"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+func (result *batchResult) fail(status int, code, message string) {
+	result.Status = status
+	result.Error = envelope{"code": code, "message": message}
+}
+
+// batchBooksHandler runs many creates, updates and deletes in one request
+// by default the batch is atomic: everything runs in one transaction and either every operation is saved or none are
+// with ?atomic=false each operation gets a transaction of its own, so the ones that work are saved and the ones that don't are reported
+func (app *Application) batchBooksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	atomic := app.readBool(r.URL.Query(), "atomic", true, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	var operations []batchOperation
+
+	if err := app.ReadJSON(w, r, &operations); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	v.Check(len(operations) > 0, "operations", "must contain at least 1 operation")
+	v.Check(len(operations) <= maxBatchOperations, "operations", fmt.Sprintf("must not contain more than %d operations", maxBatchOperations))
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	results := make([]*batchResult, len(operations))
+	for i, operation := range operations {
+		results[i] = &batchResult{Index: i, Op: operation.Op}
+	}
+
+	if !atomic {
+		for i, operation := range operations {
+			result := results[i]
+
+			//a failed operation has already written its error into the result, and the other operations carry on regardless
+			err := app.Models.Books.WithTx(r.Context(), func(tx data.BookTx) error {
+				return app.runBatchOperation(r, tx, operation, result)
+			})
+
+			//but if the transaction couldn't be started or committed, an operation that worked wasn't saved after all
+			if err != nil && result.Status < 300 {
+				result.Version = 0
+				if result.Op == "create" {
+					result.ID = 0
+				}
+				app.batchError(r, result, err)
+			}
+		}
+
+		if err := app.WriteResponse(w, r, http.StatusOK, envelope{"results": results}, nil); err != nil {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err := app.Models.Books.WithTx(r.Context(), func(tx data.BookTx) error {
+		for i, operation := range operations {
+			if err := app.runBatchOperation(r, tx, operation, results[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == nil {
+		if err := app.WriteResponse(w, r, http.StatusOK, envelope{"results": results}, nil); err != nil {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	//the transaction was rolled back, so the operations that had worked have to be reported as not saved
+	var failed *batchResult
+	for _, result := range results {
+		switch {
+		case result.Status >= 300 && failed == nil:
+			failed = result
+		case result.Status == 0:
+			result.fail(http.StatusFailedDependency, "not_attempted", "not attempted because an earlier operation failed")
+		case result.Status < 300:
+			result.Version = 0
+			if result.Op == "create" {
+				result.ID = 0
+			}
+			result.fail(http.StatusFailedDependency, "rolled_back", "rolled back because another operation failed")
+		}
+	}
+
+	//every operation worked, so it was the commit itself that failed
+	if failed == nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"error":   envelope{"code": "batch_failed", "message": fmt.Sprintf("operation %d failed, so none of the operations were saved", failed.Index)},
+		"results": results,
+	}
+
+	if err := app.WriteResponse(w, r, failed.Status, env, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// runBatchOperation carries out one operation inside tx and fills in its result
+// it returns an error when the operation failed, which rolls back the transaction it is running in
+func (app *Application) runBatchOperation(r *http.Request, tx data.BookTx, operation batchOperation, result *batchResult) error {
+	ctx := r.Context()
+
+	switch operation.Op {
+	case "create":
+		book := &data.Book{}
+		operation.Book.apply(book)
+
+		if err := app.validateBatchBook(book, result); err != nil {
+			return err
+		}
+
+		if err := tx.Insert(ctx, book); err != nil {
+			return app.batchError(r, result, err)
+		}
+
+		result.Status = http.StatusCreated
+		result.ID = book.ID
+		result.Version = book.Version
+
+	case "update":
+		result.ID = operation.ID
+
+		book, err := app.getBatchBook(ctx, tx, operation)
+		if err != nil {
+			return app.batchError(r, result, err)
+		}
+
+		operation.Book.apply(book)
+
+		if err := app.validateBatchBook(book, result); err != nil {
+			return err
+		}
+
+		if err := tx.Update(ctx, book); err != nil {
+			return app.batchError(r, result, err)
+		}
+
+		result.Status = http.StatusOK
+		result.Version = book.Version
+
+	case "delete":
+		result.ID = operation.ID
+
+		//the book only has to be fetched first when there is a version to check it against,
+		//and the version goes to Delete as well so a change after the fetch still stops it
+		var version int32
+		if operation.Version != nil {
+			if _, err := app.getBatchBook(ctx, tx, operation); err != nil {
+				return app.batchError(r, result, err)
+			}
+			version = *operation.Version
+		}
+
+		if err := tx.Delete(ctx, operation.ID, version); err != nil {
+			if errors.Is(err, data.ErrEditConflict) {
+				err = errBatchVersionMismatch
+			}
+			return app.batchError(r, result, err)
+		}
+
+		result.Status = http.StatusOK
+
+	default:
+		result.fail(http.StatusBadRequest, "bad_request", "op must be one of create, update or delete")
+		return errBatchOperationFailed
+	}
+
+	return nil
+}
+
+// errBatchVersionMismatch is the batch version of a failed If-Match
+var errBatchVersionMismatch = errors.New("version mismatch")
+
+// getBatchBook fetches the book an operation is for and checks it against the operation's version if it has one
+func (app *Application) getBatchBook(ctx context.Context, tx data.BookTx, operation batchOperation) (*data.Book, error) {
+	book, err := tx.Get(ctx, operation.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if operation.Version != nil && *operation.Version != book.Version {
+		return nil, errBatchVersionMismatch
+	}
+
+	return book, nil
+}
+
+func (app *Application) validateBatchBook(book *data.Book, result *batchResult) error {
+	v := validator.New()
+
+	if data.ValidateBook(v, book); !v.Valid() {
+		result.fail(http.StatusUnprocessableEntity, "failed_validation", "one or more fields are invalid")
+		result.Errors = v.Errors
+		return errBatchOperationFailed
+	}
+
+	return nil
+}
+
+// batchError writes an error from the store into the result, using the same status and code a single request would get
+func (app *Application) batchError(r *http.Request, result *batchResult, err error) error {
+	switch {
+	case errors.Is(err, data.ErrRecordNotFound):
+		result.fail(http.StatusNotFound, "not_found", "the requested resource could not be found")
+	case errors.Is(err, errBatchVersionMismatch):
+		result.fail(http.StatusPreconditionFailed, "precondition_failed", "the record has been modified since it was last fetched")
+	case errors.Is(err, data.ErrEditConflict):
+		result.fail(http.StatusConflict, "edit_conflict", "unable to update the record due to an edit conflict, please fetch it again and retry")
+	case errors.Is(err, data.ErrDuplicate):
+		result.fail(http.StatusConflict, "duplicate_record", "a record with the same unique values already exists")
+	case errors.Is(err, data.ErrQueryTimeout):
+		result.fail(http.StatusGatewayTimeout, "query_timeout", "the database took too long to respond, please try again later")
+	default:
+		app.logError(r, err)
+		result.fail(http.StatusInternalServerError, "server_error", "the server encountered a problem and could not process your request")
+	}
+
+	return errBatchOperationFailed
+}
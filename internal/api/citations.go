@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"readinglist/internal/citation"
+	"readinglist/internal/data"
+	"readinglist/internal/validator"
+)
+
+// maxCitationIDs caps ?ids= so the list of ids fits in a url and one query
+const maxCitationIDs = 500
+
+// bookCitation writes the citation for one book, GET /v1/books/{id}/citation?style=bibtex|ris|csl-json
+func (app *Application) bookCitation(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	style, ok := app.readCitationStyle(w, r)
+	if !ok {
+		return
+	}
+
+	book, err := app.Models.Books.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	app.writeCitations(w, r, style, []*data.Book{book})
+}
+
+// citationsHandler writes the citations for many books, GET /v1/books/citation
+// either ?ids=1,2,3 picks the books, or the same filters as GET /v1/books do (without paging, every matching book is cited)
+func (app *Application) citationsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	style, ok := app.readCitationStyle(w, r)
+	if !ok {
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	if qs.Get("ids") != "" {
+		ids := app.readIDs(qs, "ids", v)
+		v.Check(len(ids) <= maxCitationIDs, "ids", fmt.Sprintf("must not contain more than %d ids", maxCitationIDs))
+		if !v.Valid() {
+			app.failedValidation(w, r, v.Errors)
+			return
+		}
+
+		books, err := app.Models.Books.GetMany(r.Context(), ids)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		//asking for a book that doesn't exist is more likely a mistake than something to quietly leave out of a bibliography
+		if missing := missingIDs(ids, books); len(missing) > 0 {
+			v.AddError("ids", fmt.Sprintf("there are no books with these ids: %s", strings.Join(missing, ", ")))
+			app.failedValidation(w, r, v.Errors)
+			return
+		}
+
+		app.writeCitations(w, r, style, books)
+		return
+	}
+
+	filters := app.readBookFilters(qs, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	books := []*data.Book{}
+	err := app.Models.Books.Export(r.Context(), filters, func(book *data.Book) error {
+		books = append(books, book)
+		return nil
+	})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.writeCitations(w, r, style, books)
+}
+
+// readCitationStyle reads ?style=, bibtex when it isn't set; when it returns false the error response has already been sent
+func (app *Application) readCitationStyle(w http.ResponseWriter, r *http.Request) (string, bool) {
+	v := validator.New()
+
+	style := app.readString(r.URL.Query(), "style", citation.Styles[0])
+	v.Check(validator.PermittedValue(style, citation.Styles...), "style", "must be one of "+strings.Join(citation.Styles, ", "))
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return "", false
+	}
+
+	return style, true
+}
+
+// readIDs reads a comma-separated list of book ids, e.g. ?ids=1,2,3
+func (app *Application) readIDs(qs url.Values, key string, v *validator.Validator) []int64 {
+	var ids []int64
+
+	for _, s := range app.readCSV(qs, key, nil) {
+		id, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || id < 1 {
+			v.AddError(key, "must be a comma-separated list of book ids")
+			return nil
+		}
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// missingIDs returns the ids that didn't match one of the books
+func missingIDs(ids []int64, books []*data.Book) []string {
+	found := make(map[int64]bool, len(books))
+	for _, book := range books {
+		found[book.ID] = true
+	}
+
+	var missing []string
+	for _, id := range ids {
+		if !found[id] {
+			missing = append(missing, strconv.FormatInt(id, 10))
+			found[id] = true //only report each id once
+		}
+	}
+
+	return missing
+}
+
+// writeCitations writes the citations as they are, with the style's own content type rather than one picked by negotiate
+// they are written to a buffer first so an error can still be sent as a proper error response
+func (app *Application) writeCitations(w http.ResponseWriter, r *http.Request, style string, books []*data.Book) {
+	var buf bytes.Buffer
+
+	if err := citation.Write(&buf, style, books); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", citation.ContentType(style))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
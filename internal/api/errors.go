@@ -0,0 +1,144 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"readinglist/internal/data"
+)
+
+// every error the api sends back uses the same shape so clients only have to handle one format (shown here as json):
+//
+//	{"error": {"code": "not_found", "message": "the requested resource could not be found"}}
+//
+// the code is stable and meant for programs to check, the message is meant for people and may change
+
+// logError writes the error to the log along with the request it happened on
+func (app *Application) logError(r *http.Request, err error) {
+	app.Logger.Printf("error: %s %s: %v", r.Method, r.URL.RequestURI(), err)
+}
+
+// errorResponse writes the error envelope with the given status code
+// if the envelope itself can't be written there is nothing else to tell the client, so it is only logged
+func (app *Application) errorResponse(w http.ResponseWriter, r *http.Request, status int, code string, message any) {
+	env := envelope{"error": envelope{"code": code, "message": message}}
+
+	if err := app.WriteResponse(w, r, status, env, nil); err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// serverError is used when something unexpected went wrong on our side
+// the details are logged but not sent to the client because they could leak information about the server
+// any database call can time out, so timeouts are picked out here rather than in every handler
+func (app *Application) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	app.logError(r, err)
+
+	if errors.Is(err, data.ErrQueryTimeout) {
+		app.queryTimeout(w, r)
+		return
+	}
+
+	message := "the server encountered a problem and could not process your request"
+	app.errorResponse(w, r, http.StatusInternalServerError, "server_error", message)
+}
+
+func (app *Application) notFound(w http.ResponseWriter, r *http.Request) {
+	message := "the requested resource could not be found"
+	app.errorResponse(w, r, http.StatusNotFound, "not_found", message)
+}
+
+func (app *Application) methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	message := fmt.Sprintf("the %s method is not supported for this resource", r.Method)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, "method_not_allowed", message)
+}
+
+// notAcceptable is used when the client asked for a response format the api can't write (see negotiate)
+// it is always sent as json, there is nothing better to send it as
+func (app *Application) notAcceptable(w http.ResponseWriter, r *http.Request) {
+	message := "the requested format is not supported, use application/json, application/xml, application/yaml or text/csv (for lists)"
+	app.errorResponse(w, r, http.StatusNotAcceptable, "not_acceptable", message)
+}
+
+// badRequest is used when the request can't be understood, e.g. badly formed json or a query parameter that isn't a number
+func (app *Application) badRequest(w http.ResponseWriter, r *http.Request, err error) {
+	app.errorResponse(w, r, http.StatusBadRequest, "bad_request", err.Error())
+}
+
+// failedValidation is used when the request was understood but the values in it aren't allowed
+// the errors map has the name of each field that failed as the key and what was wrong with it as the value
+// it is sent both inside the error envelope and as a top level "errors" object so forms can look the fields up directly
+func (app *Application) failedValidation(w http.ResponseWriter, r *http.Request, errors map[string]string) {
+	env := envelope{
+		"error":  envelope{"code": "failed_validation", "message": "one or more fields are invalid"},
+		"errors": errors,
+	}
+
+	if err := app.WriteResponse(w, r, http.StatusUnprocessableEntity, env, nil); err != nil {
+		app.logError(r, err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// editConflict is used when an update lost the race with another update (see data.ErrEditConflict)
+func (app *Application) editConflict(w http.ResponseWriter, r *http.Request) {
+	message := "unable to update the record due to an edit conflict, please fetch it again and retry"
+	app.errorResponse(w, r, http.StatusConflict, "edit_conflict", message)
+}
+
+// duplicate is used when the record would clash with one that already exists (see data.ErrDuplicate)
+func (app *Application) duplicate(w http.ResponseWriter, r *http.Request) {
+	message := "a record with the same unique values already exists"
+	app.errorResponse(w, r, http.StatusConflict, "duplicate_record", message)
+}
+
+// invalidCredentials is used when the email address and password don't match a user
+// it doesn't say which of the two was wrong, that would tell someone guessing which email addresses have accounts
+func (app *Application) invalidCredentials(w http.ResponseWriter, r *http.Request) {
+	message := "invalid authentication credentials"
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_credentials", message)
+}
+
+// invalidAuthenticationToken is used when the bearer token is malformed, has expired or has been revoked
+// the WWW-Authenticate header is what RFC 6750 says a 401 for a bearer token has to have
+func (app *Application) invalidAuthenticationToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+
+	message := "invalid or missing authentication token"
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_token", message)
+}
+
+// authenticationRequired is used when a request without a token tries to do something only a signed in user can
+func (app *Application) authenticationRequired(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", "Bearer")
+
+	message := "you must be authenticated to access this resource"
+	app.errorResponse(w, r, http.StatusUnauthorized, "authentication_required", message)
+}
+
+// inactiveAccount is used when the user is signed in but hasn't activated their account yet
+func (app *Application) inactiveAccount(w http.ResponseWriter, r *http.Request) {
+	message := "your user account must be activated to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, "inactive_account", message)
+}
+
+// notPermitted is used when the user is signed in and activated but hasn't been granted the permission the route needs
+func (app *Application) notPermitted(w http.ResponseWriter, r *http.Request) {
+	message := "your user account doesn't have the necessary permissions to access this resource"
+	app.errorResponse(w, r, http.StatusForbidden, "not_permitted", message)
+}
+
+// preconditionFailed is used when the If-Match header doesn't match the current version of the record
+func (app *Application) preconditionFailed(w http.ResponseWriter, r *http.Request) {
+	message := "the record has been modified since it was last fetched"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, "precondition_failed", message)
+}
+
+// queryTimeout is used when the database took longer than the configured query timeout (see data.ErrQueryTimeout)
+// 504 tells the client that it was something we depend on that was too slow, so it is worth trying again later
+func (app *Application) queryTimeout(w http.ResponseWriter, r *http.Request) {
+	message := "the database took too long to respond, please try again later"
+	app.errorResponse(w, r, http.StatusGatewayTimeout, "query_timeout", message)
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"readinglist/internal/data"
+	"readinglist/internal/marc"
+	"readinglist/internal/validator"
+)
+
+// exportFormats maps each ?format= value to the content type and file extension of the download
+var exportFormats = map[string]struct {
+	contentType string
+	extension   string
+}{
+	"json":  {"application/json", "json"},
+	"jsonl": {"application/x-ndjson", "jsonl"},
+	"csv":   {"text/csv; charset=utf-8", "csv"},
+
+	//MARC 21 records for library catalogues, as binary ISO 2709 or MARCXML
+	"marc":    {"application/marc", "mrc"},
+	"marcxml": {"application/marcxml+xml", "xml"},
+}
+
+// exportColumns is the header row of a CSV export
+var exportColumns = []string{"id", "title", "author", "published", "pages", "genres", "rating", "isbn"}
+
+// exportBooksHandler downloads every book that matches the filters as json, jsonl (one book per line), csv, marc or marcxml
+// it takes the same filters and sort as GET /v1/books, but there are no pages: everything that matches is sent
+// the books are written out as they are read from the database, so a big library doesn't have to fit in memory
+func (app *Application) exportBooksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	format := app.readString(qs, "format", "json")
+	v.Check(validator.PermittedValue(format, "json", "jsonl", "csv", "marc", "marcxml"), "format", "must be one of json, jsonl, csv, marc or marcxml")
+
+	filters := app.readBookFilters(qs, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	//the server's WriteTimeout is for normal responses, a large export to a slow client can take longer than that
+	//if the ResponseWriter can't do this the export still works, it just has the normal timeout
+	//a slow client only holds up its own download, the store reads the books in batches that each give the connection back
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	e := &exporter{w: w, format: format}
+
+	err := app.Models.Books.Export(r.Context(), filters, e.write)
+	if err == nil {
+		err = e.finish()
+	}
+
+	if err != nil {
+		//once the headers have gone out the status can't be changed, so all that can be done is to log the error and stop
+		if e.started {
+			app.logError(r, err)
+			return
+		}
+		app.serverError(w, r, err)
+	}
+}
+
+// exporter writes the books of an export one at a time in the chosen format
+// nothing is written until the first book is ready, so an error from the query itself can still get a proper error response
+type exporter struct {
+	w       http.ResponseWriter
+	format  string
+	started bool
+	csv     *csv.Writer
+	json    *json.Encoder
+	marc    *marc.Writer
+	marcXML *marc.XMLWriter
+}
+
+// start sends the headers and whatever has to come before the first book
+func (e *exporter) start() error {
+	e.started = true
+
+	filename := fmt.Sprintf("books-%s.%s", time.Now().Format("2006-01-02"), exportFormats[e.format].extension)
+
+	e.w.Header().Set("Content-Type", exportFormats[e.format].contentType)
+	e.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	e.w.WriteHeader(http.StatusOK)
+
+	switch e.format {
+	case "csv":
+		e.csv = csv.NewWriter(e.w)
+		return e.writeCSV(exportColumns)
+	case "jsonl":
+		e.json = json.NewEncoder(e.w) //Encode puts a newline after each value, which is all JSON Lines needs
+		return nil
+	case "marc":
+		e.marc = marc.NewWriter(e.w)
+		return nil
+	case "marcxml":
+		e.marcXML = marc.NewXMLWriter(e.w)
+		return nil
+	default:
+		e.json = json.NewEncoder(e.w)
+		_, err := e.w.Write([]byte("["))
+		return err
+	}
+}
+
+// write is passed to BookStore.Export and is called once for each book
+func (e *exporter) write(book *data.Book) error {
+	first := !e.started
+	if first {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+
+	switch e.format {
+	case "csv":
+		//a book can have more than one genre, so they are joined with semicolons into a single column
+		return e.writeCSV([]string{
+			strconv.FormatInt(book.ID, 10),
+			book.Title,
+			book.Author,
+			strconv.Itoa(book.Published),
+			strconv.Itoa(book.Pages),
+			strings.Join(book.Genres, ";"),
+			strconv.FormatFloat(float64(book.Rating), 'f', -1, 32),
+			book.ISBN,
+		})
+	case "marc":
+		return e.marc.Write(marc.FromBook(book))
+	case "marcxml":
+		return e.marcXML.Write(marc.FromBook(book))
+	case "json":
+		//the array is written by hand a book at a time, marshalling a slice of every book would need them all in memory
+		if !first {
+			if _, err := e.w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+	}
+
+	return e.json.Encode(book)
+}
+
+// finish writes whatever has to come after the last book
+// an export that matched no books is still a valid file: an empty array, a CSV file with only the header row, or an empty MARCXML collection
+func (e *exporter) finish() error {
+	if !e.started {
+		if err := e.start(); err != nil {
+			return err
+		}
+	}
+
+	switch e.format {
+	case "json":
+		_, err := e.w.Write([]byte("]\n"))
+		return err
+	case "marcxml":
+		return e.marcXML.Close()
+	}
+
+	return nil
+}
+
+// writeCSV writes one row and flushes it, csv.Writer would otherwise keep the rows in a buffer
+func (e *exporter) writeCSV(row []string) error {
+	if err := e.csv.Write(row); err != nil {
+		return err
+	}
+
+	e.csv.Flush()
+	return e.csv.Error()
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"readinglist/internal/data"
+	"readinglist/internal/feed"
+	"readinglist/internal/validator"
+)
+
+// feedSize is how many of the newest books go in a feed, feed readers only show the latest items anyway
+const feedSize = 50
+
+// feedsHandler serves GET /feeds/books.atom and /feeds/books.rss, the newest books first
+// ?genre= and ?author= narrow the feed down, e.g. /feeds/books.atom?genre=sci-fi for a feed of only sci-fi
+//
+// feed readers poll, so the responses carry an ETag and a Last-Modified, and a request with If-None-Match or If-Modified-Since gets a 304 when nothing has changed
+// the ETag is a hash of the feed itself so it changes whenever anything in it does
+// Last-Modified is the newest revision of the books in the feed, so editing or rating a book moves it as well as adding one,
+// and the books in the trash count too so it moves forward when a book is deleted (see BookStore.LastRevised)
+// a book deleted permanently takes its revisions with it, which is one more reason If-None-Match is checked first
+func (app *Application) feedsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	var contentType string
+	var write func(w io.Writer, channel feed.Channel, books []*data.Book) error
+
+	switch r.URL.Path {
+	case "/feeds/books.atom":
+		contentType, write = feed.AtomType, feed.WriteAtom
+	case "/feeds/books.rss":
+		contentType, write = feed.RSSType, feed.WriteRSS
+	default:
+		app.notFound(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	filters := data.BookFilters{GenresMatch: "all"}
+	filters.Author = app.readString(qs, "author", "")
+	if genre := app.readString(qs, "genre", ""); genre != "" {
+		filters.Genres = []string{genre}
+	}
+	filters.Page = 1
+	filters.PageSize = feedSize
+	filters.Sort = "-created_at"
+	filters.SortSafelist = []string{"-created_at"}
+
+	if data.ValidateBookFilters(v, filters); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	books, _, err := app.Models.Books.GetAll(r.Context(), filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	channel := feed.Channel{
+		ID:          "urn:readinglist:feed:books",
+		Title:       "Reading list",
+		Description: "The newest books on the reading list",
+		SelfURL:     requestBaseURL(r) + r.URL.RequestURI(),
+		WebURL:      app.Config.WebURL,
+	}
+
+	//the id has to be different for each filtered feed, or a reader subscribed to two of them would mix them up
+	var about []string
+	if len(filters.Genres) > 0 {
+		about = append(about, filters.Genres[0])
+		channel.ID += ":genre:" + filters.Genres[0]
+	}
+	if filters.Author != "" {
+		about = append(about, "by "+filters.Author)
+		channel.ID += ":author:" + strings.ToLower(filters.Author)
+	}
+	if len(about) > 0 {
+		channel.Title += ": " + strings.Join(about, ", ")
+		channel.Description += ": " + strings.Join(about, ", ")
+	}
+
+	ids := make([]int64, len(books))
+	for i, book := range books {
+		ids[i] = book.ID
+	}
+
+	channel.Revised, err = app.Models.Books.LastRevised(r.Context(), ids)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	//a feed with nothing in it, and no books in the trash, is as old as it can be
+	channel.Updated = time.Unix(0, 0)
+	for _, book := range books {
+		if book.CreatedAt.After(channel.Updated) {
+			channel.Updated = book.CreatedAt
+		}
+	}
+	for _, revised := range channel.Revised {
+		if revised.After(channel.Updated) {
+			channel.Updated = revised
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := write(&buf, channel, books); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	hash := sha256.Sum256(buf.Bytes())
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hash[:16])+`"`)
+
+	//ServeContent sends the Last-Modified and answers If-None-Match, If-Modified-Since (and HEAD) the way the HTTP spec says to
+	//for an empty feed the time is the Unix epoch, which it treats as unknown and sends no Last-Modified for
+	http.ServeContent(w, r, "", channel.Updated, bytes.NewReader(buf.Bytes()))
+}
@@ -1,46 +1,46 @@
 package api
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
+	"net/url"
+	"strings"
 
 	"readinglist/internal/data" // this imports the data package; one can use the cat go.mod command in terminal to determine how to begin import statement if needed
+	"readinglist/internal/isbn"
+	"readinglist/internal/validator"
 )
 
 // app method handling healthcheck endpoint
 func (app *Application) healthcheck(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		app.methodNotAllowed(w, r)
 		return
 	}
-	//the encoding/marshalling for the healthcheck endpoint will be done differently from the others
-	//it's not going to use a struct to convert the json to and from the messages, it's going to use native types
-	//it's going to assume based on the data type of the go object itself what type of json values should be marshalled into the response
-
-	//using the data variable is expected
-	data := map[string]string{
+	//the healthcheck doesn't use a struct, the envelope is a map so the schema versions below can be left out when there is no database
+	//it goes through WriteResponse like every other handler, so ?format= and the Accept header work the same here
+	env := envelope{
 		"status":      "available",
 		"environment": app.Config.Env,
 		"version":     version,
 	}
-	//below turns the data map from above into json
-	js, err := json.Marshal(data)
 
-	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
-		return // this exits, stopping the rest of the code from running
-	}
-	//This formats the json some
-	js = append(js, '\n')
+	//the schema version shows which migrations the database has had, so a deploy can check it is up to date
+	if app.Migrator != nil {
+		schemaVersion, err := app.Migrator.Version(r.Context())
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
 
-	//Below sets the http headers
-	w.Header().Set("Content-Type", "application/json")
+		env["schema_version"] = schemaVersion
+		env["latest_schema_version"] = app.Migrator.Latest()
+	}
 
-	//Below write the http response - we pass in the json object and that is what will be written in the response
-	w.Write(js)
+	if err := app.WriteResponse(w, r, http.StatusOK, env, nil); err != nil {
+		app.serverError(w, r, err)
+	}
 }
 
 // This is a Handler - an app method handling getting and creating new books within the total list of books
@@ -50,20 +50,31 @@ func (app *Application) getCreateBooksHandler(w http.ResponseWriter, r *http.Req
 
 	//if the endpoint /v1/books is used with get, it does the following
 	if r.Method == http.MethodGet {
+		//the filters come from the query string, e.g. /v1/books?genres=fiction&sort=-rating&page=2
+		v := validator.New()
+
+		filters := app.readBookFilters(r.URL.Query(), v)
+		if !v.Valid() {
+			app.failedValidation(w, r, v.Errors)
+			return
+		}
+
 		//The variable book defines a slice of the data type called Book
-		books, err := app.Models.Books.GetAll()
+		books, metadata, err := app.Models.Books.GetAll(r.Context(), filters)
 		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			app.serverError(w, r, err)
 			return
 		}
 
 		//The code below calls the helper.go function to format, marshall, and write the json
 		//the envelope that is wrapping the books variable is naming that collection of data books and then returning the data of the books variable
-		if err := app.WriteJSON(w, http.StatusOK, envelope{"books": books}, nil); err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		//the metadata tells the client which page this is and how many records there are in total
+		if err := app.WriteResponse(w, r, http.StatusOK, envelope{"books": books, "metadata": metadata}, nil); err != nil {
+			app.serverError(w, r, err)
 			return
 		}
 
+		return
 	}
 	//if the endpoint /v1/books is used with post, it does the following
 	if r.Method == http.MethodPost {
@@ -82,7 +93,7 @@ func (app *Application) getCreateBooksHandler(w http.ResponseWriter, r *http.Req
 
 		err := app.ReadJSON(w, r, &input)
 		if err != nil {
-			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			app.badRequest(w, r, err)
 			return
 		}
 
@@ -96,42 +107,200 @@ func (app *Application) getCreateBooksHandler(w http.ResponseWriter, r *http.Req
 			ISBN:      input.ISBN,
 		}
 
-		err = app.Models.Books.Insert(book)
+		//the book is checked against the rules in data.ValidateBook before it goes anywhere near the database
+		v := validator.New()
+
+		if data.ValidateBook(v, book); !v.Valid() {
+			app.failedValidation(w, r, v.Errors)
+			return
+		}
+
+		err = app.Models.Books.Insert(r.Context(), book)
 		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			switch {
+			case errors.Is(err, data.ErrDuplicate):
+				app.duplicate(w, r)
+			default:
+				app.serverError(w, r, err)
+			}
 			return
 		}
 
 		//this makes the application aware of the new location for the new book
-		headers := make(http.Header)                                 //this makes the new header for the http response
-		headers.Set("Location", fmt.Sprintf("v1/books/%d", book.ID)) //this sets the location of the book to the value of the the books/ api with the new book's id appended to it
+		headers := make(http.Header)                                  //this makes the new header for the http response
+		headers.Set("Location", fmt.Sprintf("/v1/books/%d", book.ID)) //this sets the location of the book to the value of the the books/ api with the new book's id appended to it
 
 		//This writes the JSON response with a 201 Created status code and the Location header set
-		err = app.WriteJSON(w, http.StatusCreated, envelope{"book": book}, headers)
+		err = app.WriteResponse(w, r, http.StatusCreated, envelope{"book": book}, headers)
 		if err != nil {
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			app.serverError(w, r, err)
 			return
 		}
+
+		return
+	}
+
+	//anything other than GET or POST isn't supported on this endpoint
+	app.methodNotAllowed(w, r)
+}
+
+// searchBooksHandler handles full-text searches, e.g. /v1/books/search?q="dune messiah" herb*
+// the results come back ordered by how well they matched with a highlighted snippet for each one
+func (app *Application) searchBooksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+
+	q := app.readString(qs, "q", "")
+	if q == "" {
+		app.badRequest(w, r, errors.New("q must be provided"))
+		return
+	}
+
+	v := validator.New()
+
+	var filters data.Filters
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	results, metadata, err := app.Models.Books.Search(r.Context(), q, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"results": results, "metadata": metadata}, nil); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+}
+
+// trashHandler lists the books in the trash, most recently deleted first
+// they can be brought back with POST /v1/books/{id}/restore until the purger removes them
+func (app *Application) trashHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	var filters data.Filters
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := app.Models.Books.GetTrash(r.Context(), filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
 	}
 
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"books": books, "metadata": metadata}, nil); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
 }
 
 // This is another Handler - an app method handling the get, update, deleting specific books
 // Below is a request multiplexer (aka a request router). It routes incoming requests to a handler using a set of rules
+// anything after the id picks an action on the book, e.g. /v1/books/42/restore
 func (app *Application) getUpdateDeleteBooksHandler(w http.ResponseWriter, r *http.Request) {
-	switch r.Method {
-	case http.MethodGet:
-		app.getBook(w, r)
+	switch app.readAction(r) {
+	case "":
+		switch r.Method {
+		case http.MethodGet:
+			app.getBook(w, r)
+
+		case http.MethodPut:
+			app.updateBook(w, r)
 
-	case http.MethodPut:
-		app.updateBook(w, r)
+		case http.MethodDelete:
+			app.deleteBook(w, r)
+
+		default:
+			app.methodNotAllowed(w, r)
+		}
 
-	case http.MethodDelete:
-		app.deleteBook(w, r)
+	case "restore":
+		if r.Method != http.MethodPost {
+			app.methodNotAllowed(w, r)
+			return
+		}
+		app.restoreBook(w, r)
+
+	case "history":
+		if r.Method != http.MethodGet {
+			app.methodNotAllowed(w, r)
+			return
+		}
+		app.bookHistory(w, r)
+
+	case "diff":
+		if r.Method != http.MethodGet {
+			app.methodNotAllowed(w, r)
+			return
+		}
+		app.diffBook(w, r)
+
+	case "revert":
+		if r.Method != http.MethodPost {
+			app.methodNotAllowed(w, r)
+			return
+		}
+		app.revertBook(w, r)
+
+	case "citation":
+		if r.Method != http.MethodGet {
+			app.methodNotAllowed(w, r)
+			return
+		}
+		app.bookCitation(w, r)
 
 	default:
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		app.notFound(w, r)
+	}
+}
+
+// readBookFilters reads the filtering, sorting and paging values for the book list out of the query string
+// any problems with the values are added to the validator so they can all be reported together
+func (app *Application) readBookFilters(qs url.Values, v *validator.Validator) data.BookFilters {
+	var filters data.BookFilters
+
+	filters.Title = app.readString(qs, "title", "")
+	filters.Author = app.readString(qs, "author", "")
+	filters.Genres = app.readCSV(qs, "genres", []string{})
+	filters.GenresMatch = app.readString(qs, "genres_match", "all")
+	filters.PublishedMin = app.readInt(qs, "published_min", 0, v)
+	filters.PublishedMax = app.readInt(qs, "published_max", 0, v)
+	filters.RatingMin = app.readFloat(qs, "rating_min", 0, v)
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	filters.Sort = app.readString(qs, "sort", "id")
+	//a "-" in front of the column name sorts in descending order
+	filters.SortSafelist = []string{
+		"id", "title", "author", "published", "pages", "rating", "created_at",
+		"-id", "-title", "-author", "-published", "-pages", "-rating", "-created_at",
 	}
+
+	data.ValidateBookFilters(v, filters)
+
+	return filters
 }
 
 //Below is the definition of each specific case above
@@ -140,75 +309,96 @@ func (app *Application) getUpdateDeleteBooksHandler(w http.ResponseWriter, r *ht
 // getting a specific book
 func (app *Application) getBook(w http.ResponseWriter, r *http.Request) {
 	//below is where we get access the book id from the url
-	id := r.URL.Path[len("/v1/books/"):]
-	idInt, err := strconv.ParseInt(id, 10, 64)
+	//an id that isn't a positive number can't match a book, so it is a 404 rather than a 400
+	idInt, err := app.readIDParam(r)
 	if err != nil {
-		http.Error(w, "Bad Request", http.StatusBadRequest)
+		app.notFound(w, r)
 		return
 	}
 
 	//this will be removed when this application si connection to a database
 	//this is using the struct from the internal/data package
-	book, err := app.Models.Books.Get(idInt)
+	book, err := app.Models.Books.Get(r.Context(), idInt)
 	if err != nil {
 		switch {
-		case errors.Is(err, errors.New("record not found")):
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
 		default:
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
+	//the ETag lets the client send the version back in an If-Match header when it updates or deletes the book
+	headers := make(http.Header)
+	headers.Set("ETag", bookETag(book))
+
 	//The code below calls the helper.go function to format, marshall, and write the json
 	//the envelope that is wrapping the book variable is naming that collection of data book and then returning the data of the book variable
-	if err := app.WriteJSON(w, http.StatusOK, envelope{"book": book}, nil); err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"book": book}, headers); err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
 }
 
-func (app *Application) updateBook(w http.ResponseWriter, r *http.Request) {
-	//below is where we get access the book id from the url
-	id := r.URL.Path[len("/v1/books/"):]
-	idInt, err := strconv.ParseInt(id, 10, 64)
-	if err != nil {
-		http.Error(w, "Bad Request2", http.StatusBadRequest)
+// getBookByISBNHandler serves GET /v1/books/isbn/{isbn}
+// the ISBN can be an ISBN-10 or ISBN-13 with or without hyphens, 0-441-17271-7, 0441172717 and 978-0-441-17271-9 all find the same book
+func (app *Application) getBookByISBNHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	number := strings.TrimPrefix(r.URL.Path, "/v1/books/isbn/")
+	if number == "" || strings.Contains(number, "/") {
+		app.notFound(w, r)
 		return
 	}
 
-	book, err := app.Models.Books.Get(idInt) //this calls the database to get the specific book record with the id from the url
+	//a malformed ISBN is the client's mistake, so it gets told why instead of a 404 that looks like the book isn't there
+	v := validator.New()
+	v.Check(isbn.Valid(number), "isbn", "must be a valid ISBN-10 or ISBN-13")
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	book, err := app.Models.Books.GetByISBN(r.Context(), number)
 	if err != nil {
 		switch {
-		case errors.Is(err, errors.New("record not found")):
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
 		default:
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	//the struct below defines the way that we want to unmarshall the json
-	//we are using pointers because we want to modify the existing struct instead of creating a new one
+	headers := make(http.Header)
+	headers.Set("ETag", bookETag(book))
+	headers.Set("Content-Location", fmt.Sprintf("/v1/books/%d", book.ID))
 
-	var input struct {
-		Title     *string  `json:"title"`
-		Author    *string  `json:"author"`
-		Published *int     `json:"published"`
-		Pages     *int     `json:"pages"`
-		Genres    []string `json:"genres"` //not sure why this one isn't a pointer?
-		Rating    *float32 `json:"rating"`
-		ISBN      *string  `json:"isbn"`
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"book": book}, headers); err != nil {
+		app.serverError(w, r, err)
 	}
+}
 
-	//uses the helper function to unmarshall the json into a go object
-	err = app.ReadJSON(w, r, &input)
-	if err != nil {
-		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
-		return
-	}
+// bookInput is the json for changing a book, it is used by PUT /v1/books/{id} and the batch endpoint
+// we are using pointers because we want to modify the existing struct instead of creating a new one,
+// and a field that is left out (nil) has to be told apart from one that is set to its zero value
+type bookInput struct {
+	Title     *string  `json:"title"`
+	Author    *string  `json:"author"`
+	Published *int     `json:"published"`
+	Pages     *int     `json:"pages"`
+	Genres    []string `json:"genres"` //a nil slice already means "left out", so this one doesn't need to be a pointer
+	Rating    *float32 `json:"rating"`
+	ISBN      *string  `json:"isbn"`
+}
 
+// apply copies every field that was sent onto the book
+func (input bookInput) apply(book *data.Book) {
 	if input.Title != nil {
 		book.Title = *input.Title
 	}
@@ -236,46 +426,367 @@ func (app *Application) updateBook(w http.ResponseWriter, r *http.Request) {
 	if input.ISBN != nil {
 		book.ISBN = *input.ISBN
 	}
+}
+
+func (app *Application) updateBook(w http.ResponseWriter, r *http.Request) {
+	//below is where we get access the book id from the url
+	//an id that isn't a positive number can't match a book, so it is a 404 rather than a 400
+	idInt, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	book, err := app.Models.Books.Get(r.Context(), idInt) //this calls the database to get the specific book record with the id from the url
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	//if the client sent an If-Match header it has to match the version it is about to change
+	//otherwise the client was looking at an out of date copy of the book
+	if !ifMatch(r, bookETag(book)) {
+		app.preconditionFailed(w, r)
+		return
+	}
+
+	var input bookInput
+
+	//uses the helper function to unmarshall the json into a go object
+	err = app.ReadJSON(w, r, &input)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	input.apply(book)
+
+	//the merged book is validated as a whole, so a partial update can't leave the book in an invalid state
+	v := validator.New()
+
+	if data.ValidateBook(v, book); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
 
 	//this is where the record is being updated in the database
-	err = app.Models.Books.Update(book)
+	//ErrEditConflict means someone else updated the book between the Get above and this Update
+	err = app.Models.Books.Update(r.Context(), book)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflict(w, r)
+		case errors.Is(err, data.ErrDuplicate):
+			app.duplicate(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
 		return
 	}
 
+	//the new ETag is sent back so the client can make another change without fetching the book again
+	headers := make(http.Header)
+	headers.Set("ETag", bookETag(book))
+
 	//this returns back a response of what was updated
-	if err := app.WriteJSON(w, http.StatusOK, envelope{"book": book}, nil); err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"book": book}, headers); err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 
 }
 
+// deleteBook moves the book to the trash, or with ?permanent=true deletes it for good
+// a permanent delete also works on a book that is already in the trash
 func (app *Application) deleteBook(w http.ResponseWriter, r *http.Request) {
 	//below is where we get access the book id from the url
-	id := r.URL.Path[len("/v1/books/"):]
-	idInt, err := strconv.ParseInt(id, 10, 64)
+	//an id that isn't a positive number can't match a book, so it is a 404 rather than a 400
+	idInt, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	permanent := app.readBool(r.URL.Query(), "permanent", false, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	//when the client sends an If-Match header the book is only deleted if it hasn't changed since the client fetched it
+	//books in the trash can't be fetched, so there is nothing to compare for those and a permanent delete goes ahead
+	//the version that matched is passed on to the store, which only deletes the book if it is still at it,
+	//so a change that lands between the check and the delete is a 412 rather than being thrown away
+	var version int32
+	if r.Header.Get("If-Match") != "" {
+		book, err := app.Models.Books.Get(r.Context(), idInt)
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound) && permanent:
+			//it may be in the trash, DeletePermanently below gives the 404 if it isn't
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+			return
+		case err != nil:
+			app.serverError(w, r, err)
+			return
+		case !ifMatch(r, bookETag(book)):
+			app.preconditionFailed(w, r)
+			return
+		default:
+			version = book.Version
+		}
+	}
+
+	message := "book moved to the trash"
+	if permanent {
+		err = app.Models.Books.DeletePermanently(r.Context(), idInt, version)
+		message = "book permanently deleted"
+	} else {
+		err = app.Models.Books.Delete(r.Context(), idInt, version)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		case errors.Is(err, data.ErrEditConflict):
+			app.preconditionFailed(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	//this is a returned response that uses the app.WriteResponse helper function that says the book was deleted
+	err = app.WriteResponse(w, r, http.StatusOK, envelope{"message": message}, nil)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+}
+
+// restoreBook takes a book back out of the trash and returns it with its new ETag
+func (app *Application) restoreBook(w http.ResponseWriter, r *http.Request) {
+	idInt, err := app.readIDParam(r)
 	if err != nil {
-		http.Error(w, "Bad Request3", http.StatusBadRequest)
+		app.notFound(w, r)
+		return
 	}
-	fmt.Fprintf(w, "Delete the book with ID: %d", idInt)
 
-	err = app.Models.Books.Delete(idInt)
+	book, err := app.Models.Books.Restore(r.Context(), idInt)
 	if err != nil {
 		switch {
-		case errors.Is(err, errors.New("record not found")):
-			http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		case errors.Is(err, data.ErrDuplicate):
+			//another book with the same ISBN was added while this one was in the trash
+			app.duplicate(w, r)
 		default:
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			app.serverError(w, r, err)
 		}
 		return
 	}
 
-	//this is a returned response that uses the app.WriteJSON helper function that says the book was deleted
-	err = app.WriteJSON(w, http.StatusOK, envelope{"message": "book successfully deleted"}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", bookETag(book))
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"book": book}, headers); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+}
+
+// bookHistory lists every saved version of a book, newest first, with who changed it and when
+func (app *Application) bookHistory(w http.ResponseWriter, r *http.Request) {
+	idInt, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	var filters data.Filters
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	revisions, metadata, err := app.Models.Books.History(r.Context(), idInt, filters)
 	if err != nil {
-		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		app.serverError(w, r, err)
+		return
+	}
+
+	//every book has at least the revision from when it was created, so no revisions at all means there is no such book
+	if metadata.TotalRecords == 0 {
+		app.notFound(w, r)
+		return
+	}
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"revisions": revisions, "metadata": metadata}, nil); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+}
+
+// diffBook lists the fields that changed between two versions of a book, e.g. /v1/books/42/diff?from=2&to=5
+// to can be left out to compare against the newest version
+func (app *Application) diffBook(w http.ResponseWriter, r *http.Request) {
+	idInt, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	from := app.readInt(qs, "from", 0, v)
+	to := app.readInt(qs, "to", 0, v)
+
+	v.Check(from > 0, "from", "must be a version number greater than zero")
+	v.Check(to >= 0, "to", "must be a version number greater than zero")
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	if to == 0 {
+		latest, _, err := app.Models.Books.History(r.Context(), idInt, data.Filters{Page: 1, PageSize: 1})
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		if len(latest) == 0 {
+			app.notFound(w, r)
+			return
+		}
+		to = int(latest[0].Version)
+	}
+
+	//both versions are looked up before deciding what went wrong, so the client is told about every missing one
+	fromRevision, fromErr := app.Models.Books.GetRevision(r.Context(), idInt, int32(from))
+	toRevision, toErr := app.Models.Books.GetRevision(r.Context(), idInt, int32(to))
+
+	for _, err := range []error{fromErr, toErr} {
+		if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	v.Check(fromErr == nil, "from", "no such version of this book")
+	v.Check(toErr == nil, "to", "no such version of this book")
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	diff := envelope{
+		"book_id": idInt,
+		"from":    fromRevision.Version,
+		"to":      toRevision.Version,
+		"changes": data.DiffBooks(fromRevision.Book, toRevision.Book),
+	}
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"diff": diff}, nil); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+}
+
+// revertBook puts the fields of a book back to how they were at an earlier version, e.g. POST /v1/books/42/revert?version=3
+// it is saved as a normal update, so it gets a new version and the same If-Match and edit conflict checks as a PUT
+func (app *Application) revertBook(w http.ResponseWriter, r *http.Request) {
+	idInt, err := app.readIDParam(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	v := validator.New()
+
+	version := app.readInt(r.URL.Query(), "version", 0, v)
+	v.Check(version > 0, "version", "must be a version number greater than zero")
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	book, err := app.Models.Books.Get(r.Context(), idInt)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if !ifMatch(r, bookETag(book)) {
+		app.preconditionFailed(w, r)
+		return
+	}
+
+	revision, err := app.Models.Books.GetRevision(r.Context(), idInt, int32(version))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("version", "no such version of this book")
+			app.failedValidation(w, r, v.Errors)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	book.Title = revision.Book.Title
+	book.Author = revision.Book.Author
+	book.Published = revision.Book.Published
+	book.Pages = revision.Book.Pages
+	book.Genres = revision.Book.Genres
+	book.Rating = revision.Book.Rating
+	book.ISBN = revision.Book.ISBN
+
+	//the old version was valid when it was saved, but the rules may have changed since
+	if data.ValidateBook(v, book); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	err = app.Models.Books.Update(r.Context(), book)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflict(w, r)
+		case errors.Is(err, data.ErrDuplicate):
+			app.duplicate(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", bookETag(book))
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"book": book}, headers); err != nil {
+		app.serverError(w, r, err)
 		return
 	}
 }
@@ -0,0 +1,963 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"readinglist/internal/data"
+	"readinglist/internal/mailer"
+)
+
+// newTestServer runs the whole api against the in-memory store, with guests allowed to read and write books
+// configure can change the application before the server starts, e.g. to give it a testMailer
+func newTestServer(t *testing.T, configure ...func(app *Application)) *httptest.Server {
+	t.Helper()
+
+	logger := log.New(io.Discard, "", 0)
+
+	app := &Application{
+		Config: Config{
+			Env:                  "test",
+			AnonymousPermissions: data.Permissions{data.PermissionBooksRead, data.PermissionBooksWrite},
+		},
+		Logger: logger,
+		Models: data.NewMemoryModels(),
+		Mailer: mailer.Log{Logger: logger},
+	}
+	for _, fn := range configure {
+		fn(app)
+	}
+
+	ts := httptest.NewServer(app.Route())
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// do sends a request to the test server and returns the response with its body already read
+func do(t *testing.T, ts *httptest.Server, method, path, body string, headers map[string]string) (*http.Response, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res, string(b)
+}
+
+const dune = `{"title": "Dune", "author": "Frank Herbert", "published": 1965, "pages": 412, "genres": ["sci-fi"]}`
+
+func TestHealthcheck(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"", http.StatusOK, "application/json"},
+		{"application/json", http.StatusOK, "application/json"},
+		{"application/xml", http.StatusOK, "application/xml"},
+		{"text/csv", http.StatusNotAcceptable, "application/json"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			res, body := do(t, ts, http.MethodGet, "/v1/healthcheck", "", map[string]string{"Accept": tt.accept})
+
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d: %s", res.StatusCode, tt.status, body)
+			}
+			if got := res.Header.Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+		})
+	}
+}
+
+func TestCreateBook(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{"valid", dune, http.StatusCreated},
+		{"no title", `{"published": 1965, "pages": 412, "genres": ["sci-fi"]}`, http.StatusUnprocessableEntity},
+		{"published in the future", `{"title": "Dune", "published": 3000, "pages": 412, "genres": ["sci-fi"]}`, http.StatusUnprocessableEntity},
+		{"duplicate genres", `{"title": "Dune", "published": 1965, "pages": 412, "genres": ["sci-fi", "Sci-Fi"]}`, http.StatusUnprocessableEntity},
+		{"unknown field", `{"title": "Dune", "colour": "orange"}`, http.StatusBadRequest},
+		{"not json", `Dune`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, body := do(t, ts, http.MethodPost, "/v1/books", tt.body, nil)
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d: %s", res.StatusCode, tt.status, body)
+			}
+			if tt.status == http.StatusCreated && res.Header.Get("Location") != "/v1/books/1" {
+				t.Errorf("Location = %q, want %q", res.Header.Get("Location"), "/v1/books/1")
+			}
+		})
+	}
+}
+
+func TestGetBook(t *testing.T) {
+	ts := newTestServer(t)
+	do(t, ts, http.MethodPost, "/v1/books", dune, nil)
+
+	tests := []struct {
+		path   string
+		status int
+	}{
+		{"/v1/books/1", http.StatusOK},
+		{"/v1/books/2", http.StatusNotFound},
+		{"/v1/books/0", http.StatusNotFound},
+		{"/v1/books/abc", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, body := do(t, ts, http.MethodGet, tt.path, "", nil)
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d: %s", res.StatusCode, tt.status, body)
+			}
+		})
+	}
+}
+
+func TestIfMatch(t *testing.T) {
+	ts := newTestServer(t)
+	do(t, ts, http.MethodPost, "/v1/books", dune, nil)
+
+	//each step runs in order against the same book, so the version goes up with every update that works
+	steps := []struct {
+		name    string
+		method  string
+		ifMatch string
+		body    string
+		status  int
+	}{
+		{"update at the current version", http.MethodPut, `"1"`, `{"rating": 4.5}`, http.StatusOK},
+		{"update at a stale version", http.MethodPut, `"1"`, `{"rating": 3}`, http.StatusPreconditionFailed},
+		{"update without If-Match", http.MethodPut, "", `{"pages": 500}`, http.StatusOK},
+		{"weak etags never match", http.MethodPut, `W/"3"`, `{"pages": 600}`, http.StatusPreconditionFailed},
+		{"delete at a stale version", http.MethodDelete, `"1"`, "", http.StatusPreconditionFailed},
+		{"delete at the current version", http.MethodDelete, `"3"`, "", http.StatusOK},
+		{"delete once it is in the trash", http.MethodDelete, `"3"`, "", http.StatusNotFound},
+	}
+
+	for _, step := range steps {
+		headers := map[string]string{}
+		if step.ifMatch != "" {
+			headers["If-Match"] = step.ifMatch
+		}
+
+		res, body := do(t, ts, step.method, "/v1/books/1", step.body, headers)
+		if res.StatusCode != step.status {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, res.StatusCode, step.status, body)
+		}
+	}
+}
+
+func TestSearchSnippetIsEscaped(t *testing.T) {
+	ts := newTestServer(t)
+	do(t, ts, http.MethodPost, "/v1/books", `{"title": "<b>Dune</b> & Friends", "published": 1965, "pages": 412, "genres": ["sci-fi"]}`, nil)
+
+	res, body := do(t, ts, http.MethodGet, "/v1/books/search?q=dune", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", res.StatusCode, body)
+	}
+
+	var env struct {
+		Results []struct {
+			Snippet string `json:"snippet"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(body), &env); err != nil {
+		t.Fatal(err)
+	}
+	if len(env.Results) != 1 {
+		t.Fatalf("got %d results, want 1: %s", len(env.Results), body)
+	}
+
+	snippet := env.Results[0].Snippet
+	if !strings.Contains(snippet, "&lt;b&gt;<mark>Dune</mark>&lt;/b&gt; &amp; Friends") {
+		t.Errorf("snippet = %q, the title should be escaped and only the match marked", snippet)
+	}
+}
+
+func TestBatchNotAtomic(t *testing.T) {
+	ts := newTestServer(t)
+
+	body := `[
+		{"op": "create", "book": ` + dune + `},
+		{"op": "create", "book": {"title": ""}},
+		{"op": "update", "id": 1, "version": 1, "book": {"rating": 5}},
+		{"op": "delete", "id": 99}
+	]`
+
+	res, resBody := do(t, ts, http.MethodPost, "/v1/books/batch?atomic=false", body, nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", res.StatusCode, resBody)
+	}
+
+	var env struct {
+		Results []batchResult `json:"results"`
+	}
+	if err := json.Unmarshal([]byte(resBody), &env); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int{http.StatusCreated, http.StatusUnprocessableEntity, http.StatusOK, http.StatusNotFound}
+	if len(env.Results) != len(want) {
+		t.Fatalf("got %d results, want %d: %s", len(env.Results), len(want), resBody)
+	}
+	for i, status := range want {
+		if env.Results[i].Status != status {
+			t.Errorf("results[%d].status = %d, want %d", i, env.Results[i].Status, status)
+		}
+	}
+
+	//the operations that worked were saved even though others failed
+	res, resBody = do(t, ts, http.MethodGet, "/v1/books/1", "", nil)
+	if res.StatusCode != http.StatusOK || res.Header.Get("ETag") != `"2"` {
+		t.Errorf("book 1 = %d, ETag %q, want 200 and \"2\": %s", res.StatusCode, res.Header.Get("ETag"), resBody)
+	}
+}
+
+// testMailer hands the emails the api sends to the test instead of sending them
+type testMailer chan *mailer.Message
+
+func (m testMailer) Send(msg *mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+// nextEmail waits for the email the api sends in the background
+func (m testMailer) nextEmail(t *testing.T) *mailer.Message {
+	t.Helper()
+
+	select {
+	case msg := <-m:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email was sent")
+		return nil
+	}
+}
+
+func TestActivationLinkIgnoresHost(t *testing.T) {
+	mail := make(testMailer, 1)
+	ts := newTestServer(t, func(app *Application) {
+		app.Config.APIURL = "https://api.example.com"
+		app.Mailer = mail
+	})
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/users", strings.NewReader(`{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = "evil.example"
+	req.Header.Set("X-Forwarded-Proto", "https")
+
+	res, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusAccepted)
+	}
+
+	msg := mail.nextEmail(t)
+	for _, body := range []string{msg.PlainBody, msg.HTMLBody} {
+		if strings.Contains(body, "evil.example") {
+			t.Errorf("the email links to the Host the client sent:\n%s", body)
+		}
+		if !strings.Contains(body, "https://api.example.com/v1/users/activated") {
+			t.Errorf("the email doesn't link to the configured api url:\n%s", body)
+		}
+	}
+}
+
+func TestFeedConditionalGet(t *testing.T) {
+	ts := newTestServer(t)
+	do(t, ts, http.MethodPost, "/v1/books", dune, nil)
+
+	res, body := do(t, ts, http.MethodGet, "/feeds/books.atom", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", res.StatusCode, body)
+	}
+
+	lastModified, err := http.ParseTime(res.Header.Get("Last-Modified"))
+	if err != nil {
+		t.Fatalf("Last-Modified %q: %v", res.Header.Get("Last-Modified"), err)
+	}
+	etag := res.Header.Get("ETag")
+
+	//the entry was last changed when the book was added, which is also the newest change in the feed
+	if updated := "<updated>" + lastModified.UTC().Format(time.RFC3339) + "</updated>"; strings.Count(body, updated) != 2 {
+		t.Errorf("the feed and its entry should both be updated at the Last-Modified time:\n%s", body)
+	}
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		status  int
+	}{
+		{"same etag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"other etag", map[string]string{"If-None-Match": `"other"`}, http.StatusOK},
+		{"modified since then", map[string]string{"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)}, http.StatusOK},
+		{"not modified since then", map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)}, http.StatusNotModified},
+		{"If-None-Match wins", map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified.Format(http.TimeFormat)}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, _ := do(t, ts, http.MethodGet, "/feeds/books.atom", "", tt.headers)
+			if res.StatusCode != tt.status {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.status)
+			}
+		})
+	}
+
+	//rating the book changes the feed, so the old ETag no longer matches
+	do(t, ts, http.MethodPut, "/v1/books/1", `{"rating": 4.5}`, nil)
+
+	res, body = do(t, ts, http.MethodGet, "/feeds/books.atom", "", map[string]string{"If-None-Match": etag})
+	if res.StatusCode != http.StatusOK || !strings.Contains(body, "rated 4.5/5") {
+		t.Errorf("status = %d after the book was rated, want 200 with the new rating:\n%s", res.StatusCode, body)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	ts := newTestServer(t)
+	do(t, ts, http.MethodPost, "/v1/books", `{"title": "Dune", "published": 1965, "pages": 412, "genres": ["sci-fi"], "isbn": "0441172717"}`, nil)
+
+	//each step runs in order; the book in the trash keeps its ISBN, so another book can take it while it is there
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"move to the trash", http.MethodDelete, "/v1/books/1", "", http.StatusOK},
+		{"gone from the books", http.MethodGet, "/v1/books/1", "", http.StatusNotFound},
+		{"a new book takes the ISBN", http.MethodPost, "/v1/books", `{"title": "Dune (again)", "published": 1965, "pages": 412, "genres": ["sci-fi"], "isbn": "978-0-441-17271-9"}`, http.StatusCreated},
+		{"restoring would duplicate the ISBN", http.MethodPost, "/v1/books/1/restore", "", http.StatusConflict},
+		{"delete the new book for good", http.MethodDelete, "/v1/books/2?permanent=true", "", http.StatusOK},
+		{"restore", http.MethodPost, "/v1/books/1/restore", "", http.StatusOK},
+		{"back in the books", http.MethodGet, "/v1/books/1", "", http.StatusOK},
+		{"restore a book that isn't in the trash", http.MethodPost, "/v1/books/1/restore", "", http.StatusNotFound},
+		{"restore a book that was deleted for good", http.MethodPost, "/v1/books/2/restore", "", http.StatusNotFound},
+		{"restore with GET", http.MethodGet, "/v1/books/1/restore", "", http.StatusMethodNotAllowed},
+		{"move to the trash again", http.MethodDelete, "/v1/books/1", "", http.StatusOK},
+		{"delete from the trash for good", http.MethodDelete, "/v1/books/1?permanent=true", "", http.StatusOK},
+		{"nothing left to restore", http.MethodPost, "/v1/books/1/restore", "", http.StatusNotFound},
+	}
+
+	for _, step := range steps {
+		res, body := do(t, ts, step.method, step.path, step.body, nil)
+		if res.StatusCode != step.status {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, res.StatusCode, step.status, body)
+		}
+	}
+
+	_, body := do(t, ts, http.MethodGet, "/v1/books/trash", "", nil)
+	if !strings.Contains(body, `"books":[]`) {
+		t.Errorf("the trash should be empty: %s", body)
+	}
+}
+
+func TestTrashList(t *testing.T) {
+	ts := newTestServer(t)
+	for i := 0; i < 3; i++ {
+		do(t, ts, http.MethodPost, "/v1/books", dune, nil)
+	}
+	do(t, ts, http.MethodDelete, "/v1/books/1", "", nil)
+	do(t, ts, http.MethodDelete, "/v1/books/3", "", nil)
+
+	res, body := do(t, ts, http.MethodGet, "/v1/books/trash", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d: %s", res.StatusCode, body)
+	}
+
+	var env struct {
+		Books []data.Book `json:"books"`
+	}
+	if err := json.Unmarshal([]byte(body), &env); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []int64
+	for _, book := range env.Books {
+		if book.DeletedAt == nil {
+			t.Errorf("book %d in the trash has no deleted_at", book.ID)
+		}
+		ids = append(ids, book.ID)
+	}
+	//the most recently trashed first, and by id when they were trashed in the same second
+	if len(ids) != 2 || !(ids[0] == 3 && ids[1] == 1 || ids[0] == 1 && ids[1] == 3) {
+		t.Errorf("trash = %v, want books 1 and 3", ids)
+	}
+}
+
+func TestHistoryDiffRevert(t *testing.T) {
+	ts := newTestServer(t)
+	do(t, ts, http.MethodPost, "/v1/books", dune, nil)
+	do(t, ts, http.MethodPut, "/v1/books/1", `{"rating": 4}`, nil)
+	do(t, ts, http.MethodPut, "/v1/books/1", `{"title": "Dune Messiah"}`, nil)
+
+	res, body := do(t, ts, http.MethodGet, "/v1/books/1/history", "", nil)
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("history status = %d: %s", res.StatusCode, body)
+	}
+
+	var history struct {
+		Revisions []data.BookRevision `json:"revisions"`
+	}
+	if err := json.Unmarshal([]byte(body), &history); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, revision := range history.Revisions {
+		got = append(got, fmt.Sprintf("%d %s %s", revision.Version, revision.Operation, revision.Book.Title))
+	}
+	if want := []string{"3 update Dune Messiah", "2 update Dune", "1 insert Dune"}; !slices.Equal(got, want) {
+		t.Errorf("history = %q, want %q", got, want)
+	}
+
+	steps := []struct {
+		name    string
+		method  string
+		path    string
+		ifMatch string
+		status  int
+		want    string //something the body has to contain
+	}{
+		{"history of a book that doesn't exist", http.MethodGet, "/v1/books/99/history", "", http.StatusNotFound, ""},
+		{"diff", http.MethodGet, "/v1/books/1/diff?from=1&to=3", "", http.StatusOK, `"changes":[{"field":"title","from":"Dune","to":"Dune Messiah"},{"field":"rating","from":0,"to":4}]`},
+		{"diff against the newest", http.MethodGet, "/v1/books/1/diff?from=2", "", http.StatusOK, `"to":3`},
+		{"diff from nothing", http.MethodGet, "/v1/books/1/diff", "", http.StatusUnprocessableEntity, `"from"`},
+		{"diff to a version that doesn't exist", http.MethodGet, "/v1/books/1/diff?from=1&to=9", "", http.StatusUnprocessableEntity, "no such version"},
+		{"revert at a stale version", http.MethodPost, "/v1/books/1/revert?version=1", `"2"`, http.StatusPreconditionFailed, ""},
+		{"revert to a version that doesn't exist", http.MethodPost, "/v1/books/1/revert?version=9", `"3"`, http.StatusUnprocessableEntity, "no such version"},
+		{"revert without a version", http.MethodPost, "/v1/books/1/revert", `"3"`, http.StatusUnprocessableEntity, `"version"`},
+		{"revert", http.MethodPost, "/v1/books/1/revert?version=1", `"3"`, http.StatusOK, `"title":"Dune"`},
+		{"revert saves a new version", http.MethodGet, "/v1/books/1/history?page_size=1", "", http.StatusOK, `"version":4,"operation":"update"`},
+		{"back to how it was", http.MethodGet, "/v1/books/1/diff?from=1&to=4", "", http.StatusOK, `"changes":[]`},
+		{"revert with GET", http.MethodGet, "/v1/books/1/revert?version=1", "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, step := range steps {
+		headers := map[string]string{}
+		if step.ifMatch != "" {
+			headers["If-Match"] = step.ifMatch
+		}
+
+		res, body := do(t, ts, step.method, step.path, "", headers)
+		if res.StatusCode != step.status {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, res.StatusCode, step.status, body)
+		}
+		if !strings.Contains(body, step.want) {
+			t.Errorf("%s: the body should contain %s: %s", step.name, step.want, body)
+		}
+	}
+}
+
+func TestExport(t *testing.T) {
+	ts := newTestServer(t)
+	do(t, ts, http.MethodPost, "/v1/books", dune, nil)
+	do(t, ts, http.MethodPost, "/v1/books", `{"title": "Emma", "author": "Jane Austen", "published": 1815, "pages": 474, "genres": ["classic", "romance"]}`, nil)
+	do(t, ts, http.MethodPost, "/v1/books", `{"title": "Beloved, a Novel", "author": "Toni Morrison", "published": 1987, "pages": 324, "genres": ["fiction"]}`, nil)
+
+	tests := []struct {
+		query       string
+		status      int
+		contentType string
+		want        string
+	}{
+		{
+			"format=csv&sort=title", http.StatusOK, "text/csv",
+			"id,title,author,published,pages,genres,rating,isbn\n" +
+				"3,\"Beloved, a Novel\",Toni Morrison,1987,324,fiction,0,\n" +
+				"1,Dune,Frank Herbert,1965,412,sci-fi,0,\n" +
+				"2,Emma,Jane Austen,1815,474,classic;romance,0,\n",
+		},
+		{"format=csv&title=nothing", http.StatusOK, "text/csv", "id,title,author,published,pages,genres,rating,isbn\n"},
+		{"format=jsonl&sort=-published", http.StatusOK, "application/x-ndjson", "Beloved, a Novel\nDune\nEmma\n"},
+		{"format=jsonl&genres=classic", http.StatusOK, "application/x-ndjson", "Emma\n"},
+		{"format=jsonl&title=nothing", http.StatusOK, "application/x-ndjson", ""},
+		{"format=xlsx", http.StatusUnprocessableEntity, "application/json", `"format"`},
+		{"format=csv&sort=isbn", http.StatusUnprocessableEntity, "application/json", `"sort"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			res, body := do(t, ts, http.MethodGet, "/v1/books/export?"+tt.query, "", nil)
+
+			if res.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d: %s", res.StatusCode, tt.status, body)
+			}
+			if got := res.Header.Get("Content-Type"); !strings.HasPrefix(got, tt.contentType) {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+
+			switch {
+			case res.StatusCode != http.StatusOK:
+				if !strings.Contains(body, tt.want) {
+					t.Errorf("the body should contain %s: %s", tt.want, body)
+				}
+			case tt.contentType == "application/x-ndjson":
+				//each line has to be a whole book on its own, only the titles are compared
+				var titles strings.Builder
+				for _, line := range strings.SplitAfter(body, "\n") {
+					if line == "" {
+						continue
+					}
+					var book data.Book
+					if err := json.Unmarshal([]byte(line), &book); err != nil {
+						t.Fatalf("line %q isn't a book: %v", line, err)
+					}
+					titles.WriteString(book.Title + "\n")
+				}
+				if titles.String() != tt.want {
+					t.Errorf("titles = %q, want %q", titles.String(), tt.want)
+				}
+			default:
+				if body != tt.want {
+					t.Errorf("body = %q, want %q", body, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestOPDSPaging(t *testing.T) {
+	//120 books is two full pages and a bit, every third book is sci-fi as well
+	ts := newTestServer(t, func(app *Application) {
+		for i := 1; i <= 120; i++ {
+			book := &data.Book{Title: fmt.Sprintf("Book %03d", i), Author: "Someone", Published: 2000, Pages: 100, Genres: []string{"fiction"}}
+			if i%3 == 0 {
+				book.Genres = append(book.Genres, "sci-fi")
+			}
+			if err := app.Models.Books.Insert(context.Background(), book); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	tests := []struct {
+		path    string
+		status  int
+		first   string //the title of the first entry, if it matters
+		entries int
+		links   map[string]string //rel to href, only for the paging links
+	}{
+		{"/opds/books", http.StatusOK, "Book 001", 50, map[string]string{
+			"next": "/opds/books?page=2",
+			"last": "/opds/books?page=3",
+		}},
+		{"/opds/books?page=2", http.StatusOK, "Book 051", 50, map[string]string{
+			"first":    "/opds/books?page=1",
+			"previous": "/opds/books?page=1",
+			"next":     "/opds/books?page=3",
+			"last":     "/opds/books?page=3",
+		}},
+		{"/opds/books?page=3", http.StatusOK, "Book 101", 20, map[string]string{
+			"first":    "/opds/books?page=1",
+			"previous": "/opds/books?page=2",
+		}},
+		//the books were all added within a second or so, so there is no telling which comes first
+		{"/opds/recent", http.StatusOK, "", 50, map[string]string{
+			"next": "/opds/recent?page=2",
+			"last": "/opds/recent?page=3",
+		}},
+		{"/opds/genres/sci-fi", http.StatusOK, "Book 003", 40, map[string]string{}},
+		{"/opds/search?q=book&page=2", http.StatusOK, "", 50, map[string]string{
+			"first":    "/opds/search?page=1&q=book",
+			"previous": "/opds/search?page=1&q=book",
+			"next":     "/opds/search?page=3&q=book",
+			"last":     "/opds/search?page=3&q=book",
+		}},
+		{"/opds/books?page=0", http.StatusUnprocessableEntity, "", 0, nil},
+		{"/opds/genres/poetry", http.StatusNotFound, "", 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, body := do(t, ts, http.MethodGet, tt.path, "", nil)
+			if res.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d: %s", res.StatusCode, tt.status, body)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			var feed struct {
+				Links []struct {
+					Rel  string `xml:"rel,attr"`
+					Href string `xml:"href,attr"`
+				} `xml:"link"`
+				Entries []struct {
+					Title string `xml:"title"`
+				} `xml:"entry"`
+			}
+			if err := xml.Unmarshal([]byte(body), &feed); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(feed.Entries) != tt.entries {
+				t.Fatalf("%d entries, want %d", len(feed.Entries), tt.entries)
+			}
+			if tt.first != "" && feed.Entries[0].Title != tt.first {
+				t.Errorf("the first entry is %q, want %q", feed.Entries[0].Title, tt.first)
+			}
+
+			links := map[string]string{}
+			for _, link := range feed.Links {
+				switch link.Rel {
+				case "first", "previous", "next", "last":
+					links[link.Rel] = link.Href
+				}
+			}
+			if !maps.Equal(links, tt.links) {
+				t.Errorf("paging links = %v, want %v", links, tt.links)
+			}
+		})
+	}
+}
+
+// activationTokenPattern finds the token in the plain text welcome email
+var activationTokenPattern = regexp.MustCompile(`"token": "(\w{26})"`)
+
+// activationToken is the token in a welcome email
+func activationToken(t *testing.T, msg *mailer.Message) string {
+	t.Helper()
+
+	match := activationTokenPattern.FindStringSubmatch(msg.PlainBody)
+	if match == nil {
+		t.Fatalf("there is no activation token in the email:\n%s", msg.PlainBody)
+	}
+	return match[1]
+}
+
+func TestRegisterAndActivate(t *testing.T) {
+	mail := make(testMailer, 1)
+	ts := newTestServer(t, func(app *Application) {
+		app.Mailer = mail
+	})
+
+	alice := `{"name": "Alice", "email": "alice@example.com", "password": "pa55word1234"}`
+
+	res, body := do(t, ts, http.MethodPost, "/v1/users", alice, nil)
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("register status = %d: %s", res.StatusCode, body)
+	}
+	if strings.Contains(body, "pa55word1234") || !strings.Contains(body, `"activated":false`) {
+		t.Errorf("register should return the user, not activated and without the password: %s", body)
+	}
+
+	msg := mail.nextEmail(t)
+	if msg.To != "alice@example.com" {
+		t.Errorf("the welcome email went to %q", msg.To)
+	}
+	token := activationToken(t, msg)
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		want   string //something the body has to contain
+	}{
+		{"the same email again", http.MethodPost, "/v1/users", `{"name": "Alice", "email": "alice@example.com", "password": "another1234"}`, http.StatusUnprocessableEntity, "already exists"},
+		{"a short password", http.MethodPost, "/v1/users", `{"name": "Bob", "email": "bob@example.com", "password": "short"}`, http.StatusUnprocessableEntity, `"password"`},
+		{"a bad email", http.MethodPost, "/v1/users", `{"name": "Bob", "email": "bob", "password": "pa55word1234"}`, http.StatusUnprocessableEntity, `"email"`},
+		{"a token that is too short", http.MethodPut, "/v1/users/activated", `{"token": "abc"}`, http.StatusUnprocessableEntity, "26 bytes"},
+		{"somebody else's token", http.MethodPut, "/v1/users/activated", `{"token": "ABCDEFGHIJKLMNOPQRSTUVWXYZ"}`, http.StatusUnprocessableEntity, "invalid or expired"},
+		{"activate", http.MethodPut, "/v1/users/activated", `{"token": "` + token + `"}`, http.StatusOK, `"activated":true`},
+		{"the token only works once", http.MethodPut, "/v1/users/activated", `{"token": "` + token + `"}`, http.StatusUnprocessableEntity, "invalid or expired"},
+		{"activate with POST", http.MethodPost, "/v1/users/activated", `{"token": "` + token + `"}`, http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, step := range steps {
+		res, body := do(t, ts, step.method, step.path, step.body, nil)
+		if res.StatusCode != step.status {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, res.StatusCode, step.status, body)
+		}
+		if !strings.Contains(body, step.want) {
+			t.Errorf("%s: the body should contain %s: %s", step.name, step.want, body)
+		}
+	}
+
+	//none of the failed sign ups sent an email
+	select {
+	case msg := <-mail:
+		t.Errorf("an email was sent to %s", msg.To)
+	default:
+	}
+}
+
+// signUp registers a user with the password pa55word1234, activates them if activate is true, and returns a token to sign their requests with
+func signUp(t *testing.T, ts *httptest.Server, mail testMailer, email string, activate bool) string {
+	t.Helper()
+
+	res, body := do(t, ts, http.MethodPost, "/v1/users", `{"name": "Someone", "email": "`+email+`", "password": "pa55word1234"}`, nil)
+	if res.StatusCode != http.StatusAccepted {
+		t.Fatalf("signing %s up: status = %d: %s", email, res.StatusCode, body)
+	}
+
+	token := activationToken(t, mail.nextEmail(t))
+	if activate {
+		res, body := do(t, ts, http.MethodPut, "/v1/users/activated", `{"token": "`+token+`"}`, nil)
+		if res.StatusCode != http.StatusOK {
+			t.Fatalf("activating %s: status = %d: %s", email, res.StatusCode, body)
+		}
+	}
+
+	res, body = do(t, ts, http.MethodPost, "/v1/tokens/authentication", `{"email": "`+email+`", "password": "pa55word1234"}`, nil)
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("signing %s in: status = %d: %s", email, res.StatusCode, body)
+	}
+
+	var input struct {
+		Token struct {
+			Plaintext string `json:"token"`
+		} `json:"authentication_token"`
+	}
+	if err := json.Unmarshal([]byte(body), &input); err != nil {
+		t.Fatal(err)
+	}
+	return input.Token.Plaintext
+}
+
+func TestAuthentication(t *testing.T) {
+	mail := make(testMailer, 1)
+	ts := newTestServer(t, func(app *Application) {
+		app.Config.AnonymousPermissions = data.Permissions{data.PermissionBooksRead}
+		app.Config.DefaultPermissions = data.Permissions{data.PermissionBooksRead, data.PermissionBooksWrite}
+		app.Mailer = mail
+	})
+
+	alice := signUp(t, ts, mail, "alice@example.com", true)
+	bob := signUp(t, ts, mail, "bob@example.com", false)
+
+	steps := []struct {
+		name          string
+		method        string
+		path          string
+		body          string
+		authorization string
+		status        int
+		code          string //the error's code, or "" when it isn't an error
+		authenticate  string //the WWW-Authenticate header a 401 has to have
+	}{
+		{"guests can read", http.MethodGet, "/v1/books", "", "", http.StatusOK, "", ""},
+		{"guests can't write", http.MethodPost, "/v1/books", dune, "", http.StatusUnauthorized, "authentication_required", "Bearer"},
+		{"a token that was never issued", http.MethodGet, "/v1/books", "", "Bearer ABCDEFGHIJKLMNOPQRSTUVWXYZ", http.StatusUnauthorized, "invalid_token", `Bearer error="invalid_token"`},
+		{"a malformed token", http.MethodGet, "/v1/books", "", "Bearer abc", http.StatusUnauthorized, "invalid_token", `Bearer error="invalid_token"`},
+		{"Bearer with no token", http.MethodGet, "/v1/books", "", "Bearer ", http.StatusUnauthorized, "invalid_token", `Bearer error="invalid_token"`},
+		{"basic auth counts as a guest", http.MethodGet, "/opds", "", "Basic YWxpY2U6c2VjcmV0", http.StatusOK, "", ""},
+		{"a wrong password", http.MethodPost, "/v1/tokens/authentication", `{"email": "alice@example.com", "password": "wrong1234567"}`, "", http.StatusUnauthorized, "invalid_credentials", ""},
+		{"an unknown email", http.MethodPost, "/v1/tokens/authentication", `{"email": "carol@example.com", "password": "pa55word1234"}`, "", http.StatusUnauthorized, "invalid_credentials", ""},
+		{"not activated yet", http.MethodPost, "/v1/books", dune, "Bearer " + bob, http.StatusForbidden, "inactive_account", ""},
+		{"not activated can still read", http.MethodGet, "/v1/books", "", "Bearer " + bob, http.StatusOK, "", ""},
+		{"create", http.MethodPost, "/v1/books", dune, "Bearer " + alice, http.StatusCreated, "", ""},
+		{"update", http.MethodPut, "/v1/books/1", `{"rating": 4}`, "Bearer " + alice, http.StatusOK, "", ""},
+		{"guests can't update", http.MethodPut, "/v1/books/1", `{"rating": 5}`, "", http.StatusUnauthorized, "authentication_required", "Bearer"},
+		{"guests can't delete", http.MethodDelete, "/v1/books/1", "", "", http.StatusUnauthorized, "authentication_required", "Bearer"},
+		{"delete", http.MethodDelete, "/v1/books/1", "", "Bearer " + alice, http.StatusOK, "", ""},
+		{"guests can't sign out", http.MethodDelete, "/v1/tokens/current", "", "", http.StatusUnauthorized, "authentication_required", "Bearer"},
+		{"sign out", http.MethodDelete, "/v1/tokens/current", "", "Bearer " + alice, http.StatusOK, "", ""},
+		{"a revoked token", http.MethodGet, "/v1/books", "", "Bearer " + alice, http.StatusUnauthorized, "invalid_token", `Bearer error="invalid_token"`},
+		{"other tokens still work", http.MethodGet, "/v1/books", "", "Bearer " + bob, http.StatusOK, "", ""},
+	}
+
+	for _, step := range steps {
+		headers := map[string]string{}
+		if step.authorization != "" {
+			headers["Authorization"] = step.authorization
+		}
+
+		res, body := do(t, ts, step.method, step.path, step.body, headers)
+		if res.StatusCode != step.status {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, res.StatusCode, step.status, body)
+		}
+		if step.code != "" && !strings.Contains(body, `"code":"`+step.code+`"`) {
+			t.Errorf("%s: the error code should be %s: %s", step.name, step.code, body)
+		}
+		if got := res.Header.Get("WWW-Authenticate"); got != step.authenticate {
+			t.Errorf("%s: WWW-Authenticate = %q, want %q", step.name, got, step.authenticate)
+		}
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	mail := make(testMailer, 1)
+	var app *Application
+	ts := newTestServer(t, func(a *Application) {
+		a.Config.AnonymousPermissions = nil
+		a.Config.DefaultPermissions = data.Permissions{data.PermissionBooksRead}
+		a.Mailer = mail
+		app = a
+	})
+
+	//there is no route that makes the first admin, that is done in the database
+	admin := signUp(t, ts, mail, "admin@example.com", true)
+	if err := app.Models.Permissions.AddForUser(context.Background(), 1, data.PermissionAdmin); err != nil {
+		t.Fatal(err)
+	}
+	bob := signUp(t, ts, mail, "bob@example.com", true)
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		token  string
+		status int
+		want   string //something the body has to contain
+	}{
+		{"guests can't read when they have no permissions", http.MethodGet, "/v1/books", "", "", http.StatusUnauthorized, "authentication_required"},
+		{"new users get the default permissions", http.MethodGet, "/v1/books", "", bob, http.StatusOK, ""},
+		{"which don't include writing", http.MethodPost, "/v1/books", dune, bob, http.StatusForbidden, "not_permitted"},
+		{"only admins can see permissions", http.MethodGet, "/v1/users/2/permissions", "", bob, http.StatusForbidden, "not_permitted"},
+		{"list", http.MethodGet, "/v1/users/2/permissions", "", admin, http.StatusOK, `"permissions":["books:read"]`},
+		{"grant", http.MethodPost, "/v1/users/2/permissions", `{"permissions": ["books:write"]}`, admin, http.StatusOK, `"permissions":["books:read","books:write"]`},
+		{"grant again", http.MethodPost, "/v1/users/2/permissions", `{"permissions": ["books:write"]}`, admin, http.StatusOK, `"permissions":["books:read","books:write"]`},
+		{"grant a permission that doesn't exist", http.MethodPost, "/v1/users/2/permissions", `{"permissions": ["books:burn"]}`, admin, http.StatusUnprocessableEntity, "books:burn"},
+		{"grant nothing", http.MethodPost, "/v1/users/2/permissions", `{"permissions": []}`, admin, http.StatusUnprocessableEntity, "at least 1"},
+		{"the grant takes effect straight away", http.MethodPost, "/v1/books", dune, bob, http.StatusCreated, ""},
+		{"revoke", http.MethodDelete, "/v1/users/2/permissions/books:write", "", admin, http.StatusOK, `"permissions":["books:read"]`},
+		{"so does the revoke", http.MethodPut, "/v1/books/1", `{"rating": 4}`, bob, http.StatusForbidden, "not_permitted"},
+		{"revoke a permission that doesn't exist", http.MethodDelete, "/v1/users/2/permissions/books:burn", "", admin, http.StatusNotFound, ""},
+		{"a user that doesn't exist", http.MethodGet, "/v1/users/99/permissions", "", admin, http.StatusNotFound, ""},
+		{"not permissions", http.MethodGet, "/v1/users/2/tokens", "", admin, http.StatusNotFound, ""},
+		{"replace the permissions", http.MethodPut, "/v1/users/2/permissions", `{"permissions": ["admin"]}`, admin, http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, step := range steps {
+		headers := map[string]string{}
+		if step.token != "" {
+			headers["Authorization"] = "Bearer " + step.token
+		}
+
+		res, body := do(t, ts, step.method, step.path, step.body, headers)
+		if res.StatusCode != step.status {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, res.StatusCode, step.status, body)
+		}
+		if !strings.Contains(body, step.want) {
+			t.Errorf("%s: the body should contain %s: %s", step.name, step.want, body)
+		}
+	}
+}
+
+func TestShelves(t *testing.T) {
+	mail := make(testMailer, 1)
+	ts := newTestServer(t, func(app *Application) {
+		app.Config.DefaultPermissions = data.Permissions{data.PermissionBooksRead}
+		app.Mailer = mail
+	})
+	do(t, ts, http.MethodPost, "/v1/books", dune, nil)
+	do(t, ts, http.MethodPost, "/v1/books", `{"title": "Emma", "author": "Jane Austen", "published": 1815, "pages": 474, "genres": ["classic"]}`, nil)
+
+	alice := signUp(t, ts, mail, "alice@example.com", true)
+	bob := signUp(t, ts, mail, "bob@example.com", true)
+
+	steps := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		token   string
+		ifMatch string
+		status  int
+		etag    string
+		want    []string //things the body has to contain
+		notWant []string //and things it mustn't
+	}{
+		{"guests don't have shelves", http.MethodGet, "/v1/me/books/1", "", "", "", http.StatusUnauthorized, "", nil, nil},
+		{"not on a shelf yet", http.MethodGet, "/v1/me/books/1", "", alice, "", http.StatusNotFound, "", nil, nil},
+		{"a new entry needs a status", http.MethodPut, "/v1/me/books/1", `{"rating": 4}`, alice, "", http.StatusUnprocessableEntity, "", []string{`"status"`}, nil},
+		{"a new entry can't be expected to exist", http.MethodPut, "/v1/me/books/1", `{"status": "reading"}`, alice, `"1"`, http.StatusPreconditionFailed, "", nil, nil},
+		{"start reading", http.MethodPut, "/v1/me/books/1", `{"status": "reading"}`, alice, "", http.StatusCreated, `"1"`, []string{`"status":"reading"`, `"started_at"`}, []string{`"finished_at"`}},
+		{"finish at a stale version", http.MethodPut, "/v1/me/books/1", `{"status": "read"}`, alice, `"7"`, http.StatusPreconditionFailed, "", nil, nil},
+		{"finish", http.MethodPut, "/v1/me/books/1", `{"status": "read", "rating": 4.5}`, alice, `"1"`, http.StatusOK, `"2"`, []string{`"status":"read"`, `"started_at"`, `"finished_at"`, `"rating":4.5`}, nil},
+		{"finish before starting", http.MethodPut, "/v1/me/books/1", `{"finished_at": "2001-01-01T00:00:00Z"}`, alice, `"2"`, http.StatusUnprocessableEntity, "", []string{"before started_at"}, nil},
+		{"a reason for a finished book", http.MethodPut, "/v1/me/books/1", `{"dnf_reason": "too long"}`, alice, `"2"`, http.StatusUnprocessableEntity, "", []string{`"dnf_reason"`}, nil},
+		{"want to read it again", http.MethodPut, "/v1/me/books/1", `{"status": "want-to-read"}`, alice, `"2"`, http.StatusOK, `"3"`, []string{`"status":"want-to-read"`}, []string{`"started_at"`, `"finished_at"`}},
+		{"give up on another", http.MethodPut, "/v1/me/books/2", `{"status": "did-not-finish", "dnf_reason": "too long"}`, alice, "", http.StatusCreated, `"1"`, []string{`"dnf_reason":"too long"`}, []string{`"finished_at"`}},
+		{"a status that isn't a shelf", http.MethodPut, "/v1/me/books/2", `{"status": "lent out"}`, alice, "", http.StatusUnprocessableEntity, "", []string{`"status"`}, nil},
+		{"a book that isn't in the catalogue", http.MethodPut, "/v1/me/books/99", `{"status": "reading"}`, alice, "", http.StatusNotFound, "", nil, nil},
+		{"get", http.MethodGet, "/v1/me/books/1", "", alice, "", http.StatusOK, `"3"`, []string{`"title":"Dune"`}, nil},
+		{"the shelf", http.MethodGet, "/v1/me/shelves/did-not-finish", "", alice, "", http.StatusOK, "", []string{`"book_id":2`, `"title":"Emma"`, `"total_records":1`}, []string{`"book_id":1`}},
+		{"an empty shelf", http.MethodGet, "/v1/me/shelves/reading", "", alice, "", http.StatusOK, "", []string{`"user_books":[]`}, nil},
+		{"a shelf that doesn't exist", http.MethodGet, "/v1/me/shelves/lent-out", "", alice, "", http.StatusNotFound, "", nil, nil},
+		{"nobody else sees them", http.MethodGet, "/v1/me/books/1", "", bob, "", http.StatusNotFound, "", nil, nil},
+		{"or has them on their shelves", http.MethodGet, "/v1/me/shelves/did-not-finish", "", bob, "", http.StatusOK, "", []string{`"user_books":[]`}, nil},
+		{"take it off at a stale version", http.MethodDelete, "/v1/me/books/1", "", alice, `"2"`, http.StatusPreconditionFailed, "", nil, nil},
+		{"take it off", http.MethodDelete, "/v1/me/books/1", "", alice, `"3"`, http.StatusOK, "", nil, nil},
+		{"it has gone", http.MethodGet, "/v1/me/books/1", "", alice, "", http.StatusNotFound, "", nil, nil},
+	}
+
+	for _, step := range steps {
+		headers := map[string]string{}
+		if step.token != "" {
+			headers["Authorization"] = "Bearer " + step.token
+		}
+		if step.ifMatch != "" {
+			headers["If-Match"] = step.ifMatch
+		}
+
+		res, body := do(t, ts, step.method, step.path, step.body, headers)
+		if res.StatusCode != step.status {
+			t.Fatalf("%s: status = %d, want %d: %s", step.name, res.StatusCode, step.status, body)
+		}
+		if got := res.Header.Get("ETag"); step.etag != "" && got != step.etag {
+			t.Errorf("%s: ETag = %s, want %s", step.name, got, step.etag)
+		}
+		for _, want := range step.want {
+			if !strings.Contains(body, want) {
+				t.Errorf("%s: the body should contain %s: %s", step.name, want, body)
+			}
+		}
+		for _, notWant := range step.notWant {
+			if strings.Contains(body, notWant) {
+				t.Errorf("%s: the body shouldn't contain %s: %s", step.name, notWant, body)
+			}
+		}
+	}
+}
@@ -3,35 +3,21 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"readinglist/internal/data"
+	"readinglist/internal/validator"
 )
 
 // the type below is part of making an envelope for JSON data
 // this envelope type will be used to collect the JSON data within a named object which can make parsing easier
 type envelope map[string]any
 
-// Credit: Alex Edwards, Let's Go Further
-// This was added to replace duplicated code in the handlers so as to observed the DRY principle
-func (app *Application) WriteJSON(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
-	js, err := json.MarshalIndent(data, "", "\t")
-	if err != nil {
-		return err
-	}
-
-	js = append(js, '\n')
-
-	for key, value := range headers {
-		w.Header()[key] = value
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	w.Write(js)
-
-	return nil
-}
-
 // this function replaces having an unmarshall function inside handlers.go
 // it also helps protect the web service by setting a maximum allowed bytes
 // and it disallows unknown fields, meaning you can pass in json fields that aren't part of the struct that is defined on the interface
@@ -43,8 +29,38 @@ func (app *Application) ReadJSON(w http.ResponseWriter, r *http.Request, dst any
 	dec := json.NewDecoder(r.Body)
 	dec.DisallowUnknownFields() //disallows unknown fields
 
+	//the decoder's own errors are hard to read and sometimes mention go types, so they are turned into plain messages for the client
 	if err := dec.Decode(dst); err != nil {
-		return err
+		var syntaxError *json.SyntaxError
+		var unmarshalTypeError *json.UnmarshalTypeError
+		var maxBytesError *http.MaxBytesError
+
+		switch {
+		case errors.As(err, &syntaxError):
+			return fmt.Errorf("body contains badly-formed JSON (at character %d)", syntaxError.Offset)
+
+		case errors.Is(err, io.ErrUnexpectedEOF):
+			return errors.New("body contains badly-formed JSON")
+
+		case errors.As(err, &unmarshalTypeError):
+			if unmarshalTypeError.Field != "" {
+				return fmt.Errorf("body contains incorrect JSON type for field %q", unmarshalTypeError.Field)
+			}
+			return fmt.Errorf("body contains incorrect JSON type (at character %d)", unmarshalTypeError.Offset)
+
+		case errors.Is(err, io.EOF):
+			return errors.New("body must not be empty")
+
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("body contains unknown key %s", fieldName)
+
+		case errors.As(err, &maxBytesError):
+			return fmt.Errorf("body must not be larger than %d bytes", maxBytesError.Limit)
+
+		default:
+			return err
+		}
 	}
 
 	err := dec.Decode(&struct{}{})
@@ -54,3 +70,128 @@ func (app *Application) ReadJSON(w http.ResponseWriter, r *http.Request, dst any
 
 	return nil
 }
+
+// readIDParam gets the book id out of a url like /v1/books/42 or /v1/books/42/restore
+// it only accepts positive whole numbers because that's all an id can be
+func (app *Application) readIDParam(r *http.Request) (int64, error) {
+	idParam, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/books/"), "/")
+
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil || id < 1 {
+		return 0, errors.New("invalid id parameter")
+	}
+
+	return id, nil
+}
+
+// readAction returns whatever comes after the id in a book url, e.g. "restore" for /v1/books/42/restore
+// it is empty for the book itself
+func (app *Application) readAction(r *http.Request) string {
+	_, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/books/"), "/")
+	return action
+}
+
+// the helpers below pull values out of the query string (the part of the url after the ?)
+// each one falls back to the default value when the key isn't there
+
+// readString returns the string value for the key or the default value
+func (app *Application) readString(qs url.Values, key string, defaultValue string) string {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	return s
+}
+
+// readCSV splits a comma-separated value into a slice, e.g. ?genres=fiction,sci-fi
+// empty entries and surrounding spaces are dropped
+func (app *Application) readCSV(qs url.Values, key string, defaultValue []string) []string {
+	csv := qs.Get(key)
+	if csv == "" {
+		return defaultValue
+	}
+
+	values := []string{}
+	for _, value := range strings.Split(csv, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// readInt converts the value for the key to an int
+// if it isn't a number the problem is added to the validator under the key and the default value is returned
+func (app *Application) readInt(qs url.Values, key string, defaultValue int, v *validator.Validator) int {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		v.AddError(key, "must be an integer value")
+		return defaultValue
+	}
+
+	return i
+}
+
+// readFloat converts the value for the key to a float32, which is the type used for ratings
+func (app *Application) readFloat(qs url.Values, key string, defaultValue float32, v *validator.Validator) float32 {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	f, err := strconv.ParseFloat(s, 32)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return defaultValue
+	}
+
+	return float32(f)
+}
+
+// readBool converts the value for the key to a bool; true, false, 1 and 0 are all accepted
+func (app *Application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be true or false")
+		return defaultValue
+	}
+
+	return b
+}
+
+// bookETag turns the version of a book into a strong ETag, e.g. "3"
+// the version goes up on every update so the ETag changes whenever the book does
+func bookETag(book *data.Book) string {
+	return fmt.Sprintf(`"%d"`, book.Version)
+}
+
+// ifMatch reports whether the If-Match header allows a change to a resource with the given ETag
+// a request without the header always matches, * matches any existing resource,
+// and weak ETags (W/"...") never match because If-Match uses the strong comparison
+func ifMatch(r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+
+	return false
+}
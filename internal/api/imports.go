@@ -0,0 +1,281 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"readinglist/internal/data"
+	"readinglist/internal/goodreads"
+	"readinglist/internal/isbn"
+	"readinglist/internal/marc"
+	"readinglist/internal/validator"
+)
+
+// maxImportBytes is the largest file that can be uploaded for an import
+// a Goodreads export with a few thousand books and reviews is still only a couple of megabytes
+const maxImportBytes = 10 << 20
+
+// importRecord is a book read from an uploaded file, along with where it came from
+// it doesn't depend on the file format, so every importer can hand its books to importBooks
+type importRecord struct {
+	Row    int               //the line or record number in the file
+	Book   *data.Book        //the book as it would be saved
+	ISBNs  []string          //every ISBN the file had for the book, used to spot duplicates
+	Errors map[string]string //problems reading the row, the row isn't imported if there are any
+}
+
+// importResult says what happened to one row
+// status is created, skipped (the book is already in the library) or error
+type importResult struct {
+	Row    int               `json:"row"`
+	Status string            `json:"status"`
+	ID     int64             `json:"id,omitempty"`
+	Title  string            `json:"title,omitempty"`
+	Reason string            `json:"reason,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+// importGoodreadsHandler imports the CSV export from Goodreads, uploaded as multipart/form-data in a field named file
+// with ?dry_run=true nothing is saved, but the response says what would have happened
+func (app *Application) importGoodreadsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	dryRun, ok := app.readDryRun(w, r)
+	if !ok {
+		return
+	}
+
+	file, ok := app.readUpload(w, r)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	rows, err := goodreads.Parse(file)
+	if err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	records := make([]*importRecord, len(rows))
+	for i, row := range rows {
+		records[i] = &importRecord{Row: row.Line, Book: row.Book, ISBNs: row.ISBNs, Errors: row.Errors}
+	}
+
+	app.importBooks(w, r, records, dryRun)
+}
+
+// importMARCHandler imports MARC 21 records, uploaded as multipart/form-data in a field named file
+// the file can be binary ISO 2709 (.mrc) or MARCXML, which is told apart by the XML starting with a <
+// the row of each result is the record's position in the file, starting from 1
+func (app *Application) importMARCHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	dryRun, ok := app.readDryRun(w, r)
+	if !ok {
+		return
+	}
+
+	file, ok := app.readUpload(w, r)
+	if !ok {
+		return
+	}
+	defer file.Close()
+
+	buffered := bufio.NewReader(file)
+
+	//an ISO 2709 record starts with the five digits of its length, so anything starting with a < (after any byte order mark or spaces) is MARCXML
+	var reader interface{ Read() (*marc.Record, error) } = marc.NewReader(buffered)
+
+	start, _ := buffered.Peek(512)
+	start = bytes.TrimLeft(bytes.TrimPrefix(start, []byte("\ufeff")), " \t\r\n")
+	if bytes.HasPrefix(start, []byte("<")) {
+		reader = marc.NewXMLReader(buffered)
+	}
+
+	var records []*importRecord
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		//a broken record is reported on its row and the rest of the file is still imported
+		var recordError *marc.RecordError
+		if errors.As(err, &recordError) {
+			records = append(records, &importRecord{Row: row, Book: &data.Book{}, Errors: map[string]string{"record": recordError.Error()}})
+			continue
+		}
+		if err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+
+		book, isbns, problems := marc.ToBook(record)
+		records = append(records, &importRecord{Row: row, Book: book, ISBNs: isbns, Errors: problems})
+	}
+
+	if len(records) == 0 {
+		app.badRequest(w, r, errors.New("the file does not have any MARC records in it"))
+		return
+	}
+
+	app.importBooks(w, r, records, dryRun)
+}
+
+// readDryRun reads the dry_run query string value; when it returns false the error response has already been sent
+func (app *Application) readDryRun(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	v := validator.New()
+
+	dryRun := app.readBool(r.URL.Query(), "dry_run", false, v)
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return false, false
+	}
+
+	return dryRun, true
+}
+
+// readUpload returns the file uploaded in the file field of a multipart/form-data request
+// when it returns false the error response has already been sent
+func (app *Application) readUpload(w http.ResponseWriter, r *http.Request) (multipart.File, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+
+	//anything over 1MB is kept in temporary files instead of memory until the request is finished
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			app.badRequest(w, r, fmt.Errorf("the upload must not be larger than %d bytes", maxBytesError.Limit))
+			return nil, false
+		}
+
+		app.badRequest(w, r, errors.New("the body must be multipart/form-data with the file in a field named file"))
+		return nil, false
+	}
+
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		app.badRequest(w, r, errors.New("the body must be multipart/form-data with the file in a field named file"))
+		return nil, false
+	}
+
+	return file, true
+}
+
+// importBooks saves the records that are valid and not already in the library, and writes the per-row results
+// a book counts as already in the library when one of its ISBNs matches a book that is, or an earlier row of the same file
+// each book is saved on its own, so one bad row doesn't stop the rest of the import
+func (app *Application) importBooks(w http.ResponseWriter, r *http.Request, records []*importRecord, dryRun bool) {
+	results := []*importResult{}
+	summary := map[string]int{"created": 0, "skipped": 0, "errored": 0}
+
+	seen := map[string]int{} //ISBN-13 => the row it was first seen on
+
+	for _, record := range records {
+		result := &importResult{Row: record.Row, Title: record.Book.Title}
+		results = append(results, result)
+
+		if len(record.Errors) == 0 {
+			v := validator.New()
+			if data.ValidateBook(v, record.Book); !v.Valid() {
+				record.Errors = v.Errors
+			}
+		}
+
+		if len(record.Errors) > 0 {
+			result.Status = "error"
+			result.Errors = record.Errors
+			summary["errored"]++
+			continue
+		}
+
+		reason, err := app.findImportDuplicate(r, record, seen)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if reason != "" {
+			result.Status = "skipped"
+			result.Reason = reason
+			summary["skipped"]++
+			continue
+		}
+
+		if !dryRun {
+			err := app.Models.Books.Insert(r.Context(), record.Book)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrDuplicate):
+					result.Status = "skipped"
+					result.Reason = "a book with the same ISBN is already in the library"
+					summary["skipped"]++
+				default:
+					app.logError(r, err)
+					result.Status = "error"
+					result.Reason = "the book could not be saved"
+					summary["errored"]++
+				}
+				continue
+			}
+
+			result.ID = record.Book.ID
+		}
+
+		result.Status = "created"
+		summary["created"]++
+	}
+
+	env := envelope{"dry_run": dryRun, "summary": summary, "rows": results}
+
+	if err := app.WriteResponse(w, r, http.StatusOK, env, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// findImportDuplicate returns why the record is a duplicate, or "" if it isn't one
+// the record's ISBNs are added to seen either way, so later rows of the same file are checked against all of them
+func (app *Application) findImportDuplicate(r *http.Request, record *importRecord, seen map[string]int) (string, error) {
+	for _, number := range record.ISBNs {
+		if row, ok := seen[importISBNKey(number)]; ok {
+			return fmt.Sprintf("same ISBN as row %d", row), nil
+		}
+	}
+
+	for _, number := range record.ISBNs {
+		seen[importISBNKey(number)] = record.Row
+	}
+
+	for _, number := range record.ISBNs {
+		book, err := app.Models.Books.GetByISBN(r.Context(), number)
+		switch {
+		case err == nil:
+			return fmt.Sprintf("already in the library as book %d", book.ID), nil
+		case !errors.Is(err, data.ErrRecordNotFound):
+			return "", err
+		}
+	}
+
+	return "", nil
+}
+
+// importISBNKey is what the ISBNs of a file are compared by, the ISBN-13 so the ISBN-10 and ISBN-13 of the same book match
+// an ISBN that isn't valid can't be turned into one, so it is compared as it was written, less any hyphens
+func importISBNKey(number string) string {
+	if canonical, err := isbn.To13(number); err == nil {
+		return canonical
+	}
+	return isbn.Normalize(number)
+}
@@ -0,0 +1,258 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"readinglist/internal/data"
+	"readinglist/internal/opds"
+	"readinglist/internal/validator"
+)
+
+// opdsPageSize is how many books go in one page of an acquisition feed
+const opdsPageSize = 50
+
+// opdsHandler serves the OPDS catalog for e-reader apps:
+//
+//	/opds                 the root navigation feed
+//	/opds/books           every book, by title
+//	/opds/recent          the most recently added books first
+//	/opds/genres          a navigation feed with one entry per genre
+//	/opds/genres/{genre}  the books with that genre
+//	/opds/search?q=       a title and author search, described by /opds/opensearch.xml
+//
+// the acquisition feeds are split into pages with ?page=, linked together with next and previous links
+func (app *Application) opdsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	//the escaped path is split so a genre with a / in it (sent as %2F) stays in one piece
+	path := strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), "/opds"), "/")
+
+	switch {
+	case path == "":
+		app.opdsRoot(w, r)
+
+	case path == "books":
+		app.opdsBooks(w, r, "urn:readinglist:opds:books", "All books", "title", nil)
+
+	case path == "recent":
+		app.opdsBooks(w, r, "urn:readinglist:opds:recent", "Recently added", "-created_at", nil)
+
+	case path == "genres":
+		app.opdsGenres(w, r)
+
+	case strings.HasPrefix(path, "genres/") && !strings.Contains(strings.TrimPrefix(path, "genres/"), "/"):
+		genre, err := url.PathUnescape(strings.TrimPrefix(path, "genres/"))
+		if err != nil || genre == "" {
+			app.notFound(w, r)
+			return
+		}
+		app.opdsBooks(w, r, "urn:readinglist:opds:genre:"+url.PathEscape(genre), genre, "title", []string{genre})
+
+	case path == "search":
+		app.opdsSearch(w, r)
+
+	case path == "opensearch.xml":
+		description := opds.NewOpenSearchDescription(requestBaseURL(r) + "/opds/search?q={searchTerms}")
+		app.writeOPDS(w, r, opds.OpenSearchType, description)
+
+	default:
+		app.notFound(w, r)
+	}
+}
+
+// opdsRoot is the feed an e-reader opens first, it links to everything else
+func (app *Application) opdsRoot(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	feed := opds.NewFeed("urn:readinglist:opds:root", "Reading list", now)
+	feed.Links = opdsLinks("/opds", opds.NavigationType)
+
+	feed.Entries = []opds.Entry{
+		opds.NavigationEntry("urn:readinglist:opds:books", "All books", "Every book on the reading list, by title", "/opds/books", opds.AcquisitionType, now),
+		opds.NavigationEntry("urn:readinglist:opds:recent", "Recently added", "The newest books first", "/opds/recent", opds.AcquisitionType, now),
+		opds.NavigationEntry("urn:readinglist:opds:genres", "Genres", "Browse the books by genre", "/opds/genres", opds.NavigationType, now),
+	}
+	feed.Entries[1].Links[0].Rel = opds.RelSortNew
+
+	app.writeOPDS(w, r, opds.NavigationType, feed)
+}
+
+// opdsGenres lists the genres, each entry says how many books are in it
+func (app *Application) opdsGenres(w http.ResponseWriter, r *http.Request) {
+	genres, err := app.Models.Books.Genres(r.Context())
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+
+	feed := opds.NewFeed("urn:readinglist:opds:genres", "Genres", now)
+	feed.Links = opdsLinks("/opds/genres", opds.NavigationType)
+
+	for _, genre := range genres {
+		href := "/opds/genres/" + url.PathEscape(genre.Name)
+
+		entry := opds.NavigationEntry("urn:readinglist:opds:genre:"+url.PathEscape(genre.Name), genre.Name, pluralBooks(genre.Books), href, opds.AcquisitionType, now)
+		entry.Links[0].Count = genre.Books
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	app.writeOPDS(w, r, opds.NavigationType, feed)
+}
+
+// opdsBooks writes a page of an acquisition feed of the books with all of the genres, sorted by sort
+func (app *Application) opdsBooks(w http.ResponseWriter, r *http.Request, id, title, sort string, genres []string) {
+	v := validator.New()
+
+	filters := data.BookFilters{Genres: genres, GenresMatch: "all"}
+	filters.Page = app.readInt(r.URL.Query(), "page", 1, v)
+	filters.PageSize = opdsPageSize
+	filters.Sort = sort
+	filters.SortSafelist = []string{sort}
+
+	if data.ValidateBookFilters(v, filters); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	books, metadata, err := app.Models.Books.GetAll(r.Context(), filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	//a genre that no book has (any more) is a feed that doesn't exist rather than an empty one
+	if len(genres) > 0 && metadata.TotalRecords == 0 {
+		app.notFound(w, r)
+		return
+	}
+
+	app.writeAcquisitionFeed(w, r, id, title, books, metadata)
+}
+
+// opdsSearch is the search the OpenSearch description points to, the results are an acquisition feed
+func (app *Application) opdsSearch(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	q := app.readString(qs, "q", "")
+	v.Check(strings.TrimSpace(q) != "", "q", "must be provided")
+
+	var filters data.Filters
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = opdsPageSize
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	results, metadata, err := app.Models.Books.Search(r.Context(), q, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	books := make([]*data.Book, len(results))
+	for i, result := range results {
+		books[i] = result.Book
+	}
+
+	app.writeAcquisitionFeed(w, r, "urn:readinglist:opds:search:"+url.QueryEscape(q), "Search: "+q, books, metadata)
+}
+
+// writeAcquisitionFeed writes the books as a feed with the paging links worked out from the metadata
+// the feed counts as updated when the newest book in it was added
+func (app *Application) writeAcquisitionFeed(w http.ResponseWriter, r *http.Request, id, title string, books []*data.Book, metadata data.Metadata) {
+	updated := time.Time{}
+	for _, book := range books {
+		if book.CreatedAt.After(updated) {
+			updated = book.CreatedAt
+		}
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	feed := opds.NewFeed(id, title, updated)
+	feed.Links = opdsLinks(r.URL.RequestURI(), opds.AcquisitionType)
+	feed.TotalResults = metadata.TotalRecords
+	feed.ItemsPerPage = metadata.PageSize
+
+	page := func(n int) string {
+		qs := r.URL.Query()
+		qs.Set("page", strconv.Itoa(n))
+		return r.URL.EscapedPath() + "?" + qs.Encode()
+	}
+
+	if metadata.CurrentPage > 1 {
+		feed.Links = append(feed.Links,
+			opds.Link{Rel: "first", Href: page(1), Type: opds.AcquisitionType},
+			opds.Link{Rel: "previous", Href: page(metadata.CurrentPage - 1), Type: opds.AcquisitionType},
+		)
+	}
+	if metadata.CurrentPage < metadata.LastPage {
+		feed.Links = append(feed.Links,
+			opds.Link{Rel: "next", Href: page(metadata.CurrentPage + 1), Type: opds.AcquisitionType},
+			opds.Link{Rel: "last", Href: page(metadata.LastPage), Type: opds.AcquisitionType},
+		)
+	}
+
+	for _, book := range books {
+		feed.Entries = append(feed.Entries, opds.BookEntry(book))
+	}
+
+	app.writeOPDS(w, r, opds.AcquisitionType, feed)
+}
+
+// opdsLinks are the links every feed has: itself, the root of the catalog and the search
+func opdsLinks(self, selfType string) []opds.Link {
+	return []opds.Link{
+		{Rel: "self", Href: self, Type: selfType},
+		{Rel: "start", Href: "/opds", Type: opds.NavigationType},
+		{Rel: "search", Href: "/opds/opensearch.xml", Type: opds.OpenSearchType},
+	}
+}
+
+// writeOPDS writes a feed or the OpenSearch description; it is buffered so an error can still get a proper error response
+func (app *Application) writeOPDS(w http.ResponseWriter, r *http.Request, contentType string, v any) {
+	var buf bytes.Buffer
+
+	if err := opds.Write(&buf, v); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// requestBaseURL is the scheme and host the request was sent to, e.g. http://localhost:3000
+// X-Forwarded-Proto is trusted so the urls are right behind a proxy that terminates TLS
+// the client picks these headers, so this is only for links in the response it gets back and never for emails (see Config.APIURL)
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return scheme + "://" + r.Host
+}
+
+func pluralBooks(n int) string {
+	if n == 1 {
+		return "1 book"
+	}
+	return strconv.Itoa(n) + " books"
+}
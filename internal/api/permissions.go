@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"readinglist/internal/data"
+	"readinglist/internal/validator"
+)
+
+// userPermissionsHandler serves the admin-only routes for a user's permissions
+//
+//	GET    /v1/users/{id}/permissions          lists them
+//	POST   /v1/users/{id}/permissions          grants the ones in {"permissions": ["books:write", ...]}
+//	DELETE /v1/users/{id}/permissions/{code}   revokes one
+//
+// all three respond with the permissions the user has afterwards
+func (app *Application) userPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.Path, "/v1/users/")
+
+	idParam, rest, _ := strings.Cut(rest, "/")
+	resource, code, hasCode := strings.Cut(rest, "/")
+
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil || id < 1 || resource != "permissions" {
+		app.notFound(w, r)
+		return
+	}
+
+	user, err := app.Models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	switch {
+	case !hasCode && (r.Method == http.MethodGet || r.Method == http.MethodHead):
+		//nothing to change, the list is written below
+
+	case !hasCode && r.Method == http.MethodPost:
+		var input struct {
+			Permissions []string `json:"permissions"`
+		}
+
+		if err := app.ReadJSON(w, r, &input); err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+
+		v := validator.New()
+
+		v.Check(len(input.Permissions) > 0, "permissions", "must contain at least 1 permission")
+		for _, code := range input.Permissions {
+			v.Check(data.ValidPermission(code), "permissions", fmt.Sprintf("%q is not a permission, it must be one of %s", code, strings.Join(data.PermissionCodes, ", ")))
+		}
+
+		if !v.Valid() {
+			app.failedValidation(w, r, v.Errors)
+			return
+		}
+
+		if err := app.Models.Permissions.AddForUser(r.Context(), user.ID, input.Permissions...); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+	case hasCode && r.Method == http.MethodDelete:
+		if !data.ValidPermission(code) {
+			app.notFound(w, r)
+			return
+		}
+
+		if err := app.Models.Permissions.RemoveForUser(r.Context(), user.ID, code); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+	default:
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	permissions, err := app.Models.Permissions.GetAllForUser(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"user": user, "permissions": permissions}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
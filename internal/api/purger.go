@@ -0,0 +1,34 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// RunTrashPurger permanently deletes the books that have been in the trash for longer than Config.TrashRetention
+// it purges once straight away and then every Config.TrashPurgeInterval until ctx is cancelled, so it is meant to be run in its own goroutine
+// a failed purge is only logged; the books are still there and the next run will try again
+func (app *Application) RunTrashPurger(ctx context.Context) {
+	if app.Config.TrashRetention <= 0 {
+		app.Logger.Printf("the trash purger is off, deleted books are kept until they are deleted permanently")
+		return
+	}
+
+	ticker := time.NewTicker(app.Config.TrashPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := app.Models.Books.PurgeTrash(ctx, time.Now().Add(-app.Config.TrashRetention))
+		if err != nil {
+			app.Logger.Printf("error: purging the trash: %v", err)
+		} else if purged > 0 {
+			app.Logger.Printf("purged %d books from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
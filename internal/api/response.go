@@ -0,0 +1,561 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// the formats a response can be written in, along with the content type each one is sent with
+// csv only works for responses with a list in them (GET /v1/books, search, history...), a single book has no rows to write
+var responseContentTypes = map[string]string{
+	"json": "application/json",
+	"xml":  "application/xml; charset=utf-8",
+	"yaml": "application/yaml",
+	"csv":  "text/csv; charset=utf-8",
+}
+
+// acceptedMediaTypes maps the media types a client can put in its Accept header onto the formats above
+// a wildcard is treated as a request for json, because that is what the api has always sent
+var acceptedMediaTypes = map[string][]string{
+	"*/*":                {"json"},
+	"application/*":      {"json"},
+	"application/json":   {"json"},
+	"application/xml":    {"xml"},
+	"text/xml":           {"xml"},
+	"application/yaml":   {"yaml"},
+	"application/x-yaml": {"yaml"},
+	"text/yaml":          {"yaml"},
+	"text/x-yaml":        {"yaml"},
+	"text/csv":           {"csv"},
+	"text/*":             {"csv", "xml"},
+}
+
+// formatsContextKey is where negotiate keeps the formats the client will take, best first
+const formatsContextKey = contextKey("formats")
+
+type contextKey string
+
+// negotiate works out which formats the client will take from ?format= or, when that isn't set, the Accept header
+// it runs before the handler, so a client that can't take any of them gets a 406 before anything has been changed
+// the endpoints in writesOwnFormat are left alone, their parameters pick the format of the body rather than negotiate
+func (app *Application) negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if writesOwnFormat(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		formats := acceptableFormats(r)
+		if len(formats) == 0 {
+			app.notAcceptable(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept")
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), formatsContextKey, formats)))
+	})
+}
+
+// writesOwnFormat is true for the endpoints that send files in formats of their own: the export, the citations, the OPDS catalog and the feeds
+// their errors still go through WriteResponse, which sends them as json
+func writesOwnFormat(path string) bool {
+	if path == "/v1/books/export" || path == "/v1/books/citation" || path == "/opds" {
+		return true
+	}
+
+	if strings.HasPrefix(path, "/opds/") || strings.HasPrefix(path, "/feeds/") {
+		return true
+	}
+
+	return strings.HasPrefix(path, "/v1/books/") && strings.HasSuffix(path, "/citation")
+}
+
+// acceptableFormats returns the formats the client will take, best first
+// no Accept header at all means the client will take anything, so it gets json
+func acceptableFormats(r *http.Request) []string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := responseContentTypes[format]; ok {
+			return []string{format}
+		}
+		return nil
+	}
+
+	header := strings.Join(r.Header.Values("Accept"), ",")
+	if strings.TrimSpace(header) == "" {
+		return []string{"json"}
+	}
+
+	type mediaRange struct {
+		formats []string
+		q       float64
+	}
+
+	var ranges []mediaRange
+
+	for _, part := range strings.Split(header, ",") {
+		mediaType, params, _ := strings.Cut(part, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+
+		formats, ok := acceptedMediaTypes[mediaType]
+		if !ok {
+			continue
+		}
+
+		//q is how much the client wants this type, from 0 to 1; 0 means it doesn't want it at all
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, value, _ := strings.Cut(param, "=")
+			if strings.TrimSpace(name) == "q" {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		if q > 0 {
+			ranges = append(ranges, mediaRange{formats: formats, q: q})
+		}
+	}
+
+	//the order they were sent in decides between types with the same q
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+
+	var formats []string
+	for _, mediaRange := range ranges {
+		for _, format := range mediaRange.formats {
+			if !slices.Contains(formats, format) {
+				formats = append(formats, format)
+			}
+		}
+	}
+
+	return formats
+}
+
+// WriteResponse writes data in the best format the client will take
+// json is compact unless the request has ?pretty=true, which indents it (and xml) to make it easier to read
+// if the only formats the client will take can't hold this response (csv for a single book), it gets a 406,
+// unless the response is already an error, in which case it is sent as json because the error matters more than the format
+func (app *Application) WriteResponse(w http.ResponseWriter, r *http.Request, status int, data envelope, headers http.Header) error {
+	formats, _ := r.Context().Value(formatsContextKey).([]string)
+	if len(formats) == 0 {
+		formats = []string{"json"}
+	}
+
+	//the envelope is turned into an ordered tree through json first so every format uses the same field names as the json
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	var tree any
+
+	format := ""
+	for _, f := range formats {
+		if f != "csv" {
+			format = f
+			break
+		}
+
+		if tree == nil {
+			if tree, err = decodeOrdered(js); err != nil {
+				return err
+			}
+		}
+		if _, ok := collection(tree); ok {
+			format = f
+			break
+		}
+	}
+
+	if format == "" {
+		if status < http.StatusBadRequest {
+			app.notAcceptable(w, r)
+			return nil
+		}
+		format = "json"
+	}
+
+	pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty"))
+
+	var body []byte
+
+	switch format {
+	case "json":
+		body = js
+		if pretty {
+			var indented bytes.Buffer
+			if err := json.Indent(&indented, js, "", "\t"); err != nil {
+				return err
+			}
+			body = indented.Bytes()
+		}
+		body = append(body, '\n')
+
+	default:
+		if tree == nil {
+			if tree, err = decodeOrdered(js); err != nil {
+				return err
+			}
+		}
+
+		switch format {
+		case "xml":
+			body, err = encodeXML(tree, pretty)
+		case "yaml":
+			body, err = encodeYAML(tree)
+		case "csv":
+			rows, _ := collection(tree)
+			body, err = encodeCSV(rows)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	for key, value := range headers {
+		w.Header()[key] = value
+	}
+
+	w.Header().Set("Content-Type", responseContentTypes[format])
+	w.WriteHeader(status)
+	w.Write(body)
+
+	return nil
+}
+
+// object is a json object with its keys kept in the order they were written in
+// a map would lose the order, and a book reading id, title, author... is nicer than one sorted alphabetically
+type object []field
+
+type field struct {
+	key   string
+	value any
+}
+
+// decodeOrdered decodes json into objects, []any, strings, json.Numbers, bools and nils
+func decodeOrdered(js []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.UseNumber()
+
+	return decodeValue(dec)
+}
+
+func decodeValue(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		obj := object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+
+			obj = append(obj, field{key: key.(string), value: value})
+		}
+		_, err := dec.Token() //the closing }
+		return obj, err
+
+	case json.Delim('['):
+		list := []any{}
+		for dec.More() {
+			value, err := decodeValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token() //the closing ]
+		return list, err
+	}
+
+	return token, nil
+}
+
+// collection returns the list in an envelope, e.g. the books in {"books": [...], "metadata": {...}}
+// an envelope with no list, or more than one, isn't a collection
+func collection(tree any) ([]any, bool) {
+	obj, ok := tree.(object)
+	if !ok {
+		return nil, false
+	}
+
+	var rows []any
+	found := 0
+
+	for _, f := range obj {
+		if list, ok := f.value.([]any); ok {
+			rows = list
+			found++
+		}
+	}
+
+	return rows, found == 1
+}
+
+// encodeCSV writes one row per item with a column for every field any of the items has
+// nested objects are flattened into columns like book.title, lists of plain values are joined with semicolons
+// anything else that doesn't fit in a cell (a list of objects) is written as json
+// the rest of the envelope, e.g. the paging metadata, has nowhere to go in a csv file and is left out
+func encodeCSV(rows []any) ([]byte, error) {
+	var columns []string
+	seen := map[string]bool{}
+
+	cells := make([]map[string]string, len(rows))
+
+	for i, row := range rows {
+		cells[i] = map[string]string{}
+
+		flattenCSV("", row, func(column, value string) {
+			if !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+			cells[i][column] = value
+		})
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+
+	//an empty list has no fields to make columns from, so the body is empty
+	if len(columns) > 0 {
+		writer.Write(columns)
+	}
+
+	for _, row := range cells {
+		record := make([]string, len(columns))
+		for i, column := range columns {
+			record[i] = row[column]
+		}
+		writer.Write(record)
+	}
+
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
+
+func flattenCSV(column string, value any, set func(column, value string)) {
+	switch v := value.(type) {
+	case object:
+		for _, f := range v {
+			name := f.key
+			if column != "" {
+				name = column + "." + f.key
+			}
+			flattenCSV(name, f.value, set)
+		}
+		return
+	}
+
+	if column == "" {
+		column = "value" //a list of plain values, e.g. ["a", "b"], gets a single column
+	}
+
+	list, ok := value.([]any)
+	if !ok {
+		set(column, scalarString(value))
+		return
+	}
+
+	values := make([]string, 0, len(list))
+	for _, item := range list {
+		switch item.(type) {
+		case object, []any:
+			js, _ := json.Marshal(plain(list))
+			set(column, string(js))
+			return
+		}
+		values = append(values, scalarString(item))
+	}
+	set(column, strings.Join(values, ";"))
+}
+
+// scalarString formats a string, number, bool or null for a csv cell or an xml element
+func scalarString(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// plain turns the ordered tree back into maps so it can be marshalled to json again
+func plain(value any) any {
+	switch v := value.(type) {
+	case object:
+		m := make(map[string]any, len(v))
+		for _, f := range v {
+			m[f.key] = plain(f.value)
+		}
+		return m
+	case []any:
+		list := make([]any, len(v))
+		for i, item := range v {
+			list[i] = plain(item)
+		}
+		return list
+	}
+	return value
+}
+
+// encodeXML writes the tree inside a <response> element
+// object fields become elements named after their keys and every item of a list becomes an <item> element,
+// so {"book": {"genres": ["sci-fi"]}} is <response><book><genres><item>sci-fi</item></genres></book></response>
+// keys that can't be element names (the errors map can have any field name in it) are written as <field name="...">
+func encodeXML(tree any, pretty bool) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	if pretty {
+		enc.Indent("", "\t")
+	}
+
+	if err := writeXML(enc, xml.StartElement{Name: xml.Name{Local: "response"}}, tree); err != nil {
+		return nil, err
+	}
+
+	if err := enc.Flush(); err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func writeXML(enc *xml.Encoder, start xml.StartElement, value any) error {
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case object:
+		for _, f := range v {
+			child := xml.StartElement{Name: xml.Name{Local: f.key}}
+			if !validXMLName(f.key) {
+				child = xml.StartElement{
+					Name: xml.Name{Local: "field"},
+					Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: f.key}},
+				}
+			}
+
+			if err := writeXML(enc, child, f.value); err != nil {
+				return err
+			}
+		}
+
+	case []any:
+		for _, item := range v {
+			if err := writeXML(enc, xml.StartElement{Name: xml.Name{Local: "item"}}, item); err != nil {
+				return err
+			}
+		}
+
+	default:
+		if err := enc.EncodeToken(xml.CharData(scalarString(v))); err != nil {
+			return err
+		}
+	}
+
+	return enc.EncodeToken(start.End())
+}
+
+// validXMLName is a simpler version of the rules for element names: a letter or underscore, then letters, digits, _, - and .
+// names starting with xml are reserved, so they don't count either
+func validXMLName(name string) bool {
+	if name == "" || strings.HasPrefix(strings.ToLower(name), "xml") {
+		return false
+	}
+
+	for i, r := range name {
+		switch {
+		case unicode.IsLetter(r) || r == '_':
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// encodeYAML writes the tree as a yaml document
+// it goes through yaml.Node rather than marshalling the envelope directly, because yaml.v3 ignores the json struct tags
+func encodeYAML(tree any) ([]byte, error) {
+	var buf bytes.Buffer
+
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+
+	if err := enc.Encode(yamlNode(tree)); err != nil {
+		return nil, err
+	}
+
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func yamlNode(value any) *yaml.Node {
+	switch v := value.(type) {
+	case object:
+		node := &yaml.Node{Kind: yaml.MappingNode}
+		for _, f := range v {
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.key}, yamlNode(f.value))
+		}
+		return node
+
+	case []any:
+		node := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range v {
+			node.Content = append(node.Content, yamlNode(item))
+		}
+		return node
+
+	case string:
+		//the tag stops strings like "true" or "1965" from being read back as a bool or a number
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v}
+
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: v.String()}
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: v.String()}
+
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(v)}
+	}
+
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+}
@@ -1,19 +1,60 @@
 package api
 
-import "net/http"
+import (
+	"net/http"
+
+	"readinglist/internal/data"
+)
 
 // This instantiates all of the routes
 // this is a method tied to application (it takes in app, defined in main.go as an instance of the struct type application) that returns a new ServeMux
 func (app *Application) Route() http.Handler {
 	mux := http.NewServeMux()
+	mux.HandleFunc("/", app.notFound) // anything that doesn't match a route below gets a json 404 instead of the default plain text one
+
 	mux.HandleFunc("/v1/healthcheck", app.healthcheck) // this is an route
 	// Endpoints are functions available through the API
 	// A route is the name you use to access endpoints, used in the URL
 
-	mux.HandleFunc("/v1/books", app.getCreateBooksHandler) // Gets all books with the GET method, Creates new book with the POST method
+	//reading the books needs the books:read permission and changing them books:write (see requirePermission in auth.go)
+	//guests get books:read without signing in unless the server was started with a different -anonymous-permissions
+	mux.HandleFunc("/v1/books", app.requireBooksPermission(app.getCreateBooksHandler)) // Gets all books with the GET method, Creates new book with the POST method
 	//1st arg is the route; 2nd arg is the handler function (endpoint)
 
-	mux.HandleFunc("/v1/books/", app.getUpdateDeleteBooksHandler) // Handles queries related to individual books
+	mux.HandleFunc("/v1/books/search", app.requirePermission(data.PermissionBooksRead, app.searchBooksHandler)) // Full-text search across the books; this is matched before /v1/books/ because it is the longer pattern
+
+	mux.HandleFunc("/v1/books/batch", app.requireBooksPermission(app.batchBooksHandler)) // Creates, updates and deletes many books in one request
+
+	mux.HandleFunc("/v1/books/export", app.requirePermission(data.PermissionBooksRead, app.exportBooksHandler)) // Downloads the books as json, jsonl or csv
+
+	mux.HandleFunc("/v1/books/citation", app.requirePermission(data.PermissionBooksRead, app.citationsHandler)) // Citations for a list of books in BibTeX, RIS or CSL-JSON
+
+	mux.HandleFunc("/v1/books/trash", app.requirePermission(data.PermissionBooksRead, app.trashHandler)) // Lists the books that have been deleted but not purged yet
+
+	mux.HandleFunc("/v1/books/isbn/", app.requirePermission(data.PermissionBooksRead, app.getBookByISBNHandler)) // Finds a book by its ISBN-10 or ISBN-13, with or without hyphens
+
+	mux.HandleFunc("/v1/books/", app.requireBooksPermission(app.getUpdateDeleteBooksHandler)) // Handles queries related to individual books
+
+	mux.HandleFunc("/v1/imports/goodreads", app.requirePermission(data.PermissionBooksWrite, app.importGoodreadsHandler)) // Imports the CSV export from Goodreads
+
+	mux.HandleFunc("/v1/imports/marc", app.requirePermission(data.PermissionBooksWrite, app.importMARCHandler)) // Imports MARC 21 records, binary or MARCXML
+
+	mux.HandleFunc("/v1/users", app.registerUserHandler)           // Signs a new user up and emails them an activation token
+	mux.HandleFunc("/v1/users/activated", app.activateUserHandler) // Activates the account with the token from the email
+
+	mux.HandleFunc("/v1/users/", app.requirePermission(data.PermissionAdmin, app.userPermissionsHandler)) // Admins list, grant and revoke a user's permissions: /v1/users/{id}/permissions
+
+	mux.HandleFunc("/v1/tokens/authentication", app.createAuthenticationTokenHandler)                 // Signs in: swaps an email and password for a bearer token
+	mux.HandleFunc("/v1/tokens/current", app.requireAuthenticatedUser(app.deleteCurrentTokenHandler)) // Signs out: revokes the token the request was sent with
+
+	//the signed in user's own shelves; they need an account even when guests can read the catalogue
+	mux.HandleFunc("/v1/me/books/", app.requireActivatedUser(app.requirePermission(data.PermissionBooksRead, app.meBookHandler)))  // Where a book is on the user's shelves (/v1/me/books/{id}), their reading sessions with it (.../sessions) and their progress (.../progress)
+	mux.HandleFunc("/v1/me/shelves/", app.requireActivatedUser(app.requirePermission(data.PermissionBooksRead, app.shelfHandler))) // One shelf: /v1/me/shelves/want-to-read, reading, read or did-not-finish
+
+	mux.HandleFunc("/feeds/", app.requirePermission(data.PermissionBooksRead, app.feedsHandler)) // Atom and RSS feeds of the newest books: /feeds/books.atom and /feeds/books.rss
+
+	mux.HandleFunc("/opds", app.requirePermission(data.PermissionBooksRead, app.opdsHandler)) // The OPDS catalog e-reader apps browse, see opds.go for the feeds under it
+	mux.HandleFunc("/opds/", app.requirePermission(data.PermissionBooksRead, app.opdsHandler))
 
-	return corsMiddleware(mux) //This returns the mux and all the handlers associated with it
+	return corsMiddleware(app.negotiate(app.authenticate(recordActor(mux)))) //This returns the mux and all the handlers associated with it
 }
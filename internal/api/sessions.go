@@ -0,0 +1,314 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"readinglist/internal/data"
+	"readinglist/internal/validator"
+)
+
+// sessionETag is the ETag of a reading session, the same idea as bookETag
+func sessionETag(s *data.ReadingSession) string {
+	return fmt.Sprintf(`"%d"`, s.Version)
+}
+
+// sessionInput is the json for creating and changing a session
+// where the reader started and stopped can be given as pages or as a percentage of the book (for e-readers that only show one),
+// a percentage is turned into a page using the book's page count, so only pages are saved
+type sessionInput struct {
+	StartPage       *int       `json:"start_page"`
+	EndPage         *int       `json:"end_page"`
+	StartPercent    *float64   `json:"start_percent"`
+	EndPercent      *float64   `json:"end_percent"`
+	DurationMinutes *int       `json:"duration_minutes"`
+	ReadAt          *time.Time `json:"read_at"`
+}
+
+// apply copies the fields that were sent onto the session, adding any problems with the percentages to v
+func (input sessionInput) apply(s *data.ReadingSession, book *data.Book, v *validator.Validator) {
+	page := func(key string, pageValue *int, percent *float64, dst *int) {
+		switch {
+		case pageValue != nil && percent != nil:
+			v.AddError(key+"_percent", fmt.Sprintf("can't be given as well as %s_page", key))
+		case pageValue != nil:
+			*dst = *pageValue
+		case percent != nil:
+			if book.Pages <= 0 {
+				v.AddError(key+"_percent", "can only be used for a book with a page count")
+				return
+			}
+			if *percent < 0 || *percent > 100 {
+				v.AddError(key+"_percent", "must be between 0 and 100")
+				return
+			}
+			*dst = int(math.Round(*percent / 100 * float64(book.Pages)))
+		}
+	}
+
+	page("start", input.StartPage, input.StartPercent, &s.StartPage)
+	page("end", input.EndPage, input.EndPercent, &s.EndPage)
+
+	if input.DurationMinutes != nil {
+		s.DurationMinutes = *input.DurationMinutes
+	}
+	if input.ReadAt != nil {
+		s.ReadAt = *input.ReadAt
+	}
+}
+
+// sessionsHandler serves /v1/me/books/{id}/sessions: GET lists the user's sessions with the book, newest first, and POST logs a new one
+func (app *Application) sessionsHandler(w http.ResponseWriter, r *http.Request, book *data.Book) {
+	switch r.Method {
+	case http.MethodGet:
+		app.listSessions(w, r, book)
+	case http.MethodPost:
+		app.createSession(w, r, book)
+	default:
+		app.methodNotAllowed(w, r)
+	}
+}
+
+func (app *Application) listSessions(w http.ResponseWriter, r *http.Request, book *data.Book) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	var filters data.Filters
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	sessions, metadata, err := app.Models.Sessions.GetAllForBook(r.Context(), contextGetUser(r).ID, book.ID, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"sessions": sessions, "metadata": metadata}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// createSession logs a session; end_page (or end_percent) is the only thing that has to be sent:
+// start_page defaults to the furthest the reader had got before, and read_at to now
+// a book that isn't on the reader's shelves yet, or is only on want-to-read, is moved to reading
+func (app *Application) createSession(w http.ResponseWriter, r *http.Request, book *data.Book) {
+	user := contextGetUser(r)
+
+	var input sessionInput
+
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	previous, err := app.Models.Sessions.AllForBook(r.Context(), user.ID, book.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	now := time.Now()
+	session := &data.ReadingSession{UserID: user.ID, BookID: book.ID, ReadAt: now}
+	for _, s := range previous {
+		session.StartPage = max(session.StartPage, s.EndPage)
+	}
+
+	v := validator.New()
+
+	v.Check(input.EndPage != nil || input.EndPercent != nil, "end_page", "must be provided")
+	input.apply(session, book, v)
+
+	if data.ValidateReadingSession(v, session, book, now); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	if err := app.Models.Sessions.Insert(r.Context(), session); err != nil {
+		switch {
+		//the book was trashed or purged after it was looked up
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.startReading(r.Context(), user.ID, book.ID, session.ReadAt); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", sessionETag(session))
+	headers.Set("Location", fmt.Sprintf("/v1/me/books/%d/sessions/%d", book.ID, session.ID))
+
+	if err := app.WriteResponse(w, r, http.StatusCreated, envelope{"session": session}, headers); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// startReading puts the book on the reading shelf after a session is logged, unless it is already on reading, read or did-not-finish
+// started_at is the session's time when that is earlier than now, so logging an old session backdates it
+// another request changing the shelf at the same time wins, the session has been saved either way
+func (app *Application) startReading(ctx context.Context, userID, bookID int64, readAt time.Time) error {
+	ub, err := app.Models.UserBooks.Get(ctx, userID, bookID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		return err
+	}
+
+	isNew := ub == nil
+	if isNew {
+		ub = &data.UserBook{UserID: userID, BookID: bookID}
+	} else if ub.Status != data.StatusWantToRead {
+		return nil
+	}
+
+	ub.SetStatus(data.StatusReading, time.Now())
+	if readAt.Before(*ub.StartedAt) {
+		ub.StartedAt = &readAt
+	}
+
+	if isNew {
+		err = app.Models.UserBooks.Insert(ctx, ub)
+	} else {
+		err = app.Models.UserBooks.Update(ctx, ub)
+	}
+
+	switch {
+	case errors.Is(err, data.ErrDuplicate), errors.Is(err, data.ErrEditConflict), errors.Is(err, data.ErrRecordNotFound):
+		return nil
+	default:
+		return err
+	}
+}
+
+// sessionHandler serves /v1/me/books/{id}/sessions/{n}: GET returns the session, PUT changes it and DELETE removes it
+// a session of another user's, or one for a different book, is a 404
+func (app *Application) sessionHandler(w http.ResponseWriter, r *http.Request, book *data.Book, idParam string) {
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	user := contextGetUser(r)
+
+	session, err := app.Models.Sessions.Get(r.Context(), user.ID, id)
+	if err == nil && session.BookID != book.ID {
+		err = data.ErrRecordNotFound
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if r.Method != http.MethodGet && !ifMatch(r, sessionETag(session)) {
+		app.preconditionFailed(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		//nothing to change, the session is written below
+
+	case http.MethodPut:
+		var input sessionInput
+
+		if err := app.ReadJSON(w, r, &input); err != nil {
+			app.badRequest(w, r, err)
+			return
+		}
+
+		v := validator.New()
+
+		//the merged session is validated as a whole, the same as a book update
+		input.apply(session, book, v)
+
+		if data.ValidateReadingSession(v, session, book, time.Now()); !v.Valid() {
+			app.failedValidation(w, r, v.Errors)
+			return
+		}
+
+		if err := app.Models.Sessions.Update(r.Context(), session); err != nil {
+			switch {
+			case errors.Is(err, data.ErrEditConflict):
+				app.editConflict(w, r)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+	case http.MethodDelete:
+		if err := app.Models.Sessions.Delete(r.Context(), user.ID, session.ID); err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFound(w, r)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		if err := app.WriteResponse(w, r, http.StatusOK, envelope{"message": "the reading session has been deleted"}, nil); err != nil {
+			app.serverError(w, r, err)
+		}
+		return
+
+	default:
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", sessionETag(session))
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"session": session}, headers); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// progressHandler serves GET /v1/me/books/{id}/progress, how far through the book the user is and when they might finish it
+// see data.CalculateProgress for how it is worked out
+func (app *Application) progressHandler(w http.ResponseWriter, r *http.Request, book *data.Book) {
+	if r.Method != http.MethodGet {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	user := contextGetUser(r)
+
+	ub, err := app.Models.UserBooks.Get(r.Context(), user.ID, book.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	sessions, err := app.Models.Sessions.AllForBook(r.Context(), user.ID, book.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	progress := data.CalculateProgress(book, ub, sessions, time.Now())
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"progress": progress}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"readinglist/internal/data"
+	"readinglist/internal/validator"
+)
+
+// the /v1/me routes are the signed in user's own shelves; the books on them are the ones in the shared catalogue,
+// but the status, dates and rating belong to the user and nobody else sees them
+
+// userBookETag is the ETag of a user's entry for a book, the same idea as bookETag
+func userBookETag(ub *data.UserBook) string {
+	return fmt.Sprintf(`"%d"`, ub.Version)
+}
+
+// readMeBookPath splits a url like /v1/me/books/42/sessions/7 into the book id and what comes after it ("sessions/7")
+func readMeBookPath(r *http.Request) (int64, string, error) {
+	idParam, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/me/books/"), "/")
+
+	id, err := strconv.ParseInt(idParam, 10, 64)
+	if err != nil || id < 1 {
+		return 0, "", errors.New("invalid id parameter")
+	}
+
+	return id, rest, nil
+}
+
+// meBookHandler serves everything under /v1/me/books/{id}
+//
+//	/v1/me/books/{id}                 where the book is on the user's shelves, see meBook
+//	/v1/me/books/{id}/progress        how far through it they are, see progressHandler
+//	/v1/me/books/{id}/sessions[/{n}]  their reading sessions with it, see sessions.go
+func (app *Application) meBookHandler(w http.ResponseWriter, r *http.Request) {
+	id, rest, err := readMeBookPath(r)
+	if err != nil {
+		app.notFound(w, r)
+		return
+	}
+
+	//only books in the catalogue can go on a shelf, and a book in the trash is treated as if it isn't there
+	book, err := app.Models.Books.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	switch {
+	case rest == "":
+		app.meBook(w, r, book)
+	case rest == "progress":
+		app.progressHandler(w, r, book)
+	case rest == "sessions":
+		app.sessionsHandler(w, r, book)
+	case strings.HasPrefix(rest, "sessions/"):
+		app.sessionHandler(w, r, book, strings.TrimPrefix(rest, "sessions/"))
+	default:
+		app.notFound(w, r)
+	}
+}
+
+// meBook serves /v1/me/books/{id}: GET returns where the book is on the user's shelves, PUT puts it on one or changes it,
+// and DELETE takes it off them again
+func (app *Application) meBook(w http.ResponseWriter, r *http.Request, book *data.Book) {
+	user := contextGetUser(r)
+
+	ub, err := app.Models.UserBooks.Get(r.Context(), user.ID, book.ID)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if ub == nil {
+			app.notFound(w, r)
+			return
+		}
+
+		ub.Book = book
+
+		headers := make(http.Header)
+		headers.Set("ETag", userBookETag(ub))
+
+		if err := app.WriteResponse(w, r, http.StatusOK, envelope{"user_book": ub}, headers); err != nil {
+			app.serverError(w, r, err)
+		}
+
+	case http.MethodPut:
+		app.putMeBook(w, r, book, ub)
+
+	case http.MethodDelete:
+		if ub == nil {
+			app.notFound(w, r)
+			return
+		}
+
+		if !ifMatch(r, userBookETag(ub)) {
+			app.preconditionFailed(w, r)
+			return
+		}
+
+		if err := app.Models.UserBooks.Delete(r.Context(), user.ID, book.ID); err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFound(w, r)
+			default:
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		if err := app.WriteResponse(w, r, http.StatusOK, envelope{"message": "the book has been taken off your shelves"}, nil); err != nil {
+			app.serverError(w, r, err)
+		}
+
+	default:
+		app.methodNotAllowed(w, r)
+	}
+}
+
+// putMeBook puts the book on one of the user's shelves, or changes the entry that is already there
+// only the fields that are sent are changed; changing the status stamps the dates (see data.UserBook.SetStatus),
+// and a started_at or finished_at sent in the same request wins over the stamped one
+func (app *Application) putMeBook(w http.ResponseWriter, r *http.Request, book *data.Book, ub *data.UserBook) {
+	isNew := ub == nil
+
+	if isNew {
+		//If-Match with an ETag (or *) says the client expects an entry to already be there
+		if r.Header.Get("If-Match") != "" {
+			app.preconditionFailed(w, r)
+			return
+		}
+
+		ub = &data.UserBook{UserID: contextGetUser(r).ID, BookID: book.ID}
+	} else if !ifMatch(r, userBookETag(ub)) {
+		app.preconditionFailed(w, r)
+		return
+	}
+
+	var input struct {
+		Status     *string    `json:"status"`
+		StartedAt  *time.Time `json:"started_at"`
+		FinishedAt *time.Time `json:"finished_at"`
+		Rating     *float32   `json:"rating"`
+		DNFReason  *string    `json:"dnf_reason"`
+	}
+
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	now := time.Now()
+
+	v.Check(!isNew || input.Status != nil, "status", "must be provided")
+
+	if input.Status != nil && (isNew || *input.Status != ub.Status) {
+		ub.SetStatus(*input.Status, now)
+	}
+	if input.StartedAt != nil {
+		ub.StartedAt = input.StartedAt
+	}
+	if input.FinishedAt != nil {
+		ub.FinishedAt = input.FinishedAt
+	}
+	if input.Rating != nil {
+		ub.Rating = *input.Rating
+	}
+	if input.DNFReason != nil {
+		ub.DNFReason = *input.DNFReason
+	}
+
+	if data.ValidateUserBook(v, ub, now); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	var err error
+	if isNew {
+		err = app.Models.UserBooks.Insert(r.Context(), ub)
+	} else {
+		err = app.Models.UserBooks.Update(r.Context(), ub)
+	}
+	if err != nil {
+		switch {
+		//ErrDuplicate means another request put the book on a shelf between the Get and the Insert, which is the same kind of clash
+		case errors.Is(err, data.ErrEditConflict), errors.Is(err, data.ErrDuplicate):
+			app.editConflict(w, r)
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFound(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	ub.Book = book
+
+	headers := make(http.Header)
+	headers.Set("ETag", userBookETag(ub))
+
+	status := http.StatusOK
+	if isNew {
+		status = http.StatusCreated
+		headers.Set("Location", fmt.Sprintf("/v1/me/books/%d", book.ID))
+	}
+
+	if err := app.WriteResponse(w, r, status, envelope{"user_book": ub}, headers); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// shelfHandler serves GET /v1/me/shelves/{status}, a page of the user's books with that status
+// it is sorted by when the entries last changed, newest first, unless ?sort= says otherwise
+func (app *Application) shelfHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	status := strings.TrimPrefix(r.URL.Path, "/v1/me/shelves/")
+	if !validator.PermittedValue(status, data.Statuses...) {
+		app.notFound(w, r)
+		return
+	}
+
+	qs := r.URL.Query()
+	v := validator.New()
+
+	filters := data.ShelfFilters{Status: status}
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	filters.Sort = app.readString(qs, "sort", "-updated_at")
+	filters.SortSafelist = []string{
+		"updated_at", "started_at", "finished_at", "rating", "title",
+		"-updated_at", "-started_at", "-finished_at", "-rating", "-title",
+	}
+
+	if data.ValidateFilters(v, filters.Filters); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	shelf, metadata, err := app.Models.UserBooks.GetShelf(r.Context(), contextGetUser(r).ID, filters)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	//the books are fetched in one go and matched up, rather than one query per book
+	ids := make([]int64, len(shelf))
+	for i, ub := range shelf {
+		ids[i] = ub.BookID
+	}
+
+	books, err := app.Models.Books.GetMany(r.Context(), ids)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	byID := make(map[int64]*data.Book, len(books))
+	for _, book := range books {
+		byID[book.ID] = book
+	}
+	for _, ub := range shelf {
+		ub.Book = byID[ub.BookID]
+	}
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"user_books": shelf, "metadata": metadata}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"readinglist/internal/data"
+	"readinglist/internal/validator"
+)
+
+// authenticationTTL is how long a token from POST /v1/tokens/authentication works for before the user has to sign in again
+const authenticationTTL = 24 * time.Hour
+
+// createAuthenticationTokenHandler serves POST /v1/tokens/authentication, which swaps an email address and password for a token
+// the token goes in an "Authorization: Bearer <token>" header on the requests after this one
+func (app *Application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	data.ValidateEmail(v, input.Email)
+	data.ValidatePasswordPlaintext(v, input.Password)
+
+	if !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.Models.Users.GetByEmail(r.Context(), input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidCredentials(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	match, err := user.Password.Matches(input.Password)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if !match {
+		app.invalidCredentials(w, r)
+		return
+	}
+
+	token, err := app.Models.Tokens.New(r.Context(), user.ID, authenticationTTL, data.ScopeAuthentication)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.WriteResponse(w, r, http.StatusCreated, envelope{"authentication_token": token}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// deleteCurrentTokenHandler serves DELETE /v1/tokens/current, which signs out by revoking the token the request was sent with
+// the user's other tokens (e.g. on another device) keep working
+func (app *Application) deleteCurrentTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	//requireAuthenticatedUser has already checked there is a valid token in the header
+	token, _, _ := bearerToken(r)
+
+	if err := app.Models.Tokens.Delete(r.Context(), data.ScopeAuthentication, token); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"message": "the authentication token has been revoked"}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
@@ -0,0 +1,180 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"readinglist/internal/data"
+	"readinglist/internal/mailer"
+	"readinglist/internal/validator"
+)
+
+// activationTTL is how long a new user has to activate their account before the token stops working
+const activationTTL = 3 * 24 * time.Hour
+
+// registerUserHandler serves POST /v1/users, which signs a new user up
+// the user starts out not activated, and an email with an activation token is sent to the address they gave
+// the email is sent in the background so the client isn't kept waiting on the mail server, which is why the response is 202 Accepted
+func (app *Application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	var input struct {
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	user := &data.User{
+		Name:      input.Name,
+		Email:     input.Email,
+		Activated: false,
+	}
+
+	v := validator.New()
+
+	//the password is checked before it is hashed because bcrypt won't hash one that is longer than 72 bytes
+	if data.ValidatePasswordPlaintext(v, input.Password); v.Valid() {
+		if err := user.Password.Set(input.Password); err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	//the user, its permissions and its activation token are saved together, otherwise a failure part way through would leave a user
+	//that can never be activated, and whose email address can't be used to sign up again
+	var token *data.Token
+
+	err := app.Models.Users.WithTx(r.Context(), func(tx data.UserTx) error {
+		if err := tx.Insert(r.Context(), user); err != nil {
+			return err
+		}
+
+		//what a new user can do is set when the server starts (-default-permissions), it only counts once they have activated
+		if err := tx.AddPermissions(r.Context(), user.ID, app.Config.DefaultPermissions...); err != nil {
+			return err
+		}
+
+		var err error
+		token, err = tx.NewToken(r.Context(), user.ID, activationTTL, data.ScopeActivation)
+		return err
+	})
+	if err != nil {
+		switch {
+		//this is a validation error rather than a 409 so a sign up form can show it next to the email field
+		case errors.Is(err, data.ErrDuplicate):
+			v.AddError("email", "a user with this email address already exists")
+			app.failedValidation(w, r, v.Errors)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	emailData := map[string]any{
+		"Name":            user.Name,
+		"UserID":          user.ID,
+		"ActivationToken": token.Plaintext,
+		"Expiry":          token.Expiry.Format(time.RFC1123),
+		"BaseURL":         app.Config.APIURL, //never the request's Host, which whoever signs up controls
+	}
+
+	app.background(func() {
+		msg, err := mailer.Render(user.Email, "user_welcome.tmpl", emailData)
+		if err == nil {
+			err = app.Mailer.Send(msg)
+		}
+		if err != nil {
+			app.Logger.Printf("error: sending the welcome email to user %d: %v", user.ID, err)
+		}
+	})
+
+	if err := app.WriteResponse(w, r, http.StatusAccepted, envelope{"user": user}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// activateUserHandler serves PUT /v1/users/activated, which takes the token from the welcome email and activates the account
+// a token only works once: all of the user's activation tokens are deleted when it is used
+func (app *Application) activateUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		app.methodNotAllowed(w, r)
+		return
+	}
+
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	if err := app.ReadJSON(w, r, &input); err != nil {
+		app.badRequest(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidation(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.Models.Users.GetForToken(r.Context(), data.ScopeActivation, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired activation token")
+			app.failedValidation(w, r, v.Errors)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user.Activated = true
+
+	err = app.Models.Users.Update(r.Context(), user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflict(w, r)
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.Models.Tokens.DeleteAllForUser(r.Context(), data.ScopeActivation, user.ID); err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if err := app.WriteResponse(w, r, http.StatusOK, envelope{"user": user}, nil); err != nil {
+		app.serverError(w, r, err)
+	}
+}
+
+// background runs fn in its own goroutine; a panic in fn is logged instead of taking the whole server down with it
+func (app *Application) background(fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				app.Logger.Printf("error: panic in background task: %v", err)
+			}
+		}()
+
+		fn()
+	}()
+}
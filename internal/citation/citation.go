@@ -0,0 +1,426 @@
+// Package citation writes books out in the formats reference managers read: BibTeX, RIS and CSL-JSON
+// everything comes from the data.Book fields, so a citation is only as good as the title, author, year and ISBN that were saved
+package citation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"readinglist/internal/data"
+	"readinglist/internal/isbn"
+)
+
+// Styles are the values the style parameter can take, the first one is the default
+var Styles = []string{"bibtex", "ris", "csl-json"}
+
+// ErrUnknownStyle is returned by Write for a style that isn't in Styles
+var ErrUnknownStyle = errors.New("unknown citation style")
+
+// ContentType returns the media type a style is served with, these are what reference managers look for
+func ContentType(style string) string {
+	switch style {
+	case "bibtex":
+		return "application/x-bibtex; charset=utf-8"
+	case "ris":
+		return "application/x-research-info-systems; charset=utf-8"
+	case "csl-json":
+		return "application/vnd.citationstyles.csl+json"
+	}
+	return ""
+}
+
+// Write writes the citations for the books in the style
+// the keys are worked out for all of the books together, so two books that would get the same key can be told apart (see Keys)
+func Write(w io.Writer, style string, books []*data.Book) error {
+	keys := Keys(books)
+
+	switch style {
+	case "bibtex":
+		return writeBibTeX(w, books, keys)
+	case "ris":
+		return writeRIS(w, books, keys)
+	case "csl-json":
+		return writeCSLJSON(w, books, keys)
+	}
+
+	return ErrUnknownStyle
+}
+
+// Name is one author's name split the way citation formats want it
+type Name struct {
+	Family string
+	Given  string
+	Suffix string //Jr., III and so on
+}
+
+// name particles are part of the family name, so Ursula K. Le Guin is filed under Le Guin
+var particles = map[string]bool{
+	"da": true, "de": true, "del": true, "della": true, "der": true, "di": true, "du": true,
+	"la": true, "le": true, "van": true, "von": true, "ten": true, "ter": true,
+}
+
+var suffixes = map[string]bool{"jr": true, "jr.": true, "sr": true, "sr.": true, "ii": true, "iii": true, "iv": true}
+
+// Authors splits the author field into names
+// more than one author can be written as "A and B", "A & B" or "A; B"
+func Authors(author string) []Name {
+	author = strings.NewReplacer(" & ", ";", " and ", ";").Replace(author)
+
+	var names []Name
+	for _, part := range strings.Split(author, ";") {
+		if name, ok := ParseName(part); ok {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
+
+// ParseName splits one author's name into its parts
+// "Frank Herbert" and "Herbert, Frank" both become family Herbert, given Frank
+// a name with one word in it (Homer, or an organisation) is all family name
+func ParseName(s string) (Name, bool) {
+	s = strings.Join(strings.Fields(s), " ")
+	if s == "" {
+		return Name{}, false
+	}
+
+	//"Family, Given" or "Family, Given, Jr."
+	if family, rest, ok := strings.Cut(s, ","); ok {
+		name := Name{Family: strings.TrimSpace(family)}
+
+		given, suffix, _ := strings.Cut(rest, ",")
+		name.Given = strings.TrimSpace(given)
+		name.Suffix = strings.TrimSpace(suffix)
+
+		if suffixes[strings.ToLower(name.Given)] {
+			name.Given, name.Suffix = "", name.Given
+		}
+
+		return name, true
+	}
+
+	words := strings.Fields(s)
+
+	var name Name
+	if len(words) > 1 && suffixes[strings.ToLower(words[len(words)-1])] {
+		name.Suffix = words[len(words)-1]
+		words = words[:len(words)-1]
+	}
+
+	//the family name is the last word along with any particles in front of it
+	//the first word is always a given name though, so "Van Morrison" stays as it is
+	start := len(words) - 1
+	for start > 1 && particles[strings.ToLower(words[start-1])] {
+		start--
+	}
+
+	name.Family = strings.Join(words[start:], " ")
+	name.Given = strings.Join(words[:start], " ")
+
+	return name, true
+}
+
+// Keys returns a citation key for each book, like herbert1965dune
+// a key is the first author's family name, the year and the first word of the title that isn't "the", "a" or "an",
+// so the same book always gets the same key; when two of the books would get the same key, the later ones (by id) get b, c... added
+func Keys(books []*data.Book) []string {
+	keys := make([]string, len(books))
+	count := map[string]int{}
+
+	//books are numbered by id so the letters don't depend on the order they were asked for in
+	order := make([]int, len(books))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return books[order[i]].ID < books[order[j]].ID })
+
+	for _, i := range order {
+		key := Key(books[i])
+		count[key]++
+
+		if n := count[key]; n > 1 {
+			key += suffixLetters(n)
+		}
+		keys[i] = key
+	}
+
+	return keys
+}
+
+// Key returns the citation key for a single book, see Keys
+func Key(book *data.Book) string {
+	family := "anon"
+	if names := Authors(book.Author); len(names) > 0 {
+		if k := keyPart(names[0].Family); k != "" {
+			family = k
+		}
+	}
+
+	year := "nd" //no date, which is what citation styles print for a missing year
+	if book.Published > 0 {
+		year = strconv.Itoa(book.Published)
+	}
+
+	word := ""
+	for _, w := range strings.Fields(book.Title) {
+		w = keyPart(w)
+		if w != "" && w != "the" && w != "a" && w != "an" {
+			word = w
+			break
+		}
+	}
+
+	return family + year + word
+}
+
+// keyPart lower cases s and keeps only plain ascii letters and digits, so keys work with every BibTeX tool
+// accented letters are swapped for the letter without the accent rather than being dropped
+func keyPart(s string) string {
+	var b strings.Builder
+
+	for _, r := range strings.ToLower(s) {
+		if folded, ok := accents[r]; ok {
+			b.WriteString(folded)
+			continue
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+var accents = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'æ': "ae",
+	'ç': "c", 'č': "c", 'ć': "c",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ě': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'œ': "oe",
+	'ř': "r", 'š': "s", 'ś': "s", 'ß': "ss",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ů': "u",
+	'ý': "y", 'ÿ': "y", 'ž': "z", 'ź': "z", 'ż': "z", 'ł': "l",
+}
+
+// suffixLetters turns 2 into b, 3 into c and so on (after z comes ba), the way BibTeX styles tell apart two works from one year
+func suffixLetters(n int) string {
+	n-- //the first book keeps the plain key, so the second one is b
+	s := ""
+	for n > 0 {
+		s = string(rune('a'+n%26)) + s
+		n /= 26
+	}
+	return s
+}
+
+// writeBibTeX writes one @book entry per book
+func writeBibTeX(w io.Writer, books []*data.Book, keys []string) error {
+	for i, book := range books {
+		var fields [][2]string
+
+		if names := Authors(book.Author); len(names) > 0 {
+			authors := make([]string, len(names))
+			for j, name := range names {
+				authors[j] = bibtexName(name)
+			}
+			fields = append(fields, [2]string{"author", strings.Join(authors, " and ")})
+		}
+
+		//the extra braces stop BibTeX styles from changing the case of the title
+		fields = append(fields, [2]string{"title", "{" + escapeBibTeX(book.Title) + "}"})
+
+		if book.Published > 0 {
+			fields = append(fields, [2]string{"year", strconv.Itoa(book.Published)})
+		}
+		if book.ISBN != "" {
+			fields = append(fields, [2]string{"isbn", escapeBibTeX(formatISBN(book.ISBN))})
+		}
+		if book.Pages > 0 {
+			fields = append(fields, [2]string{"pagetotal", strconv.Itoa(book.Pages)})
+		}
+		if len(book.Genres) > 0 {
+			keywords := make([]string, len(book.Genres))
+			for j, genre := range book.Genres {
+				keywords[j] = escapeBibTeX(genre)
+			}
+			fields = append(fields, [2]string{"keywords", strings.Join(keywords, ", ")})
+		}
+
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintf(w, "@book{%s,\n", keys[i]); err != nil {
+			return err
+		}
+		for j, f := range fields {
+			comma := ","
+			if j == len(fields)-1 {
+				comma = ""
+			}
+			if _, err := fmt.Fprintf(w, "  %s = {%s}%s\n", f[0], f[1], comma); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "}\n"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// bibtexName writes a name as "Family, Given" or "Family, Suffix, Given", which BibTeX reads without guessing
+// the family name is braced when it has more than one word, or "Le Guin" would be read as Guin with a particle
+func bibtexName(name Name) string {
+	family := escapeBibTeX(name.Family)
+	if strings.Contains(name.Family, " ") {
+		family = "{" + family + "}"
+	}
+
+	parts := []string{family}
+	if name.Suffix != "" {
+		parts = append(parts, escapeBibTeX(name.Suffix))
+	}
+	if name.Given != "" {
+		parts = append(parts, escapeBibTeX(name.Given))
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+// escapeBibTeX escapes the characters that mean something to LaTeX, so a title like "Cats & Dogs" doesn't break the file
+// accented letters are left alone, biber and modern BibTeX read UTF-8 as it is
+var escapeBibTeX = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`&`, `\&`,
+	`%`, `\%`,
+	`$`, `\$`,
+	`#`, `\#`,
+	`_`, `\_`,
+	`~`, `\textasciitilde{}`,
+	`^`, `\textasciicircum{}`,
+).Replace
+
+// writeRIS writes one record per book; the page count is left out because RIS only has fields for page ranges
+// RIS has no escaping, every line is a two letter tag, two spaces, a dash, a space and the value, so line breaks are all that has to be taken out
+func writeRIS(w io.Writer, books []*data.Book, keys []string) error {
+	for i, book := range books {
+		lines := [][2]string{{"TY", "BOOK"}, {"ID", keys[i]}}
+
+		for _, name := range Authors(book.Author) {
+			lines = append(lines, [2]string{"AU", risName(name)})
+		}
+
+		lines = append(lines, [2]string{"TI", book.Title})
+
+		if book.Published > 0 {
+			lines = append(lines, [2]string{"PY", strconv.Itoa(book.Published)})
+		}
+		if book.ISBN != "" {
+			lines = append(lines, [2]string{"SN", formatISBN(book.ISBN)})
+		}
+		for _, genre := range book.Genres {
+			lines = append(lines, [2]string{"KW", genre})
+		}
+
+		lines = append(lines, [2]string{"ER", ""})
+
+		for _, line := range lines {
+			//the spec uses CRLF line endings, and some older importers won't read the file without them
+			if _, err := fmt.Fprintf(w, "%s  - %s\r\n", line[0], risValue(line[1])); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// risName writes a name as "Family, Given, Suffix", the order the RIS spec asks for
+func risName(name Name) string {
+	parts := []string{name.Family}
+	if name.Given != "" || name.Suffix != "" {
+		parts = append(parts, name.Given)
+	}
+	if name.Suffix != "" {
+		parts = append(parts, name.Suffix)
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func risValue(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// cslItem is one entry of a CSL-JSON file, see https://citeproc-js.readthedocs.io/en/latest/csl-json/markup.html
+type cslItem struct {
+	ID            string    `json:"id"`
+	Type          string    `json:"type"`
+	Title         string    `json:"title"`
+	Author        []cslName `json:"author,omitempty"`
+	Issued        *cslDate  `json:"issued,omitempty"`
+	ISBN          string    `json:"ISBN,omitempty"`
+	NumberOfPages string    `json:"number-of-pages,omitempty"`
+	Keyword       string    `json:"keyword,omitempty"`
+}
+
+type cslName struct {
+	Family string `json:"family"`
+	Given  string `json:"given,omitempty"`
+	Suffix string `json:"suffix,omitempty"`
+}
+
+type cslDate struct {
+	DateParts [][]int `json:"date-parts"`
+}
+
+// formatISBN hyphenates the ISBN the way it is printed on the book, however it was typed in
+// one that can't be hyphenated is left as it was
+func formatISBN(s string) string {
+	if hyphenated, err := isbn.Hyphenate(s); err == nil {
+		return hyphenated
+	}
+	return s
+}
+
+// writeCSLJSON writes an array of CSL items, the format Zotero, Pandoc and citeproc read
+// encoding/json does all of the escaping
+func writeCSLJSON(w io.Writer, books []*data.Book, keys []string) error {
+	items := make([]cslItem, len(books))
+
+	for i, book := range books {
+		item := cslItem{ID: keys[i], Type: "book", Title: book.Title, ISBN: formatISBN(book.ISBN)}
+
+		for _, name := range Authors(book.Author) {
+			item.Author = append(item.Author, cslName(name))
+		}
+		if book.Published > 0 {
+			item.Issued = &cslDate{DateParts: [][]int{{book.Published}}}
+		}
+		if book.Pages > 0 {
+			item.NumberOfPages = strconv.Itoa(book.Pages)
+		}
+		item.Keyword = strings.Join(book.Genres, ", ")
+
+		items[i] = item
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(items)
+}
@@ -0,0 +1,81 @@
+package citation
+
+import (
+	"reflect"
+	"testing"
+
+	"readinglist/internal/data"
+)
+
+func TestParseName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Name
+		ok   bool
+	}{
+		{"Frank Herbert", Name{Family: "Herbert", Given: "Frank"}, true},
+		{"Herbert, Frank", Name{Family: "Herbert", Given: "Frank"}, true},
+		{"  Frank   Herbert ", Name{Family: "Herbert", Given: "Frank"}, true},
+		{"Ursula K. Le Guin", Name{Family: "Le Guin", Given: "Ursula K."}, true},
+		{"Ludwig van Beethoven", Name{Family: "van Beethoven", Given: "Ludwig"}, true},
+		{"Van Morrison", Name{Family: "Morrison", Given: "Van"}, true},
+		{"Martin Luther King Jr.", Name{Family: "King", Given: "Martin Luther", Suffix: "Jr."}, true},
+		{"King, Martin Luther, Jr.", Name{Family: "King", Given: "Martin Luther", Suffix: "Jr."}, true},
+		{"King, Jr.", Name{Family: "King", Suffix: "Jr."}, true},
+		{"Homer", Name{Family: "Homer"}, true},
+		{"", Name{}, false},
+		{"   ", Name{}, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := ParseName(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseName(%q) = %+v, %t, want %+v, %t", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestKeys(t *testing.T) {
+	books := []*data.Book{
+		{ID: 3, Title: "Children of Dune", Author: "Frank Herbert", Published: 1976},
+		{ID: 2, Title: "The Dispossessed", Author: "Ursula K. Le Guin", Published: 1974},
+		{ID: 1, Title: "Dune", Author: "Herbert, Frank", Published: 1965},
+		{ID: 5, Title: "Dune", Author: "Frank Herbert & Brian Herbert", Published: 1965},
+		{ID: 4, Title: "Dune", Author: "Frank Herbert", Published: 1965},
+		{ID: 6, Title: "A Book", Author: "", Published: 0},
+		{ID: 7, Title: "Číslo", Author: "Karel Čapek", Published: 1920},
+	}
+
+	want := []string{
+		"herbert1976children",
+		"leguin1974dispossessed",
+		"herbert1965dune",
+		"herbert1965dunec", //the third book with the key by id, after 1 and 4
+		"herbert1965duneb",
+		"anonndbook",
+		"capek1920cislo",
+	}
+
+	if got := Keys(books); !reflect.DeepEqual(got, want) {
+		t.Errorf("Keys = %q, want %q", got, want)
+	}
+}
+
+func TestEscapeBibTeX(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"Dune", "Dune"},
+		{"Cats & Dogs", `Cats \& Dogs`},
+		{"100% {sure} $5 #1 a_b", `100\% \{sure\} \$5 \#1 a\_b`},
+		{`C:\path ~ ^`, `C:\textbackslash{}path \textasciitilde{} \textasciicircum{}`},
+		{"Čapek", "Čapek"},
+	}
+
+	for _, tt := range tests {
+		if got := escapeBibTeX(tt.in); got != tt.want {
+			t.Errorf("escapeBibTeX(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -4,11 +4,17 @@ package data
 //It means that any package under internal cannot be imported from outside this project
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
+
+	"readinglist/internal/isbn"
+	"readinglist/internal/validator"
 )
 
 // below is a struct that will be used to type a group of related data
@@ -18,56 +24,168 @@ type Book struct {
 	ID        int64     `json:"id"` //this json tag changes the field name from ID to id
 	CreatedAt time.Time `json:"-"`  //this json tag prevents this field from being displayed with the rest of the json when it is marshalled from the struct;
 	//the above is in the database, but not displayed elsewhere after the json is marshalled
-	Title     string   `json:"title"` //this changes the title field to lower case
-	Author    string   `json:"author,omitempty"`
-	Published int      `json:"published,omitempty"` //this json tag makes this field optional
-	Pages     int      `json:"pages,omitempty"`
-	Genres    []string `json:"genres,omitempty"`
-	Rating    float32  `json:"rating,omitempty"`
-	ISBN      string   `json:"isbn,omitempty"`
-	Version   int32    `json:"-"`
+	Title     string     `json:"title"` //this changes the title field to lower case
+	Author    string     `json:"author,omitempty"`
+	Published int        `json:"published,omitempty"` //this json tag makes this field optional
+	Pages     int        `json:"pages,omitempty"`
+	Genres    []string   `json:"genres,omitempty"`
+	Rating    float32    `json:"rating,omitempty"`
+	ISBN      string     `json:"isbn,omitempty"`
+	Version   int32      `json:"-"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` //this is only set for books in the trash, so it is left out of the json for every other book
+}
+
+// ValidateBook checks every field of a book before it is saved
+// the problems are collected in the validator so the client can be told about all of them at once
+// both the api and the cmd/web form use this so the rules only live in one place
+func ValidateBook(v *validator.Validator, book *Book) {
+	v.Check(strings.TrimSpace(book.Title) != "", "title", "must be provided")
+	v.Check(len(book.Title) <= 500, "title", "must not be more than 500 bytes long")
+
+	v.Check(len(book.Author) <= 500, "author", "must not be more than 500 bytes long")
+
+	//1450 is roughly when the printing press came along, so nothing can have been published before that
+	v.Check(book.Published != 0, "published", "must be provided")
+	v.Check(book.Published >= 1450, "published", "must be greater than or equal to 1450")
+	v.Check(book.Published <= time.Now().Year(), "published", "must not be in the future")
+
+	v.Check(book.Pages > 0, "pages", "must be greater than zero")
+
+	v.Check(book.Rating >= 0 && book.Rating <= 5, "rating", "must be between 0 and 5")
+
+	v.Check(len(book.Genres) >= 1, "genres", "must contain at least 1 genre")
+	v.Check(len(book.Genres) <= 5, "genres", "must not contain more than 5 genres")
+
+	//genres are compared without case so "Fiction" and "fiction" count as the same genre
+	lowered := make([]string, len(book.Genres))
+	for i, genre := range book.Genres {
+		v.Check(strings.TrimSpace(genre) != "", "genres", "must not contain empty genres")
+		lowered[i] = strings.ToLower(strings.TrimSpace(genre))
+	}
+	v.Check(validator.Unique(lowered), "genres", "must not contain duplicate genres")
+
+	//the isbn is optional, but if there is one its check digit has to add up
+	if book.ISBN != "" {
+		v.Check(isbn.Valid(book.ISBN), "isbn", "must be a valid ISBN-10 or ISBN-13")
+	}
+}
+
+// isbn13 is what goes in the isbn13 column: the book's ISBN as an ISBN-13 with no hyphens, so however it was typed in it matches the same book
+// a book with no ISBN gets NULL, which the unique index lets any number of books have
+func isbn13(book *Book) any {
+	canonical, err := isbn.To13(book.ISBN)
+	if err != nil {
+		return nil
+	}
+	return canonical
 }
 
 // this type is connected to all of the methods that implement the crud operations
+// the connection pool and the query timeout are in the embedded dbModel
 type BookModel struct {
-	DB *sql.DB //this is a pointer to the sql database connection
+	dbModel
+}
+
+// WithTx runs fn inside a database transaction
+// everything fn does through tx is committed together when it returns nil, or rolled back together when it returns an error
+// each statement still gets its own QueryTimeout, so a long batch isn't cut off part way through just for being long
+func (b BookModel) WithTx(ctx context.Context, fn func(tx BookTx) error) error {
+	return withTx(ctx, b.DB, func(tx *sql.Tx) error {
+		return fn(bookTx{q: tx, model: b})
+	})
 }
 
 // this method "hangs off of" the BookModel type - like all of the following methods
 // it takes in a pointer to a book - that is a pointer to a book record that is coming in to the database
-func (b BookModel) Insert(book *Book) error {
+// the insert and its revision are saved together in one transaction
+func (b BookModel) Insert(ctx context.Context, book *Book) error {
+	return b.WithTx(ctx, func(tx BookTx) error {
+		return tx.Insert(ctx, book)
+	})
+}
+
+// this method takes in a book id and returns a pointer to a book and an error
+// a single read doesn't need a transaction, so it runs straight against the connection pool
+func (b BookModel) Get(ctx context.Context, id int64) (*Book, error) {
+	return bookTx{q: b.DB, model: b}.Get(ctx, id)
+}
+
+// Update saves the changes to a book using optimistic locking
+// the row is only updated if its version is still the one that was read, and the version is then incremented
+// if no row matches, someone else got there first and ErrEditConflict is returned
+// a revision with the new values is saved in the same transaction
+func (b BookModel) Update(ctx context.Context, book *Book) error {
+	return b.WithTx(ctx, func(tx BookTx) error {
+		return tx.Update(ctx, book)
+	})
+}
+
+// Delete moves the book to the trash by setting its deleted_at
+// the version goes up as well, so an ETag for the book from before it was trashed can't be used once it is restored
+// a book that is already in the trash counts as not found
+// version is the one the caller last saw (from If-Match), the book is only trashed if it is still at that version
+// and ErrEditConflict is returned if it isn't, the same as Update; a version of 0 trashes the book whatever version it is at
+func (b BookModel) Delete(ctx context.Context, id int64, version int32) error {
+	return b.WithTx(ctx, func(tx BookTx) error {
+		return tx.Delete(ctx, id, version)
+	})
+}
+
+// bookTx holds the SQL for the single book changes, so the same code runs for BookModel and inside BookModel.WithTx
+// q is either the connection pool or a transaction
+type bookTx struct {
+	q     querier
+	model BookModel
+}
+
+func (t bookTx) Insert(ctx context.Context, book *Book) error {
 	//the query variable holds the postgres sql statement that will be run to create a new record
 	//the values are "positional arguments" and are being populated by the args variable below
 	query := `
-	INSERT INTO books (title, author, published, pages, genres, rating, isbn)
-	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	INSERT INTO books (title, author, published, pages, genres, rating, isbn, isbn13)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 	RETURNING id, created_at, version`
 
 	//the blank interface below is taking in all the information from the pointer to a book above and then populates the query variable VALUES
-	args := []interface{}{book.Title, book.Author, book.Published, book.Pages, pq.Array(book.Genres), book.Rating, book.ISBN}
+	args := []interface{}{book.Title, book.Author, book.Published, book.Pages, pq.Array(book.Genres), book.Rating, book.ISBN, isbn13(book)}
 
 	//this first runs the INSERT statement with the query and the args so the row is put into the database
 	//it then returns back some values with the second part (which corresponds to the RETURNING part of the statement above)
 	//the Scan part returns dereferenced pointers to those aspects of the book object because these are system generated
-	return b.DB.QueryRow(query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version) //returns the dereferenced pointer, auto-generated values to Go object
+	ctx, cancel := t.model.queryContext(ctx)
+	defer cancel()
+
+	err := t.q.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version) //returns the dereferenced pointer, auto-generated values to Go object
+	if err != nil {
+		return wrapError(ctx, err)
+	}
+
+	if err := recordRevision(ctx, t.q, book, "insert"); err != nil {
+		return wrapError(ctx, err)
+	}
+
+	return nil
 }
 
-// this method takes in a book id and returns a pointer to a book and an error
-func (b BookModel) Get(id int64) (*Book, error) {
+func (t bookTx) Get(ctx context.Context, id int64) (*Book, error) {
 	//this returns an error if the id is invalid
 	if id < 1 {
-		return nil, errors.New("record not found")
+		return nil, ErrRecordNotFound
 	}
 	//this pulls the specific record from the database
 	query := `
 	SELECT id, created_at, title, author, published, pages, genres, rating, isbn, version
 	FROM books
-	WHERE id = $1`
+	WHERE id = $1 AND deleted_at IS NULL`
 	//this variable is used to hold all of the information for the book record from the database
 	var book Book
+
+	ctx, cancel := t.model.queryContext(ctx)
+	defer cancel()
+
 	//Below passes back the scanned information
 	//Scan is taking in the query and id information and then populating the variable with the record returned from the database
-	err := b.DB.QueryRow(query, id).Scan(
+	err := t.q.QueryRowContext(ctx, query, id).Scan(
 		&book.ID,
 		&book.CreatedAt,
 		&book.Title,
@@ -84,68 +202,529 @@ func (b BookModel) Get(id int64) (*Book, error) {
 		switch {
 		//this case handles when there are no records with the specific id found
 		case errors.Is(err, sql.ErrNoRows):
-			return nil, errors.New("record not found")
+			return nil, ErrRecordNotFound
 		default:
-			return nil, err
+			return nil, wrapError(ctx, err)
 
 		}
 	}
 	return &book, nil //this returns the book object with a nil error
 }
 
-func (b BookModel) Update(book *Book) error {
+func (t bookTx) Update(ctx context.Context, book *Book) error {
 	query := `
 	UPDATE books
-	SET title = $1, author = $2, published = $3, pages = $4, genres = $5, rating = $6, isbn = $7, version = version +1
-	WHERE id = $8 AND version = $9
+	SET title = $1, author = $2, published = $3, pages = $4, genres = $5, rating = $6, isbn = $7, isbn13 = $8, version = version +1
+	WHERE id = $9 AND version = $10 AND deleted_at IS NULL
 	RETURNING version`
 
-	args := []interface{}{book.Title, book.Author, book.Published, book.Pages, pq.Array(book.Genres), book.Rating, book.ISBN, book.ID, book.Version}
-	return b.DB.QueryRow(query, args...).Scan(&book.Version)
+	args := []interface{}{book.Title, book.Author, book.Published, book.Pages, pq.Array(book.Genres), book.Rating, book.ISBN, isbn13(book), book.ID, book.Version}
+
+	ctx, cancel := t.model.queryContext(ctx)
+	defer cancel()
+
+	err := t.q.QueryRowContext(ctx, query, args...).Scan(&book.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return wrapError(ctx, err)
+		}
+	}
+
+	if err := recordRevision(ctx, t.q, book, "update"); err != nil {
+		return wrapError(ctx, err)
+	}
+
+	return nil
+}
+
+func (t bookTx) Delete(ctx context.Context, id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	UPDATE books
+	SET deleted_at = NOW(), version = version + 1
+	WHERE id = $1 AND deleted_at IS NULL AND (version = $2 OR $2 = 0)
+	RETURNING id, created_at, title, author, published, pages, genres, rating, isbn, version, deleted_at`
+
+	ctx, cancel := t.model.queryContext(ctx)
+	defer cancel()
+
+	//the trashed book is read back so the revision has all of its fields
+	var book Book
+
+	err := t.q.QueryRowContext(ctx, query, id, version).Scan(
+		&book.ID,
+		&book.CreatedAt,
+		&book.Title,
+		&book.Author,
+		&book.Published,
+		&book.Pages,
+		pq.Array(&book.Genres),
+		&book.Rating,
+		&book.ISBN,
+		&book.Version,
+		&book.DeletedAt,
+	)
+	if err != nil {
+		switch {
+		//with a version there is no telling whether the book changed or went, the same as in Update
+		case errors.Is(err, sql.ErrNoRows) && version != 0:
+			return ErrEditConflict
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return wrapError(ctx, err)
+		}
+	}
+
+	if err := recordRevision(ctx, t.q, &book, "delete"); err != nil {
+		return wrapError(ctx, err)
+	}
+
+	return nil
+}
+
+// GetByISBN returns the book with the ISBN, which can be an ISBN-10 or ISBN-13 written with or without hyphens
+// it is used by GET /v1/books/isbn/{isbn} and to spot books that are already in the library when importing; books in the trash aren't matched
+func (b BookModel) GetByISBN(ctx context.Context, number string) (*Book, error) {
+	canonical, err := isbn.To13(number)
+	if err != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, title, author, published, pages, genres, rating, isbn, version
+	FROM books
+	WHERE isbn13 = $1 AND deleted_at IS NULL`
+
+	var book Book
+
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
+
+	err = b.DB.QueryRowContext(ctx, query, canonical).Scan(
+		&book.ID,
+		&book.CreatedAt,
+		&book.Title,
+		&book.Author,
+		&book.Published,
+		&book.Pages,
+		pq.Array(&book.Genres),
+		&book.Rating,
+		&book.ISBN,
+		&book.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, wrapError(ctx, err)
+		}
+	}
+
+	return &book, nil
+}
+
+// GetMany returns the books with the ids, ordered by id
+// ids that don't match a book (or only match one in the trash) are left out rather than being an error, the caller can compare the lengths
+func (b BookModel) GetMany(ctx context.Context, ids []int64) ([]*Book, error) {
+	query := `
+	SELECT id, created_at, title, author, published, pages, genres, rating, isbn, version
+	FROM books
+	WHERE id = ANY($1) AND deleted_at IS NULL
+	ORDER BY id`
+
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, wrapError(ctx, err)
+	}
+	defer rows.Close()
+
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+
+		err := rows.Scan(
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Published,
+			&book.Pages,
+			pq.Array(&book.Genres),
+			&book.Rating,
+			&book.ISBN,
+			&book.Version,
+		)
+		if err != nil {
+			return nil, wrapError(ctx, err)
+		}
+
+		books = append(books, &book)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapError(ctx, err)
+	}
+
+	return books, nil
+}
+
+// Genre is one of the genres used in the library and how many books have it
+type Genre struct {
+	Name  string `json:"name"`
+	Books int    `json:"books"`
+}
+
+// Genres returns every genre that at least one book (outside the trash) has, in alphabetical order
+// genres are compared exactly, the same as the genres filter, so "Fiction" and "fiction" on different books are two genres
+func (b BookModel) Genres(ctx context.Context) ([]*Genre, error) {
+	query := `
+	SELECT genre, count(*)
+	FROM books, unnest(genres) AS genre
+	WHERE deleted_at IS NULL
+	GROUP BY genre
+	ORDER BY lower(genre), genre`
+
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, wrapError(ctx, err)
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+
+		if err := rows.Scan(&genre.Name, &genre.Books); err != nil {
+			return nil, wrapError(ctx, err)
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, wrapError(ctx, err)
+	}
+
+	return genres, nil
 }
 
-func (b BookModel) Delete(id int64) error {
+// DeletePermanently removes the row, whether the book is in the trash or not
+// there is no getting it back after this, and its revisions are deleted along with it
+// version works the same as in Delete
+func (b BookModel) DeletePermanently(ctx context.Context, id int64, version int32) error {
 	if id < 1 {
-		return errors.New("record not found")
+		return ErrRecordNotFound
 	}
 
 	query := `
 	DELETE FROM books
-	WHERE id = $1`
+	WHERE id = $1 AND (version = $2 OR $2 = 0)`
+
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
 
-	results, err := b.DB.Exec(query, id)
+	results, err := b.DB.ExecContext(ctx, query, id, version)
 	if err != nil {
-		return err
+		return wrapError(ctx, err)
 	}
 
-	//below checks that something actually happened by determining if any rows were changed in the database
 	rowsAffected, err := results.RowsAffected()
 	if err != nil {
 		return err
 	}
-	//this returns an error if no rows were affected
-	if rowsAffected == 0 {
-		return errors.New("record not found")
+
+	switch {
+	case rowsAffected == 0 && version != 0:
+		return ErrEditConflict
+	case rowsAffected == 0:
+		return ErrRecordNotFound
 	}
 
 	return nil
 }
 
-// GetAll doesn't take anything, but it does return a slice with pointers to books and an error
-func (b BookModel) GetAll() ([]*Book, error) {
+// Restore takes the book back out of the trash and returns it
+// ErrRecordNotFound means there is no book with the id in the trash
+func (b BookModel) Restore(ctx context.Context, id int64) (*Book, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
 	query := `
-	SELECT *
+	UPDATE books
+	SET deleted_at = NULL, version = version + 1
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	RETURNING id, created_at, title, author, published, pages, genres, rating, isbn, version`
+
+	var book Book
+
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
+
+	err := withTx(ctx, b.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, id).Scan(
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Published,
+			&book.Pages,
+			pq.Array(&book.Genres),
+			&book.Rating,
+			&book.ISBN,
+			&book.Version,
+		)
+		if err != nil {
+			return err
+		}
+
+		return recordRevision(ctx, tx, &book, "restore")
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, wrapError(ctx, err)
+		}
+	}
+
+	return &book, nil
+}
+
+// History returns one page of the revisions of a book, newest first
+// it works for books in the trash too, so it can be used to decide whether to restore one
+func (b BookModel) History(ctx context.Context, id int64, filters Filters) ([]*BookRevision, Metadata, error) {
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
+
+	revisions, metadata, err := getRevisions(ctx, b.DB, id, filters)
+	if err != nil {
+		return nil, Metadata{}, wrapError(ctx, err)
+	}
+
+	return revisions, metadata, nil
+}
+
+// GetRevision returns the book as it was at the given version
+func (b BookModel) GetRevision(ctx context.Context, id int64, version int32) (*BookRevision, error) {
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
+
+	revision, err := getRevision(ctx, b.DB, id, version)
+	if err != nil {
+		return nil, wrapError(ctx, err)
+	}
+
+	return revision, nil
+}
+
+// LastRevised returns when each of the books was last inserted, updated, deleted or restored, by id
+// the books in the trash are in it as well even when they weren't asked for, so a list that lost a book can tell it changed
+func (b BookModel) LastRevised(ctx context.Context, ids []int64) (map[int64]time.Time, error) {
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
+
+	revised, err := lastRevised(ctx, b.DB, "= ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, wrapError(ctx, err)
+	}
+
+	return revised, nil
+}
+
+// GetTrash returns one page of the books in the trash, the most recently trashed first
+func (b BookModel) GetTrash(ctx context.Context, filters Filters) ([]*Book, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), id, created_at, title, author, published, pages, genres, rating, isbn, version, deleted_at
 	FROM books
-	ORDER BY id
-	`
+	WHERE deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id ASC
+	LIMIT $1 OFFSET $2`
+
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, wrapError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+
+		err := rows.Scan(
+			&totalRecords,
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Published,
+			&book.Pages,
+			pq.Array(&book.Genres),
+			&book.Rating,
+			&book.ISBN,
+			&book.Version,
+			&book.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, wrapError(ctx, err)
+		}
+
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, wrapError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 
-	rows, err := b.DB.Query(query)
+	return books, metadata, nil
+}
+
+// PurgeTrash permanently deletes every book that was put in the trash before the given time
+// it returns how many books were deleted
+func (b BookModel) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+	DELETE FROM books
+	WHERE deleted_at IS NOT NULL AND deleted_at < $1`
+
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
+
+	results, err := b.DB.ExecContext(ctx, query, before)
 	if err != nil {
-		return nil, err
+		return 0, wrapError(ctx, err)
+	}
+
+	return results.RowsAffected()
+}
+
+// wrapError turns the errors that callers need to tell apart into the sentinel errors
+// a query that ran past its deadline becomes ErrQueryTimeout and a postgres unique_violation becomes ErrDuplicate
+// every other error is passed through as it is
+func wrapError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrQueryTimeout
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrDuplicate
+	}
+
+	return err
+}
+
+// BookFilters holds everything a client can narrow the book list down with
+// the zero value of each field means "don't filter on this"
+type BookFilters struct {
+	Title        string
+	Author       string
+	Genres       []string
+	GenresMatch  string //"all" means the book has to have every genre, "any" means at least one of them
+	PublishedMin int
+	PublishedMax int
+	RatingMin    float32
+	Filters
+}
+
+// ValidateBookFilters checks the book specific filters and then the paging and sorting values
+func ValidateBookFilters(v *validator.Validator, f BookFilters) {
+	v.Check(validator.PermittedValue(f.GenresMatch, "all", "any"), "genres_match", "must be either all or any")
+	v.Check(f.PublishedMin == 0 || f.PublishedMax == 0 || f.PublishedMin <= f.PublishedMax, "published_min", "must not be greater than published_max")
+	v.Check(f.RatingMin >= 0 && f.RatingMin <= 5, "rating_min", "must be between 0 and 5")
+
+	ValidateFilters(v, f.Filters)
+}
+
+// genresOperator picks the postgres array operator for the genres filter
+// @> is "contains all of" and && is "overlaps with" (has any of)
+func (f BookFilters) genresOperator() string {
+	if f.GenresMatch == "any" {
+		return "&&"
+	}
+
+	return "@>"
+}
+
+// likeEscaper escapes the title and author filters for LIKE ... ESCAPE '\', so a % or _ a client searches for
+// matches that character instead of acting as a wildcard (?title=_ would otherwise match every book)
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// where returns the WHERE clause for the filters and its arguments, which are always $1 to $6
+// each filter is skipped when its argument is the zero value, and books in the trash are always left out
+// the genres operator is interpolated, which is safe because it is one of two fixed values
+func (f BookFilters) where() (string, []any) {
+	where := fmt.Sprintf(`deleted_at IS NULL
+	AND (title ILIKE '%%' || $1 || '%%' ESCAPE '\' OR $1 = '')
+	AND (author ILIKE '%%' || $2 || '%%' ESCAPE '\' OR $2 = '')
+	AND (genres %s $3 OR $3 = '{}')
+	AND (published >= $4 OR $4 = 0)
+	AND (published <= $5 OR $5 = 0)
+	AND (rating >= $6 OR $6 = 0)`, f.genresOperator())
+
+	args := []any{
+		likeEscaper.Replace(f.Title),
+		likeEscaper.Replace(f.Author),
+		pq.Array(f.Genres),
+		f.PublishedMin,
+		f.PublishedMax,
+		f.RatingMin,
+	}
+
+	return where, args
+}
+
+// GetAll takes in the filters from the query string and returns one page of matching books
+// it also returns the metadata so the client knows how many pages there are in total
+func (b BookModel) GetAll(ctx context.Context, filters BookFilters) ([]*Book, Metadata, error) {
+	//the sort column and direction are interpolated because they can't be positional arguments
+	//this is safe because they only ever come from the safelist
+	//count(*) OVER() adds the total number of matching rows (ignoring LIMIT and OFFSET) to every row
+	where, args := filters.where()
+
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, title, author, published, pages, genres, rating, isbn, version
+	FROM books
+	WHERE %s
+	ORDER BY %s %s, id ASC
+	LIMIT $7 OFFSET $8`, where, filters.sortColumn(), filters.sortDirection())
+
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
+
+	rows, err := b.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, wrapError(ctx, err)
 	}
 	//the code below ends the database search when there are no more rows to find
 	defer rows.Close()
 
+	totalRecords := 0
 	books := []*Book{} //this variable is a slice containing books of type Book
 
 	//below convets the database record into an object
@@ -156,6 +735,7 @@ func (b BookModel) GetAll() ([]*Book, error) {
 		var book Book
 
 		err := rows.Scan(
+			&totalRecords,
 			&book.ID,
 			&book.CreatedAt,
 			&book.Title,
@@ -168,7 +748,7 @@ func (b BookModel) GetAll() ([]*Book, error) {
 			&book.Version,
 		)
 		if err != nil {
-			return nil, err
+			return nil, Metadata{}, wrapError(ctx, err)
 		}
 
 		//the book object is then added to the books variable
@@ -176,7 +756,210 @@ func (b BookModel) GetAll() ([]*Book, error) {
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, err
+		return nil, Metadata{}, wrapError(ctx, err)
 	}
-	return books, nil
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return books, metadata, nil
+}
+
+// exportBatchSize is how many books Export reads with each query
+// it is a var so the tests can make it small enough for a handful of books to take several batches
+var exportBatchSize = 500
+
+// Export calls fn with every book that matches the filters, in the order of the filters' sort, ignoring the paging
+// the books are read in batches (see exportBatches), so memory use stays the same however big the library is
+// and the connection goes back to the pool between batches, so a slow client doesn't hold on to it for the whole download
+// an error from fn stops the export and is returned as it is
+func (b BookModel) Export(ctx context.Context, filters BookFilters, fn func(book *Book) error) error {
+	return exportBatches(ctx, filters, fn, func(ctx context.Context, after *Book) ([]*Book, error) {
+		where, args := filters.where()
+		if after != nil {
+			where += " AND " + filters.after(7, 8)
+			args = append(args, after.sortValue(filters.sortColumn()), after.ID)
+		}
+
+		query := fmt.Sprintf(`
+		SELECT id, created_at, title, author, published, pages, genres, rating, isbn, version
+		FROM books
+		WHERE %s
+		ORDER BY %s %s, id ASC
+		LIMIT %d`, where, filters.sortColumn(), filters.sortDirection(), exportBatchSize)
+
+		ctx, cancel := b.queryContext(ctx)
+		defer cancel()
+
+		rows, err := b.DB.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, wrapError(ctx, err)
+		}
+		defer rows.Close()
+
+		books := []*Book{}
+
+		for rows.Next() {
+			var book Book
+
+			err := rows.Scan(
+				&book.ID,
+				&book.CreatedAt,
+				&book.Title,
+				&book.Author,
+				&book.Published,
+				&book.Pages,
+				pq.Array(&book.Genres),
+				&book.Rating,
+				&book.ISBN,
+				&book.Version,
+			)
+			if err != nil {
+				return nil, wrapError(ctx, err)
+			}
+
+			books = append(books, &book)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, wrapError(ctx, err)
+		}
+
+		return books, nil
+	})
+}
+
+// exportBatches runs an export one batch at a time: batch reads the next exportBatchSize books after the last one it was given
+// (nil for the first batch), with its own QueryTimeout, and its rows are closed before fn sees any of them
+// each batch carries on from where the last one stopped (keyset paging rather than OFFSET), so books added or trashed part way through don't shift the rest
+func exportBatches(ctx context.Context, filters BookFilters, fn func(book *Book) error, batch func(ctx context.Context, after *Book) ([]*Book, error)) error {
+	var after *Book
+
+	for {
+		books, err := batch(ctx, after)
+		if err != nil {
+			return err
+		}
+
+		for _, book := range books {
+			if err := fn(book); err != nil {
+				return err
+			}
+		}
+
+		if len(books) < exportBatchSize {
+			return nil
+		}
+
+		after = books[len(books)-1]
+	}
+}
+
+// after is the WHERE condition for the books that come after a book in the filters' sort, the same order as ORDER BY column, id ASC
+// key and id are the placeholder numbers for that book's sort value and id
+func (f Filters) after(key, id int) string {
+	op := ">"
+	if f.sortDirection() == "DESC" {
+		op = "<"
+	}
+
+	column := f.sortColumn()
+	if column == "id" {
+		return fmt.Sprintf("id %s $%d", op, id)
+	}
+
+	return fmt.Sprintf("(%s %s $%d OR (%s = $%d AND id > $%d))", column, op, key, column, key, id)
+}
+
+// sortValue is the book's value for one of the columns on the books sort safelist
+func (book *Book) sortValue(column string) any {
+	switch column {
+	case "title":
+		return book.Title
+	case "author":
+		return book.Author
+	case "published":
+		return book.Published
+	case "pages":
+		return book.Pages
+	case "rating":
+		return book.Rating
+	case "created_at":
+		return book.CreatedAt
+	default:
+		return book.ID
+	}
+}
+
+// Search does a full-text search across the title, author, genres and isbn of every book
+// the query supports "quoted phrases" and prefix* matching (see buildTSQuery)
+// the results are ordered by relevance, best match first, and paged with the filters
+func (b BookModel) Search(ctx context.Context, q string, filters Filters) ([]*SearchResult, Metadata, error) {
+	tsquery := buildTSQuery(q)
+	if tsquery == "" {
+		return []*SearchResult{}, Metadata{}, nil
+	}
+
+	//search_vector is a generated column with a GIN index on it (see setup.sql)
+	//the title is weighted highest so a hit in the title ranks above a hit in the genres
+	//ts_headline marks the matching words to build the snippet, and snippetHTML turns the marks into <mark> tags after escaping the text
+	//any marker characters already in the text are taken out first, so a title can't open or close a highlight of its own
+	query := `
+	SELECT count(*) OVER(), id, created_at, title, author, published, pages, genres, rating, isbn, version,
+		ts_rank(search_vector, query) AS rank,
+		ts_headline('simple', translate(concat_ws(' - ', title, author, books_genres_text(genres)), $4, ''), query, $5)
+	FROM books, to_tsquery('simple', $1) query
+	WHERE search_vector @@ query AND deleted_at IS NULL
+	ORDER BY rank DESC, id ASC
+	LIMIT $2 OFFSET $3`
+
+	ctx, cancel := b.queryContext(ctx)
+	defer cancel()
+
+	markers := snippetStart + snippetStop
+	options := "StartSel=" + snippetStart + ", StopSel=" + snippetStop + ", HighlightAll=true"
+
+	rows, err := b.DB.QueryContext(ctx, query, tsquery, filters.limit(), filters.offset(), markers, options)
+	if err != nil {
+		return nil, Metadata{}, wrapError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	results := []*SearchResult{}
+
+	for rows.Next() {
+		var book Book
+		var result SearchResult
+
+		err := rows.Scan(
+			&totalRecords,
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Published,
+			&book.Pages,
+			pq.Array(&book.Genres),
+			&book.Rating,
+			&book.ISBN,
+			&book.Version,
+			&result.Rank,
+			&result.Snippet,
+		)
+		if err != nil {
+			return nil, Metadata{}, wrapError(ctx, err)
+		}
+
+		result.Snippet = snippetHTML(result.Snippet)
+		result.Book = &book
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, wrapError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return results, metadata, nil
 }
@@ -0,0 +1,544 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"readinglist/internal/isbn"
+)
+
+// MemoryBookModel keeps the books in a map instead of a database
+// it behaves the same as BookModel (ids, versions, not found and edit conflicts) so the api can run without postgres,
+// which is handy for working on the frontend and for testing handlers
+// nothing is saved when the program stops
+type MemoryBookModel struct {
+	mu        sync.RWMutex //the handlers run concurrently, so every read and write of the map goes through this lock
+	books     map[int64]*Book
+	revisions map[int64][]*BookRevision //the revisions of each book, oldest first
+	nextID    int64
+}
+
+// NewMemoryBookModel returns an empty in-memory book store
+func NewMemoryBookModel() *MemoryBookModel {
+	return &MemoryBookModel{
+		books:     make(map[int64]*Book),
+		revisions: make(map[int64][]*BookRevision),
+		nextID:    1,
+	}
+}
+
+// copyBook makes a copy of the book, including its genres
+// the store never hands out or keeps a pointer the caller has, otherwise changing a book outside the store would change it inside too
+func copyBook(book *Book) *Book {
+	c := *book
+	c.Genres = append([]string(nil), book.Genres...)
+	if book.DeletedAt != nil {
+		deletedAt := *book.DeletedAt
+		c.DeletedAt = &deletedAt
+	}
+	return &c
+}
+
+// WithTx holds the write lock while fn runs, so nothing else can see the changes until they are all made
+// the maps are copied first and put back if fn fails, which is the in-memory version of a rollback
+// this works because a stored book is never changed in place, a changed book always replaces the old one in the map
+func (m *MemoryBookModel) WithTx(ctx context.Context, fn func(tx BookTx) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	books := make(map[int64]*Book, len(m.books))
+	for id, book := range m.books {
+		books[id] = book
+	}
+	revisions := make(map[int64][]*BookRevision, len(m.revisions))
+	for id, rs := range m.revisions {
+		revisions[id] = rs
+	}
+	nextID := m.nextID
+
+	if err := fn(memoryBookTx{m}); err != nil {
+		m.books, m.revisions, m.nextID = books, revisions, nextID
+		return err
+	}
+
+	return nil
+}
+
+// Insert gives the book the next id, a created time and version 1, the same as the database defaults
+func (m *MemoryBookModel) Insert(ctx context.Context, book *Book) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return memoryBookTx{m}.Insert(ctx, book)
+}
+
+func (m *MemoryBookModel) Get(ctx context.Context, id int64) (*Book, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return memoryBookTx{m}.Get(ctx, id)
+}
+
+// Update only saves the book if the version matches the stored one, just like the WHERE version = $9 in BookModel.Update
+func (m *MemoryBookModel) Update(ctx context.Context, book *Book) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return memoryBookTx{m}.Update(ctx, book)
+}
+
+// Delete moves the book to the trash, see BookModel.Delete
+func (m *MemoryBookModel) Delete(ctx context.Context, id int64, version int32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return memoryBookTx{m}.Delete(ctx, id, version)
+}
+
+// memoryBookTx makes the changes for MemoryBookModel; whoever calls its methods has to hold the lock
+type memoryBookTx struct {
+	m *MemoryBookModel
+}
+
+func (t memoryBookTx) Insert(ctx context.Context, book *Book) error {
+	if t.m.isbnTaken(book) {
+		return ErrDuplicate
+	}
+
+	book.ID = t.m.nextID
+	book.CreatedAt = time.Now().Truncate(time.Second) //the database column only stores whole seconds
+	book.Version = 1
+
+	t.m.books[book.ID] = copyBook(book)
+	t.m.record(ctx, book, "insert")
+	t.m.nextID++
+
+	return nil
+}
+
+func (t memoryBookTx) Get(ctx context.Context, id int64) (*Book, error) {
+	book, ok := t.m.books[id]
+	if !ok || book.DeletedAt != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return copyBook(book), nil
+}
+
+func (t memoryBookTx) Update(ctx context.Context, book *Book) error {
+	stored, ok := t.m.books[book.ID]
+	if !ok || stored.DeletedAt != nil || stored.Version != book.Version {
+		return ErrEditConflict
+	}
+	if t.m.isbnTaken(book) {
+		return ErrDuplicate
+	}
+
+	book.Version++
+	t.m.books[book.ID] = copyBook(book)
+	t.m.record(ctx, book, "update")
+
+	return nil
+}
+
+func (t memoryBookTx) Delete(ctx context.Context, id int64, version int32) error {
+	stored, ok := t.m.books[id]
+	switch {
+	case version != 0 && (!ok || stored.DeletedAt != nil || stored.Version != version):
+		return ErrEditConflict
+	case !ok || stored.DeletedAt != nil:
+		return ErrRecordNotFound
+	}
+
+	book := copyBook(stored)
+	now := time.Now().Truncate(time.Second)
+	book.DeletedAt = &now
+	book.Version++
+
+	t.m.books[id] = book
+	t.m.record(ctx, book, "delete")
+
+	return nil
+}
+
+func (m *MemoryBookModel) GetByISBN(ctx context.Context, number string) (*Book, error) {
+	canonical, err := isbn.To13(number)
+	if err != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	for _, book := range m.all() {
+		if isbn13(book) == canonical {
+			return book, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// isbnTaken does the job of the unique index on isbn13: it is true when another book that isn't in the trash has the same ISBN
+// whoever calls it has to hold the lock
+func (m *MemoryBookModel) isbnTaken(book *Book) bool {
+	canonical := isbn13(book)
+	if canonical == nil {
+		return false
+	}
+
+	for id, other := range m.books {
+		if id != book.ID && other.DeletedAt == nil && isbn13(other) == canonical {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *MemoryBookModel) GetMany(ctx context.Context, ids []int64) ([]*Book, error) {
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	books := []*Book{}
+	for _, book := range m.all() {
+		if wanted[book.ID] {
+			books = append(books, book)
+		}
+	}
+
+	return books, nil
+}
+
+func (m *MemoryBookModel) Genres(ctx context.Context) ([]*Genre, error) {
+	counts := map[string]int{}
+	for _, book := range m.all() {
+		for _, genre := range book.Genres {
+			counts[genre]++
+		}
+	}
+
+	genres := make([]*Genre, 0, len(counts))
+	for name, books := range counts {
+		genres = append(genres, &Genre{Name: name, Books: books})
+	}
+
+	sort.Slice(genres, func(i, j int) bool {
+		a, b := strings.ToLower(genres[i].Name), strings.ToLower(genres[j].Name)
+		if a != b {
+			return a < b
+		}
+		return genres[i].Name < genres[j].Name
+	})
+
+	return genres, nil
+}
+
+func (m *MemoryBookModel) DeletePermanently(ctx context.Context, id int64, version int32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.books[id]
+	switch {
+	case version != 0 && (!ok || stored.Version != version):
+		return ErrEditConflict
+	case !ok:
+		return ErrRecordNotFound
+	}
+
+	delete(m.books, id)
+	delete(m.revisions, id)
+
+	return nil
+}
+
+func (m *MemoryBookModel) Restore(ctx context.Context, id int64) (*Book, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stored, ok := m.books[id]
+	if !ok || stored.DeletedAt == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	book := copyBook(stored)
+	book.DeletedAt = nil
+	book.Version++
+
+	//the same ISBN may have been added again while the book was in the trash
+	if m.isbnTaken(book) {
+		return nil, ErrDuplicate
+	}
+
+	m.books[id] = book
+	m.record(ctx, book, "restore")
+
+	return copyBook(book), nil
+}
+
+// GetTrash returns the trashed books with the most recently trashed first, the same as BookModel.GetTrash
+func (m *MemoryBookModel) GetTrash(ctx context.Context, filters Filters) ([]*Book, Metadata, error) {
+	m.mu.RLock()
+	books := []*Book{}
+	for _, book := range m.books {
+		if book.DeletedAt != nil {
+			books = append(books, copyBook(book))
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(books, func(i, j int) bool {
+		if !books[i].DeletedAt.Equal(*books[j].DeletedAt) {
+			return books[i].DeletedAt.After(*books[j].DeletedAt)
+		}
+		return books[i].ID < books[j].ID
+	})
+
+	metadata := calculateMetadata(len(books), filters.Page, filters.PageSize)
+
+	return paginate(books, filters), metadata, nil
+}
+
+func (m *MemoryBookModel) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var purged int64
+	for id, book := range m.books {
+		if book.DeletedAt != nil && book.DeletedAt.Before(before) {
+			delete(m.books, id)
+			delete(m.revisions, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// GetAll applies the same filters, sorting and paging as the SQL in BookModel.GetAll
+func (m *MemoryBookModel) GetAll(ctx context.Context, filters BookFilters) ([]*Book, Metadata, error) {
+	books := []*Book{}
+	for _, book := range m.all() {
+		if filters.matches(book) {
+			books = append(books, book)
+		}
+	}
+
+	sortBooks(books, filters.Filters)
+
+	metadata := calculateMetadata(len(books), filters.Page, filters.PageSize)
+
+	return paginate(books, filters.Filters), metadata, nil
+}
+
+// Export calls fn with the matching books; they are copied out of the store first so fn can take as long as it likes without holding the lock
+func (m *MemoryBookModel) Export(ctx context.Context, filters BookFilters, fn func(book *Book) error) error {
+	books := []*Book{}
+	for _, book := range m.all() {
+		if filters.matches(book) {
+			books = append(books, book)
+		}
+	}
+
+	sortBooks(books, filters.Filters)
+
+	for _, book := range books {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if err := fn(book); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryBookModel) Search(ctx context.Context, q string, filters Filters) ([]*SearchResult, Metadata, error) {
+	results, metadata := searchBooks(m.all(), q, filters)
+	return results, metadata, nil
+}
+
+// record saves a revision of the book; the caller has to hold the write lock
+func (m *MemoryBookModel) record(ctx context.Context, book *Book, operation string) {
+	m.revisions[book.ID] = append(m.revisions[book.ID], &BookRevision{
+		BookID:    book.ID,
+		Version:   book.Version,
+		Operation: operation,
+		Actor:     actorFromContext(ctx),
+		CreatedAt: time.Now().Truncate(time.Second),
+		Book:      copyBook(book),
+	})
+}
+
+// History returns the revisions of the book newest first, the same as BookModel.History
+func (m *MemoryBookModel) History(ctx context.Context, id int64, filters Filters) ([]*BookRevision, Metadata, error) {
+	m.mu.RLock()
+	stored := m.revisions[id]
+	revisions := make([]*BookRevision, len(stored))
+	for i, revision := range stored {
+		c := *revision
+		c.Book = copyBook(revision.Book)
+		revisions[len(stored)-1-i] = &c
+	}
+	m.mu.RUnlock()
+
+	metadata := calculateMetadata(len(revisions), filters.Page, filters.PageSize)
+
+	return paginate(revisions, filters), metadata, nil
+}
+
+func (m *MemoryBookModel) GetRevision(ctx context.Context, id int64, version int32) (*BookRevision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, revision := range m.revisions[id] {
+		if revision.Version == version {
+			c := *revision
+			c.Book = copyBook(revision.Book)
+			return &c, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// LastRevised returns when each of the books was last changed, the same as BookModel.LastRevised
+func (m *MemoryBookModel) LastRevised(ctx context.Context, ids []int64) (map[int64]time.Time, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	revised := make(map[int64]time.Time)
+
+	add := func(id int64) {
+		if revisions := m.revisions[id]; len(revisions) > 0 {
+			revised[id] = revisions[len(revisions)-1].CreatedAt
+		}
+	}
+
+	for _, id := range ids {
+		add(id)
+	}
+	for id, book := range m.books {
+		if book.DeletedAt != nil {
+			add(id)
+		}
+	}
+
+	return revised, nil
+}
+
+// all returns a copy of every book that isn't in the trash, ordered by id
+func (m *MemoryBookModel) all() []*Book {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	books := make([]*Book, 0, len(m.books))
+	for _, book := range m.books {
+		if book.DeletedAt == nil {
+			books = append(books, copyBook(book))
+		}
+	}
+
+	sort.Slice(books, func(i, j int) bool { return books[i].ID < books[j].ID })
+
+	return books
+}
+
+// matches reports whether the book passes every filter that is set
+// it is the go version of the WHERE clause in BookModel.GetAll
+func (f BookFilters) matches(book *Book) bool {
+	if f.Title != "" && !strings.Contains(strings.ToLower(book.Title), strings.ToLower(f.Title)) {
+		return false
+	}
+
+	if f.Author != "" && !strings.Contains(strings.ToLower(book.Author), strings.ToLower(f.Author)) {
+		return false
+	}
+
+	if len(f.Genres) > 0 {
+		has := make(map[string]bool, len(book.Genres))
+		for _, genre := range book.Genres {
+			has[genre] = true
+		}
+
+		found := 0
+		for _, genre := range f.Genres {
+			if has[genre] {
+				found++
+			}
+		}
+
+		if f.GenresMatch == "any" && found == 0 {
+			return false
+		}
+		if f.GenresMatch != "any" && found < len(f.Genres) {
+			return false
+		}
+	}
+
+	if f.PublishedMin != 0 && book.Published < f.PublishedMin {
+		return false
+	}
+
+	if f.PublishedMax != 0 && book.Published > f.PublishedMax {
+		return false
+	}
+
+	if f.RatingMin != 0 && book.Rating < f.RatingMin {
+		return false
+	}
+
+	return true
+}
+
+// sortBooks sorts by the column in the filters and then by id, the same as ORDER BY %s %s, id ASC
+func sortBooks(books []*Book, f Filters) {
+	column := f.sortColumn()
+	descending := f.sortDirection() == "DESC"
+
+	sort.SliceStable(books, func(i, j int) bool {
+		c := compareBooks(books[i], books[j], column)
+		if c == 0 {
+			return books[i].ID < books[j].ID
+		}
+		if descending {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// compareBooks returns -1, 0 or 1 depending on how the two books compare on the column
+func compareBooks(a, b *Book, column string) int {
+	compare := func(x, y float64) int {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	switch column {
+	case "title":
+		return strings.Compare(a.Title, b.Title)
+	case "author":
+		return strings.Compare(a.Author, b.Author)
+	case "published":
+		return compare(float64(a.Published), float64(b.Published))
+	case "pages":
+		return compare(float64(a.Pages), float64(b.Pages))
+	case "rating":
+		return compare(float64(a.Rating), float64(b.Rating))
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	default:
+		return compare(float64(a.ID), float64(b.ID))
+	}
+}
@@ -0,0 +1,797 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"readinglist/internal/isbn"
+)
+
+// SQLiteBookModel keeps the books in a SQLite database file
+// it is meant for running the reading list on a laptop or small server where postgres would be overkill
+// the driver is pure go (no cgo) so the program still cross-compiles
+// SQLite has no array type, so the genres are stored as a JSON array in a text column
+// the tables are created by the SQL files in migrations/sqlite
+type SQLiteBookModel struct {
+	dbModel
+}
+
+// genresJSON stores a slice of genres as a JSON array and reads it back again
+// it implements driver.Valuer for writing and sql.Scanner for reading
+type genresJSON struct {
+	genres *[]string
+}
+
+func (g genresJSON) Value() (driver.Value, error) {
+	if *g.genres == nil {
+		return "[]", nil
+	}
+
+	js, err := json.Marshal(*g.genres)
+	return string(js), err
+}
+
+func (g genresJSON) Scan(src any) error {
+	var js []byte
+
+	switch v := src.(type) {
+	case string:
+		js = []byte(v)
+	case []byte:
+		js = v
+	case nil:
+		*g.genres = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into genres", src)
+	}
+
+	return json.Unmarshal(js, g.genres)
+}
+
+// sqliteError does the same job as wrapError does for postgres
+func sqliteError(ctx context.Context, err error) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrQueryTimeout
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			return ErrDuplicate
+		}
+	}
+
+	return err
+}
+
+// WithTx runs fn in a transaction, see BookModel.WithTx
+// the pool only has one connection, so fn must only use tx or it will wait for the connection forever
+func (m SQLiteBookModel) WithTx(ctx context.Context, fn func(tx BookTx) error) error {
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return fn(sqliteBookTx{q: tx, model: m})
+	})
+}
+
+func (m SQLiteBookModel) Insert(ctx context.Context, book *Book) error {
+	return m.WithTx(ctx, func(tx BookTx) error {
+		return tx.Insert(ctx, book)
+	})
+}
+
+func (m SQLiteBookModel) Get(ctx context.Context, id int64) (*Book, error) {
+	return sqliteBookTx{q: m.DB, model: m}.Get(ctx, id)
+}
+
+// Update uses the same version check and saves the same revision as BookModel.Update
+func (m SQLiteBookModel) Update(ctx context.Context, book *Book) error {
+	return m.WithTx(ctx, func(tx BookTx) error {
+		return tx.Update(ctx, book)
+	})
+}
+
+// Delete moves the book to the trash, see BookModel.Delete
+func (m SQLiteBookModel) Delete(ctx context.Context, id int64, version int32) error {
+	return m.WithTx(ctx, func(tx BookTx) error {
+		return tx.Delete(ctx, id, version)
+	})
+}
+
+// sqliteBookTx is the SQLite version of bookTx
+type sqliteBookTx struct {
+	q     querier
+	model SQLiteBookModel
+}
+
+func (t sqliteBookTx) Insert(ctx context.Context, book *Book) error {
+	query := `
+	INSERT INTO books (title, author, published, pages, genres, rating, isbn, isbn13)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING id, created_at, version`
+
+	args := []interface{}{book.Title, book.Author, book.Published, book.Pages, genresJSON{&book.Genres}, book.Rating, book.ISBN, isbn13(book)}
+
+	ctx, cancel := t.model.queryContext(ctx)
+	defer cancel()
+
+	err := t.q.QueryRowContext(ctx, query, args...).Scan(&book.ID, &book.CreatedAt, &book.Version)
+	if err != nil {
+		return sqliteError(ctx, err)
+	}
+
+	if err := recordRevision(ctx, t.q, book, "insert"); err != nil {
+		return sqliteError(ctx, err)
+	}
+
+	return nil
+}
+
+func (t sqliteBookTx) Get(ctx context.Context, id int64) (*Book, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, title, author, published, pages, genres, rating, isbn, version
+	FROM books
+	WHERE id = $1 AND deleted_at IS NULL`
+
+	var book Book
+
+	ctx, cancel := t.model.queryContext(ctx)
+	defer cancel()
+
+	err := t.q.QueryRowContext(ctx, query, id).Scan(
+		&book.ID,
+		&book.CreatedAt,
+		&book.Title,
+		&book.Author,
+		&book.Published,
+		&book.Pages,
+		genresJSON{&book.Genres},
+		&book.Rating,
+		&book.ISBN,
+		&book.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, sqliteError(ctx, err)
+		}
+	}
+
+	return &book, nil
+}
+
+func (t sqliteBookTx) Update(ctx context.Context, book *Book) error {
+	query := `
+	UPDATE books
+	SET title = $1, author = $2, published = $3, pages = $4, genres = $5, rating = $6, isbn = $7, isbn13 = $8, version = version + 1
+	WHERE id = $9 AND version = $10 AND deleted_at IS NULL
+	RETURNING version`
+
+	args := []interface{}{book.Title, book.Author, book.Published, book.Pages, genresJSON{&book.Genres}, book.Rating, book.ISBN, isbn13(book), book.ID, book.Version}
+
+	ctx, cancel := t.model.queryContext(ctx)
+	defer cancel()
+
+	err := t.q.QueryRowContext(ctx, query, args...).Scan(&book.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return sqliteError(ctx, err)
+		}
+	}
+
+	if err := recordRevision(ctx, t.q, book, "update"); err != nil {
+		return sqliteError(ctx, err)
+	}
+
+	return nil
+}
+
+func (t sqliteBookTx) Delete(ctx context.Context, id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	query := `
+	UPDATE books
+	SET deleted_at = CURRENT_TIMESTAMP, version = version + 1
+	WHERE id = $1 AND deleted_at IS NULL AND (version = $2 OR $2 = 0)
+	RETURNING id, created_at, title, author, published, pages, genres, rating, isbn, version, deleted_at`
+
+	ctx, cancel := t.model.queryContext(ctx)
+	defer cancel()
+
+	var book Book
+
+	err := t.q.QueryRowContext(ctx, query, id, version).Scan(
+		&book.ID,
+		&book.CreatedAt,
+		&book.Title,
+		&book.Author,
+		&book.Published,
+		&book.Pages,
+		genresJSON{&book.Genres},
+		&book.Rating,
+		&book.ISBN,
+		&book.Version,
+		&book.DeletedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows) && version != 0:
+			return ErrEditConflict
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return sqliteError(ctx, err)
+		}
+	}
+
+	if err := recordRevision(ctx, t.q, &book, "delete"); err != nil {
+		return sqliteError(ctx, err)
+	}
+
+	return nil
+}
+
+// GetByISBN uses the same matching as BookModel.GetByISBN
+func (m SQLiteBookModel) GetByISBN(ctx context.Context, number string) (*Book, error) {
+	canonical, err := isbn.To13(number)
+	if err != nil {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	SELECT id, created_at, title, author, published, pages, genres, rating, isbn, version
+	FROM books
+	WHERE isbn13 = $1 AND deleted_at IS NULL`
+
+	var book Book
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err = m.DB.QueryRowContext(ctx, query, canonical).Scan(
+		&book.ID,
+		&book.CreatedAt,
+		&book.Title,
+		&book.Author,
+		&book.Published,
+		&book.Pages,
+		genresJSON{&book.Genres},
+		&book.Rating,
+		&book.ISBN,
+		&book.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, sqliteError(ctx, err)
+		}
+	}
+
+	return &book, nil
+}
+
+// GetMany returns the books with the ids, see BookModel.GetMany
+// the ids are sent as a json array because SQLite has no array type to bind them to
+func (m SQLiteBookModel) GetMany(ctx context.Context, ids []int64) ([]*Book, error) {
+	query := `
+	SELECT id, created_at, title, author, published, pages, genres, rating, isbn, version
+	FROM books
+	WHERE id IN (SELECT value FROM json_each($1)) AND deleted_at IS NULL
+	ORDER BY id`
+
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, string(idsJSON))
+	if err != nil {
+		return nil, sqliteError(ctx, err)
+	}
+	defer rows.Close()
+
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+
+		err := rows.Scan(
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Published,
+			&book.Pages,
+			genresJSON{&book.Genres},
+			&book.Rating,
+			&book.ISBN,
+			&book.Version,
+		)
+		if err != nil {
+			return nil, sqliteError(ctx, err)
+		}
+
+		books = append(books, &book)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, sqliteError(ctx, err)
+	}
+
+	return books, nil
+}
+
+// Genres returns the genres in use, see BookModel.Genres
+// json_each turns each book's genres array into rows, the same job unnest does in postgres
+func (m SQLiteBookModel) Genres(ctx context.Context) ([]*Genre, error) {
+	query := `
+	SELECT genre.value, count(*)
+	FROM books, json_each(books.genres) AS genre
+	WHERE books.deleted_at IS NULL
+	GROUP BY genre.value
+	ORDER BY lower(genre.value), genre.value`
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, sqliteError(ctx, err)
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+
+		if err := rows.Scan(&genre.Name, &genre.Books); err != nil {
+			return nil, sqliteError(ctx, err)
+		}
+
+		genres = append(genres, &genre)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, sqliteError(ctx, err)
+	}
+
+	return genres, nil
+}
+
+func (m SQLiteBookModel) DeletePermanently(ctx context.Context, id int64, version int32) error {
+	if id < 1 {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, `DELETE FROM books WHERE id = $1 AND (version = $2 OR $2 = 0)`, id, version)
+	if err != nil {
+		return sqliteError(ctx, err)
+	}
+
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case rowsAffected == 0 && version != 0:
+		return ErrEditConflict
+	case rowsAffected == 0:
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m SQLiteBookModel) Restore(ctx context.Context, id int64) (*Book, error) {
+	if id < 1 {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+	UPDATE books
+	SET deleted_at = NULL, version = version + 1
+	WHERE id = $1 AND deleted_at IS NOT NULL
+	RETURNING id, created_at, title, author, published, pages, genres, rating, isbn, version`
+
+	var book Book
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err := withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		err := tx.QueryRowContext(ctx, query, id).Scan(
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Published,
+			&book.Pages,
+			genresJSON{&book.Genres},
+			&book.Rating,
+			&book.ISBN,
+			&book.Version,
+		)
+		if err != nil {
+			return err
+		}
+
+		return recordRevision(ctx, tx, &book, "restore")
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, sqliteError(ctx, err)
+		}
+	}
+
+	return &book, nil
+}
+
+func (m SQLiteBookModel) History(ctx context.Context, id int64, filters Filters) ([]*BookRevision, Metadata, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	revisions, metadata, err := getRevisions(ctx, m.DB, id, filters)
+	if err != nil {
+		return nil, Metadata{}, sqliteError(ctx, err)
+	}
+
+	return revisions, metadata, nil
+}
+
+func (m SQLiteBookModel) GetRevision(ctx context.Context, id int64, version int32) (*BookRevision, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	revision, err := getRevision(ctx, m.DB, id, version)
+	if err != nil {
+		return nil, sqliteError(ctx, err)
+	}
+
+	return revision, nil
+}
+
+// LastRevised returns when each of the books was last changed, see BookModel.LastRevised
+// the ids are sent as a JSON array, the same as GetMany
+func (m SQLiteBookModel) LastRevised(ctx context.Context, ids []int64) (map[int64]time.Time, error) {
+	idsJSON, err := json.Marshal(ids)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	revised, err := lastRevised(ctx, m.DB, "IN (SELECT value FROM json_each($1))", string(idsJSON))
+	if err != nil {
+		return nil, sqliteError(ctx, err)
+	}
+
+	return revised, nil
+}
+
+func (m SQLiteBookModel) GetTrash(ctx context.Context, filters Filters) ([]*Book, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), id, created_at, title, author, published, pages, genres, rating, isbn, version, deleted_at
+	FROM books
+	WHERE deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id ASC
+	LIMIT $1 OFFSET $2`
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, sqliteError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+
+		err := rows.Scan(
+			&totalRecords,
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Published,
+			&book.Pages,
+			genresJSON{&book.Genres},
+			&book.Rating,
+			&book.ISBN,
+			&book.Version,
+			&book.DeletedAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, sqliteError(ctx, err)
+		}
+
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, sqliteError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return books, metadata, nil
+}
+
+// PurgeTrash permanently deletes the books trashed before the given time
+// deleted_at is written by CURRENT_TIMESTAMP in UTC, so datetime() is used to turn the time passed in into the same form before comparing
+func (m SQLiteBookModel) PurgeTrash(ctx context.Context, before time.Time) (int64, error) {
+	query := `
+	DELETE FROM books
+	WHERE deleted_at IS NOT NULL AND deleted_at < datetime($1)`
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	results, err := m.DB.ExecContext(ctx, query, before.UTC())
+	if err != nil {
+		return 0, sqliteError(ctx, err)
+	}
+
+	return results.RowsAffected()
+}
+
+// GetAll filters, sorts and pages the books the same way as BookModel.GetAll
+// the genres filter needs one json_each lookup per genre, so the WHERE clause is built up as it goes
+func (m SQLiteBookModel) GetAll(ctx context.Context, filters BookFilters) ([]*Book, Metadata, error) {
+	where, args := sqliteBookWhere(filters)
+
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), id, created_at, title, author, published, pages, genres, rating, isbn, version
+	FROM books
+	WHERE %s
+	ORDER BY %s %s, id ASC
+	LIMIT $%d OFFSET $%d`, where, filters.sortColumn(), filters.sortDirection(), len(args)+1, len(args)+2)
+
+	args = append(args, filters.limit(), filters.offset())
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, sqliteError(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+
+		err := rows.Scan(
+			&totalRecords,
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Published,
+			&book.Pages,
+			genresJSON{&book.Genres},
+			&book.Rating,
+			&book.ISBN,
+			&book.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, sqliteError(ctx, err)
+		}
+
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, sqliteError(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return books, metadata, nil
+}
+
+// Export reads the matching books in batches, see BookModel.Export
+// that matters even more here: there is only one connection in the pool, so nothing else could use the database while a slow client held it
+func (m SQLiteBookModel) Export(ctx context.Context, filters BookFilters, fn func(book *Book) error) error {
+	return exportBatches(ctx, filters, fn, func(ctx context.Context, after *Book) ([]*Book, error) {
+		where, args := sqliteBookWhere(filters)
+		if after != nil {
+			key := after.sortValue(filters.sortColumn())
+
+			//created_at is the text CURRENT_TIMESTAMP wrote, so it is compared as that text rather than as the driver's format for a time
+			if t, ok := key.(time.Time); ok {
+				key = t.UTC().Format(time.DateTime)
+			}
+
+			where += " AND " + filters.after(len(args)+1, len(args)+2)
+			args = append(args, key, after.ID)
+		}
+
+		query := fmt.Sprintf(`
+		SELECT id, created_at, title, author, published, pages, genres, rating, isbn, version
+		FROM books
+		WHERE %s
+		ORDER BY %s %s, id ASC
+		LIMIT %d`, where, filters.sortColumn(), filters.sortDirection(), exportBatchSize)
+
+		ctx, cancel := m.queryContext(ctx)
+		defer cancel()
+
+		rows, err := m.DB.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, sqliteError(ctx, err)
+		}
+		defer rows.Close()
+
+		books := []*Book{}
+
+		for rows.Next() {
+			var book Book
+
+			err := rows.Scan(
+				&book.ID,
+				&book.CreatedAt,
+				&book.Title,
+				&book.Author,
+				&book.Published,
+				&book.Pages,
+				genresJSON{&book.Genres},
+				&book.Rating,
+				&book.ISBN,
+				&book.Version,
+			)
+			if err != nil {
+				return nil, sqliteError(ctx, err)
+			}
+
+			books = append(books, &book)
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, sqliteError(ctx, err)
+		}
+
+		return books, nil
+	})
+}
+
+// sqliteBookWhere builds the WHERE clause and its arguments for the book filters
+// LIKE in SQLite already ignores case (for ASCII letters), so it does the same job as ILIKE in postgres
+// the title and author are escaped with likeEscaper the same way, so % and _ in them aren't wildcards
+func sqliteBookWhere(filters BookFilters) (string, []any) {
+	conditions := []string{"deleted_at IS NULL"} //books in the trash are never listed
+	args := []any{}
+
+	add := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filters.Title != "" {
+		add(`title LIKE '%%' || $%d || '%%' ESCAPE '\'`, likeEscaper.Replace(filters.Title))
+	}
+
+	if filters.Author != "" {
+		add(`author LIKE '%%' || $%d || '%%' ESCAPE '\'`, likeEscaper.Replace(filters.Author))
+	}
+
+	if len(filters.Genres) > 0 {
+		var genreConditions []string
+		for _, genre := range filters.Genres {
+			args = append(args, genre)
+			genreConditions = append(genreConditions, fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(books.genres) WHERE json_each.value = $%d)", len(args)))
+		}
+
+		joiner := " AND "
+		if filters.GenresMatch == "any" {
+			joiner = " OR "
+		}
+		conditions = append(conditions, "("+strings.Join(genreConditions, joiner)+")")
+	}
+
+	if filters.PublishedMin != 0 {
+		add("published >= $%d", filters.PublishedMin)
+	}
+
+	if filters.PublishedMax != 0 {
+		add("published <= $%d", filters.PublishedMax)
+	}
+
+	if filters.RatingMin != 0 {
+		add("rating >= $%d", filters.RatingMin)
+	}
+
+	return strings.Join(conditions, " AND "), args
+}
+
+// Search reads every book and matches them in go (see searchBooks), because SQLite has no tsvector
+// that is fine for the size of library a single person keeps
+func (m SQLiteBookModel) Search(ctx context.Context, q string, filters Filters) ([]*SearchResult, Metadata, error) {
+	query := `
+	SELECT id, created_at, title, author, published, pages, genres, rating, isbn, version
+	FROM books
+	WHERE deleted_at IS NULL
+	ORDER BY id`
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, Metadata{}, sqliteError(ctx, err)
+	}
+	defer rows.Close()
+
+	books := []*Book{}
+
+	for rows.Next() {
+		var book Book
+
+		err := rows.Scan(
+			&book.ID,
+			&book.CreatedAt,
+			&book.Title,
+			&book.Author,
+			&book.Published,
+			&book.Pages,
+			genresJSON{&book.Genres},
+			&book.Rating,
+			&book.ISBN,
+			&book.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, sqliteError(ctx, err)
+		}
+
+		books = append(books, &book)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, sqliteError(ctx, err)
+	}
+
+	results, metadata := searchBooks(books, q, filters)
+
+	return results, metadata, nil
+}
@@ -0,0 +1,238 @@
+package data
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// bookStores is every BookStore that can run without a server, so the tests can check they all behave the same
+var bookStores = []struct {
+	name   string
+	models func(t *testing.T) Models
+}{
+	{"memory", func(t *testing.T) Models { return NewMemoryModels() }},
+	{"sqlite", newSQLiteTestModels},
+}
+
+// insertBooks saves a book for each title and returns them with their ids; the rest of each book is the same
+func insertBooks(t *testing.T, store BookStore, titles ...string) []*Book {
+	t.Helper()
+
+	books := make([]*Book, len(titles))
+	for i, title := range titles {
+		books[i] = &Book{Title: title, Author: "Someone", Published: 2000, Pages: 100, Genres: []string{"fiction"}}
+		if err := store.Insert(context.Background(), books[i]); err != nil {
+			t.Fatalf("inserting %q: %v", title, err)
+		}
+	}
+	return books
+}
+
+func TestGetAllTitleIsNotAPattern(t *testing.T) {
+	tests := []struct {
+		title string
+		want  []string
+	}{
+		{"_", []string{"a_b"}},
+		{"%", []string{"100% Dune"}},
+		{`\`, []string{`back\slash`}},
+		{"a_b", []string{"a_b"}},
+		{"DUNE", []string{"100% Dune", "Dune"}},
+		{"", []string{"100% Dune", "Dune", "a_b", "axb", `back\slash`}},
+	}
+
+	for _, store := range bookStores {
+		t.Run(store.name, func(t *testing.T) {
+			models := store.models(t)
+			insertBooks(t, models.Books, "100% Dune", "Dune", "a_b", "axb", `back\slash`)
+
+			for _, tt := range tests {
+				filters := BookFilters{Title: tt.title, Filters: Filters{Page: 1, PageSize: 20, Sort: "title", SortSafelist: []string{"title"}}}
+
+				books, _, err := models.Books.GetAll(context.Background(), filters)
+				if err != nil {
+					t.Fatalf("GetAll(%q): %v", tt.title, err)
+				}
+
+				var got []string
+				for _, book := range books {
+					got = append(got, book.Title)
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("GetAll(title=%q) = %q, want %q", tt.title, got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestLastRevised(t *testing.T) {
+	for _, store := range bookStores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			models := store.models(t)
+			books := insertBooks(t, models.Books, "Dune", "Emma", "Ulysses")
+
+			books[0].Rating = 4
+			if err := models.Books.Update(ctx, books[0]); err != nil {
+				t.Fatal(err)
+			}
+			if err := models.Books.Delete(ctx, books[2].ID, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			revised, err := models.Books.LastRevised(ctx, []int64{books[0].ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			//Emma wasn't asked for, and Ulysses wasn't either but it is in the trash
+			if _, ok := revised[books[1].ID]; ok || len(revised) != 2 {
+				t.Fatalf("LastRevised = %v, want Dune and Ulysses", revised)
+			}
+
+			for _, book := range []*Book{books[0], books[2]} {
+				history, _, err := models.Books.History(ctx, book.ID, Filters{Page: 1, PageSize: 1})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if newest := history[0]; !revised[book.ID].Equal(newest.CreatedAt) || newest.Version != 2 {
+					t.Errorf("%s was last revised at %v, want version %d's %v", book.Title, revised[book.ID], newest.Version, newest.CreatedAt)
+				}
+			}
+		})
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	for _, store := range bookStores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			models := store.models(t)
+			books := insertBooks(t, models.Books, "Dune", "Emma", "Ulysses")
+
+			for _, book := range books[1:] {
+				if err := models.Books.Delete(ctx, book.ID, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			//nothing has been in the trash for an hour yet
+			if purged, err := models.Books.PurgeTrash(ctx, time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+				t.Fatalf("PurgeTrash(an hour ago) = %d, %v, want 0", purged, err)
+			}
+
+			if purged, err := models.Books.PurgeTrash(ctx, time.Now().Add(time.Minute)); err != nil || purged != 2 {
+				t.Fatalf("PurgeTrash(now) = %d, %v, want 2", purged, err)
+			}
+
+			if _, err := models.Books.Restore(ctx, books[1].ID); !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("Restore of a purged book = %v, want %v", err, ErrRecordNotFound)
+			}
+			if trash, _, err := models.Books.GetTrash(ctx, Filters{Page: 1, PageSize: 20}); err != nil || len(trash) != 0 {
+				t.Errorf("GetTrash = %d books, %v, want none", len(trash), err)
+			}
+
+			//the book that wasn't in the trash is left alone
+			if _, err := models.Books.Get(ctx, books[0].ID); err != nil {
+				t.Errorf("Get of the book that wasn't deleted: %v", err)
+			}
+		})
+	}
+}
+
+func TestRestoreTakenISBN(t *testing.T) {
+	for _, store := range bookStores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			models := store.models(t)
+
+			dune := &Book{Title: "Dune", Published: 1965, Pages: 412, Genres: []string{"sci-fi"}, ISBN: "0441172717"}
+			if err := models.Books.Insert(ctx, dune); err != nil {
+				t.Fatal(err)
+			}
+			if err := models.Books.Delete(ctx, dune.ID, 0); err != nil {
+				t.Fatal(err)
+			}
+
+			//the ISBN-13 of the same book, which is the same ISBN as far as the stores are concerned
+			again := &Book{Title: "Dune", Published: 1965, Pages: 412, Genres: []string{"sci-fi"}, ISBN: "9780441172719"}
+			if err := models.Books.Insert(ctx, again); err != nil {
+				t.Fatalf("a book in the trash shouldn't hold on to its ISBN: %v", err)
+			}
+
+			if _, err := models.Books.Restore(ctx, dune.ID); !errors.Is(err, ErrDuplicate) {
+				t.Fatalf("Restore = %v, want %v", err, ErrDuplicate)
+			}
+			if _, err := models.Books.Get(ctx, dune.ID); !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("the book was taken out of the trash even though restoring it failed: %v", err)
+			}
+
+			if err := models.Books.DeletePermanently(ctx, again.ID, 0); err != nil {
+				t.Fatal(err)
+			}
+			restored, err := models.Books.Restore(ctx, dune.ID)
+			if err != nil || restored.DeletedAt != nil {
+				t.Fatalf("Restore = %+v, %v once the ISBN was free again", restored, err)
+			}
+		})
+	}
+}
+
+func TestExportBatches(t *testing.T) {
+	//three batches and a bit, with titles that aren't in id order and the same author, year and created_at on every book
+	//so the id has to break the ties from one batch to the next
+	defer func(size int) { exportBatchSize = size }(exportBatchSize)
+	exportBatchSize = 2
+
+	sorts := []string{
+		"id", "title", "author", "published", "pages", "rating", "created_at",
+		"-id", "-title", "-author", "-published", "-pages", "-rating", "-created_at",
+	}
+
+	for _, store := range bookStores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			models := store.models(t)
+			books := insertBooks(t, models.Books, "Emma", "Dune", "Ulysses", "Beloved", "Dracula", "Middlemarch", "Persuasion")
+
+			books[3].Rating = 5
+			books[5].Rating = 5
+			if err := models.Books.Update(ctx, books[3]); err != nil {
+				t.Fatal(err)
+			}
+			if err := models.Books.Update(ctx, books[5]); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, sort := range sorts {
+				filters := BookFilters{Filters: Filters{Page: 1, PageSize: 100, Sort: sort, SortSafelist: sorts}}
+
+				page, _, err := models.Books.GetAll(ctx, filters)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var want, got []int64
+				for _, book := range page {
+					want = append(want, book.ID)
+				}
+
+				err = models.Books.Export(ctx, filters, func(book *Book) error {
+					got = append(got, book.ID)
+					return nil
+				})
+				if err != nil {
+					t.Fatalf("Export(sort=%s): %v", sort, err)
+				}
+
+				if !slices.Equal(got, want) {
+					t.Errorf("Export(sort=%s) = %v, want the same as GetAll %v", sort, got, want)
+				}
+			}
+		})
+	}
+}
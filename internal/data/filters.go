@@ -0,0 +1,85 @@
+package data
+
+import (
+	"math"
+	"strings"
+
+	"readinglist/internal/validator"
+)
+
+// Filters holds the paging and sorting values that come in on the query string
+// it is embedded in the more specific filter types (like BookFilters) so every list endpoint pages the same way
+type Filters struct {
+	Page         int
+	PageSize     int
+	Sort         string
+	SortSafelist []string //these are the only values the client is allowed to sort by
+}
+
+// ValidateFilters checks the paging and sorting values before they get anywhere near a query
+// the sort value is interpolated into the SQL, so it has to be on the safelist
+func ValidateFilters(v *validator.Validator, f Filters) {
+	v.Check(f.Page > 0, "page", "must be greater than zero")
+	v.Check(f.Page <= 10_000_000, "page", "must be a maximum of 10 million")
+	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
+	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
+
+	//an empty safelist means the results have a fixed order (like search results ordered by rank)
+	if len(f.SortSafelist) > 0 {
+		v.Check(validator.PermittedValue(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	}
+}
+
+// sortColumn returns the column name to sort by with the "-" prefix stripped off
+// it panics if the value isn't on the safelist because that should have been caught by ValidateFilters
+func (f Filters) sortColumn() string {
+	for _, safeValue := range f.SortSafelist {
+		if f.Sort == safeValue {
+			return strings.TrimPrefix(f.Sort, "-")
+		}
+	}
+
+	panic("unsafe sort parameter: " + f.Sort)
+}
+
+// sortDirection turns the "-" prefix into a descending sort
+func (f Filters) sortDirection() string {
+	if strings.HasPrefix(f.Sort, "-") {
+		return "DESC"
+	}
+
+	return "ASC"
+}
+
+func (f Filters) limit() int {
+	return f.PageSize
+}
+
+func (f Filters) offset() int {
+	return (f.Page - 1) * f.PageSize
+}
+
+// Metadata is returned alongside a page of results so the client knows where it is in the full list
+type Metadata struct {
+	CurrentPage  int `json:"current_page,omitempty"`
+	PageSize     int `json:"page_size,omitempty"`
+	FirstPage    int `json:"first_page,omitempty"`
+	LastPage     int `json:"last_page,omitempty"`
+	TotalRecords int `json:"total_records,omitempty"`
+}
+
+// calculateMetadata works out the page numbers from the total number of matching records
+// an empty Metadata is returned when nothing matched so the fields are left out of the json
+func calculateMetadata(totalRecords, page, pageSize int) Metadata {
+	if totalRecords == 0 {
+		return Metadata{}
+	}
+
+	return Metadata{
+		CurrentPage:  page,
+		PageSize:     pageSize,
+		FirstPage:    1,
+		LastPage:     int(math.Ceil(float64(totalRecords) / float64(pageSize))),
+		TotalRecords: totalRecords,
+	}
+}
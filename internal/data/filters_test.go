@@ -0,0 +1,24 @@
+package data
+
+import "testing"
+
+func TestFiltersAfter(t *testing.T) {
+	safelist := []string{"id", "title", "-id", "-title"}
+
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"id", "id > $8"},
+		{"-id", "id < $8"},
+		{"title", "(title > $7 OR (title = $7 AND id > $8))"},
+		{"-title", "(title < $7 OR (title = $7 AND id > $8))"},
+	}
+
+	for _, tt := range tests {
+		f := Filters{Sort: tt.sort, SortSafelist: safelist}
+		if got := f.after(7, 8); got != tt.want {
+			t.Errorf("after with sort %s = %q, want %q", tt.sort, got, tt.want)
+		}
+	}
+}
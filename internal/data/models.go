@@ -1,18 +1,200 @@
 package data
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
 
 //this file is intended to encapsulate the different models being used
 
+// these are the errors the models hand back so callers can use errors.Is to decide what to do
+// an errors.New made somewhere else will never match, so always compare against these
+var (
+	// ErrRecordNotFound is returned when there is no record with the id that was asked for
+	ErrRecordNotFound = errors.New("record not found")
+
+	// ErrEditConflict is returned by Update when the version in the database no longer matches the version that was read
+	// that means someone else changed the record in between, so the update was not applied
+	ErrEditConflict = errors.New("edit conflict")
+
+	// ErrDuplicate is returned when an insert or update would break a unique constraint
+	ErrDuplicate = errors.New("duplicate record")
+
+	// ErrQueryTimeout is returned when a query was cancelled because it ran for longer than its timeout
+	// it is kept separate from other errors so the api can say "try again later" instead of "something broke"
+	ErrQueryTimeout = errors.New("query timeout")
+)
+
+// BookStore is everything the rest of the program needs from wherever the books are kept
+// BookModel keeps them in postgres, SQLiteBookModel keeps them in a SQLite file and MemoryBookModel keeps them in memory
+// they all have to behave the same: ids start at 1, Update checks the version, and missing books give ErrRecordNotFound
+//
+// Delete only moves a book to the trash; Get, GetAll and Search act as if trashed books don't exist
+// until they are brought back with Restore or removed for good with DeletePermanently or PurgeTrash
+//
+// every Insert, Update, Delete and Restore also saves a BookRevision (see History), tagged with the actor from WithActor
+type BookStore interface {
+	Insert(ctx context.Context, book *Book) error
+	Get(ctx context.Context, id int64) (*Book, error)
+	GetByISBN(ctx context.Context, isbn string) (*Book, error)
+	GetMany(ctx context.Context, ids []int64) ([]*Book, error)
+	Genres(ctx context.Context) ([]*Genre, error)
+	Update(ctx context.Context, book *Book) error
+	Delete(ctx context.Context, id int64, version int32) error
+	GetAll(ctx context.Context, filters BookFilters) ([]*Book, Metadata, error)
+	Export(ctx context.Context, filters BookFilters, fn func(book *Book) error) error
+	Search(ctx context.Context, q string, filters Filters) ([]*SearchResult, Metadata, error)
+
+	GetTrash(ctx context.Context, filters Filters) ([]*Book, Metadata, error)
+	Restore(ctx context.Context, id int64) (*Book, error)
+	DeletePermanently(ctx context.Context, id int64, version int32) error
+	PurgeTrash(ctx context.Context, before time.Time) (int64, error)
+
+	History(ctx context.Context, id int64, filters Filters) ([]*BookRevision, Metadata, error)
+	GetRevision(ctx context.Context, id int64, version int32) (*BookRevision, error)
+	LastRevised(ctx context.Context, ids []int64) (map[int64]time.Time, error)
+
+	WithTx(ctx context.Context, fn func(tx BookTx) error) error
+}
+
+// BookTx is what can be done to books inside BookStore.WithTx
+// the methods behave the same as the BookStore ones, but nothing is saved unless every change in the transaction is
+// only tx should be used inside fn; going back to the store itself could wait forever on the transaction's own lock
+type BookTx interface {
+	Insert(ctx context.Context, book *Book) error
+	Get(ctx context.Context, id int64) (*Book, error)
+	Update(ctx context.Context, book *Book) error
+	Delete(ctx context.Context, id int64, version int32) error
+}
+
+// UserStore is everything the rest of the program needs from wherever the users are kept
+// UserModel keeps them in postgres or SQLite and MemoryUserModel keeps them in memory
+type UserStore interface {
+	Insert(ctx context.Context, user *User) error
+	Get(ctx context.Context, id int64) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	GetForToken(ctx context.Context, scope, plaintext string) (*User, error)
+
+	WithTx(ctx context.Context, fn func(tx UserTx) error) error
+}
+
+// UserTx is what can be done inside UserStore.WithTx, which is everything signing a user up needs
+// the methods behave the same as UserStore.Insert, PermissionStore.AddForUser and TokenStore.New,
+// but a user is only saved along with its permissions and activation token, so a failed sign up leaves nothing behind
+type UserTx interface {
+	Insert(ctx context.Context, user *User) error
+	AddPermissions(ctx context.Context, userID int64, codes ...string) error
+	NewToken(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+}
+
+// TokenStore keeps the tokens that are sent to users, see Token
+type TokenStore interface {
+	New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error)
+	Insert(ctx context.Context, token *Token) error
+	DeleteAllForUser(ctx context.Context, scope string, userID int64) error
+	Delete(ctx context.Context, scope, plaintext string) error
+}
+
+// PermissionStore keeps which users have which permissions, see Permissions
+type PermissionStore interface {
+	GetAllForUser(ctx context.Context, userID int64) (Permissions, error)
+	AddForUser(ctx context.Context, userID int64, codes ...string) error
+	RemoveForUser(ctx context.Context, userID int64, codes ...string) error
+}
+
+// UserBookStore keeps each user's shelves, see UserBook
+// UserBookModel keeps them in postgres or SQLite and MemoryUserBookModel keeps them in memory
+type UserBookStore interface {
+	Insert(ctx context.Context, ub *UserBook) error
+	Get(ctx context.Context, userID, bookID int64) (*UserBook, error)
+	Update(ctx context.Context, ub *UserBook) error
+	Delete(ctx context.Context, userID, bookID int64) error
+	GetShelf(ctx context.Context, userID int64, filters ShelfFilters) ([]*UserBook, Metadata, error)
+}
+
+// ReadingSessionStore keeps the users' reading sessions, see ReadingSession
+// a session belongs to one user, so everything but Insert takes the user's id and ignores other users' sessions
+type ReadingSessionStore interface {
+	Insert(ctx context.Context, s *ReadingSession) error
+	Get(ctx context.Context, userID, id int64) (*ReadingSession, error)
+	Update(ctx context.Context, s *ReadingSession) error
+	Delete(ctx context.Context, userID, id int64) error
+	GetAllForBook(ctx context.Context, userID, bookID int64, filters Filters) ([]*ReadingSession, Metadata, error)
+	AllForBook(ctx context.Context, userID, bookID int64) ([]*ReadingSession, error)
+}
+
 type Models struct {
-	Books BookModel
+	Books       BookStore
+	Users       UserStore
+	Tokens      TokenStore
+	Permissions PermissionStore
+	UserBooks   UserBookStore
+	Sessions    ReadingSessionStore
+}
+
+// dbModel is what every model that keeps its rows in postgres or SQLite is built on, it is embedded in each of them
+// the user side models share their SQL between the two databases, so wrap is wrapError or sqliteError to turn the errors into the sentinel ones
+type dbModel struct {
+	DB           *sql.DB       //this is a pointer to the sql database connection
+	QueryTimeout time.Duration //how long a single query is allowed to run before it is cancelled
+	wrap         func(ctx context.Context, err error) error
+}
+
+// queryContext derives the context each query runs with from the one passed in (normally the request's context)
+// that way a query is cancelled when the client goes away, and also when it runs for longer than QueryTimeout
+func (m dbModel) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if m.QueryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, m.QueryTimeout)
 }
 
 // the function below just returns the model
-// it takes in a pointer to a SQL database
+// it takes in a pointer to a SQL database and how long each query is allowed to run for
 // this helps us connect to the database and then implement CRUD operations
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, queryTimeout time.Duration) Models {
+	m := dbModel{DB: db, QueryTimeout: queryTimeout, wrap: wrapError}
+
 	return Models{
-		Books: BookModel{DB: db},
+		Books:       BookModel{m},
+		Users:       UserModel{m},
+		Tokens:      TokenModel{m},
+		Permissions: PermissionModel{m},
+		UserBooks:   UserBookModel{m},
+		Sessions:    ReadingSessionModel{m},
+	}
+}
+
+// NewSQLiteModels returns models that keep everything in a SQLite database
+func NewSQLiteModels(db *sql.DB, queryTimeout time.Duration) Models {
+	m := dbModel{DB: db, QueryTimeout: queryTimeout, wrap: sqliteError}
+
+	return Models{
+		Books:       SQLiteBookModel{m},
+		Users:       UserModel{m},
+		Tokens:      TokenModel{m},
+		Permissions: PermissionModel{m},
+		UserBooks:   UserBookModel{m},
+		Sessions:    ReadingSessionModel{m},
+	}
+}
+
+// NewMemoryModels returns models that keep everything in memory, so no database is needed
+func NewMemoryModels() Models {
+	users := newMemoryUsers()
+	books := NewMemoryBookModel()
+
+	return Models{
+		Books:  books,
+		Users:  MemoryUserModel{s: users},
+		Tokens: MemoryTokenModel{s: users},
+
+		Permissions: MemoryPermissionModel{s: users},
+		UserBooks:   MemoryUserBookModel{s: users, books: books},
+		Sessions:    MemoryReadingSessionModel{s: users, books: books},
 	}
 }
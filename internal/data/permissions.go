@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+)
+
+// the permission codes, these are the rows of the permissions table
+const (
+	PermissionBooksRead  = "books:read"  //see the books, and everything made from them (search, exports, feeds, OPDS)
+	PermissionBooksWrite = "books:write" //add, change and delete books, and import them
+	PermissionAdmin      = "admin"       //grant and revoke permissions
+)
+
+// PermissionCodes is every permission there is, in the order they are listed
+var PermissionCodes = []string{PermissionBooksRead, PermissionBooksWrite, PermissionAdmin}
+
+// Permissions is the permission codes a user has
+type Permissions []string
+
+// Include reports whether code is one of the permissions
+func (p Permissions) Include(code string) bool {
+	return slices.Contains(p, code)
+}
+
+// ValidPermission reports whether code is one of PermissionCodes
+func ValidPermission(code string) bool {
+	return slices.Contains(PermissionCodes, code)
+}
+
+// PermissionModel keeps which users have which permissions
+type PermissionModel struct {
+	dbModel
+}
+
+// GetAllForUser returns the user's permissions sorted by code; a user without any gets an empty list, not an error
+func (m PermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	query := `
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
+	WHERE users_permissions.user_id = $1
+	ORDER BY permissions.code`
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, m.wrap(ctx, err)
+	}
+	defer rows.Close()
+
+	permissions := Permissions{}
+
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, m.wrap(ctx, err)
+		}
+		permissions = append(permissions, code)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, m.wrap(ctx, err)
+	}
+
+	return permissions, nil
+}
+
+// AddForUser grants the user the permissions; ones the user already has are left as they are
+// a code that isn't in the permissions table is skipped by the join, so check them with ValidPermission first
+func (m PermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	//the codes are added together or not at all
+	err := withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return userTx{q: tx, model: m.dbModel}.AddPermissions(ctx, userID, codes...)
+	})
+	if err != nil {
+		return m.wrap(ctx, err)
+	}
+
+	return nil
+}
+
+// RemoveForUser takes the permissions away from the user; ones the user doesn't have are not an error
+func (m PermissionModel) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	query := `
+	DELETE FROM users_permissions
+	WHERE user_id = $1 AND permission_id IN (SELECT id FROM permissions WHERE code = $2)`
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return m.wrap(ctx, err)
+	}
+	defer tx.Rollback()
+
+	for _, code := range codes {
+		if _, err := tx.ExecContext(ctx, query, userID, code); err != nil {
+			return m.wrap(ctx, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return m.wrap(ctx, err)
+	}
+
+	return nil
+}
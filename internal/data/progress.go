@@ -0,0 +1,96 @@
+package data
+
+import (
+	"math"
+	"time"
+)
+
+// recentPace is how far back the sessions that set the reader's current pace go;
+// the estimate should follow how fast someone is reading now, not how fast they read the first chapter months ago
+const recentPace = 14 * 24 * time.Hour
+
+// Progress is how far through a book a reader is, worked out from their reading sessions
+type Progress struct {
+	BookID             int64      `json:"book_id"`
+	Status             string     `json:"status,omitempty"` //the shelf the book is on, empty if it isn't on one
+	Pages              int        `json:"pages"`
+	CurrentPage        int        `json:"current_page"`
+	PercentComplete    float64    `json:"percent_complete"`
+	PagesRead          int        `json:"pages_read"` //every session added up, so pages read twice count twice
+	Sessions           int        `json:"sessions"`
+	MinutesRead        int        `json:"minutes_read"`
+	AveragePagesPerDay float64    `json:"average_pages_per_day"`
+	RecentPagesPerDay  float64    `json:"recent_pages_per_day"`
+	EstimatedFinish    *time.Time `json:"estimated_finish,omitempty"`
+}
+
+// CalculateProgress works out the progress from the sessions, ub is nil when the book isn't on the reader's shelves
+//
+// the current page is the furthest the reader has got in any session; a book on the read shelf is always 100%
+// the average pace is the pages read since the first session spread over the days since then,
+// the recent pace is the same for the last two weeks, and the estimate is the pages left at the recent pace
+// both paces count at least one day, so a single session today doesn't look like an impossibly fast reader
+func CalculateProgress(book *Book, ub *UserBook, sessions []*ReadingSession, now time.Time) Progress {
+	p := Progress{
+		BookID:   book.ID,
+		Pages:    book.Pages,
+		Sessions: len(sessions),
+	}
+	if ub != nil {
+		p.Status = ub.Status
+	}
+
+	var first time.Time
+	recentPages := 0
+
+	for _, s := range sessions {
+		p.CurrentPage = max(p.CurrentPage, s.EndPage)
+		p.PagesRead += s.PagesRead()
+		p.MinutesRead += s.DurationMinutes
+
+		if first.IsZero() || s.ReadAt.Before(first) {
+			first = s.ReadAt
+		}
+		if now.Sub(s.ReadAt) <= recentPace {
+			recentPages += s.PagesRead()
+		}
+	}
+
+	if p.Status == StatusRead {
+		p.CurrentPage = max(p.CurrentPage, book.Pages)
+	}
+
+	if book.Pages > 0 {
+		p.PercentComplete = roundTenth(100 * float64(min(p.CurrentPage, book.Pages)) / float64(book.Pages))
+	}
+
+	if len(sessions) == 0 {
+		return p
+	}
+
+	p.AveragePagesPerDay = roundTenth(float64(p.PagesRead) / days(now.Sub(first)))
+
+	recentSince := now.Sub(first)
+	if recentSince > recentPace {
+		recentSince = recentPace
+	}
+	recent := float64(recentPages) / days(recentSince)
+	p.RecentPagesPerDay = roundTenth(recent)
+
+	left := book.Pages - p.CurrentPage
+	if p.Status != StatusRead && book.Pages > 0 && left > 0 && recent > 0 {
+		finish := now.Add(time.Duration(float64(left) / recent * float64(24*time.Hour))).UTC().Truncate(time.Second)
+		p.EstimatedFinish = &finish
+	}
+
+	return p
+}
+
+// days turns a duration into a number of days, never less than one
+func days(d time.Duration) float64 {
+	return math.Max(1, d.Hours()/24)
+}
+
+func roundTenth(f float64) float64 {
+	return math.Round(f*10) / 10
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalculateProgress(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	daysAgo := func(n int) time.Time { return now.Add(-time.Duration(n) * 24 * time.Hour) }
+
+	session := func(start, end, minutes int, readAt time.Time) *ReadingSession {
+		return &ReadingSession{StartPage: start, EndPage: end, DurationMinutes: minutes, ReadAt: readAt}
+	}
+
+	book := &Book{ID: 7, Pages: 300}
+
+	tests := []struct {
+		name     string
+		book     *Book
+		ub       *UserBook
+		sessions []*ReadingSession
+		want     Progress
+		finish   time.Time //zero for no estimate
+	}{
+		{
+			name: "not started",
+			book: book,
+			want: Progress{BookID: 7, Pages: 300},
+		},
+		{
+			name: "part way through",
+			book: book,
+			ub:   &UserBook{Status: StatusReading},
+			sessions: []*ReadingSession{
+				session(100, 150, 30, daysAgo(1)),
+				session(50, 100, 40, daysAgo(10)),
+				session(0, 50, 45, daysAgo(20)),
+			},
+			want: Progress{
+				BookID: 7, Status: StatusReading, Pages: 300, CurrentPage: 150, PercentComplete: 50,
+				PagesRead: 150, Sessions: 3, MinutesRead: 115,
+				AveragePagesPerDay: 7.5, //150 pages over 20 days
+				RecentPagesPerDay:  7.1, //100 pages in the last 14 days
+			},
+			finish: now.Add(21 * 24 * time.Hour), //150 pages left at 100/14 a day
+		},
+		{
+			name:     "one session today counts as a whole day",
+			book:     book,
+			sessions: []*ReadingSession{session(0, 30, 0, now.Add(-time.Hour))},
+			want: Progress{
+				BookID: 7, Pages: 300, CurrentPage: 30, PercentComplete: 10,
+				PagesRead: 30, Sessions: 1, AveragePagesPerDay: 30, RecentPagesPerDay: 30,
+			},
+			finish: now.Add(9 * 24 * time.Hour),
+		},
+		{
+			name:     "nothing read recently has no estimate",
+			book:     book,
+			sessions: []*ReadingSession{session(0, 60, 0, daysAgo(30))},
+			want: Progress{
+				BookID: 7, Pages: 300, CurrentPage: 60, PercentComplete: 20,
+				PagesRead: 60, Sessions: 1, AveragePagesPerDay: 2,
+			},
+		},
+		{
+			name:     "read is always finished",
+			book:     book,
+			ub:       &UserBook{Status: StatusRead},
+			sessions: []*ReadingSession{session(0, 280, 0, daysAgo(2))},
+			want: Progress{
+				BookID: 7, Status: StatusRead, Pages: 300, CurrentPage: 300, PercentComplete: 100,
+				PagesRead: 280, Sessions: 1, AveragePagesPerDay: 140, RecentPagesPerDay: 140,
+			},
+		},
+		{
+			name:     "rereading a chapter doesn't move the current page back",
+			book:     &Book{ID: 7, Pages: 420},
+			sessions: []*ReadingSession{session(100, 120, 0, daysAgo(1)), session(0, 200, 0, daysAgo(2))},
+			want: Progress{
+				BookID: 7, Pages: 420, CurrentPage: 200, PercentComplete: 47.6,
+				PagesRead: 220, Sessions: 2, AveragePagesPerDay: 110, RecentPagesPerDay: 110,
+			},
+			finish: now.Add(2 * 24 * time.Hour), //220 pages left at 110 a day
+		},
+		{
+			name:     "no page count",
+			book:     &Book{ID: 8},
+			sessions: []*ReadingSession{session(0, 40, 0, daysAgo(1))},
+			want: Progress{
+				BookID: 8, CurrentPage: 40, PagesRead: 40, Sessions: 1, AveragePagesPerDay: 40, RecentPagesPerDay: 40,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CalculateProgress(tt.book, tt.ub, tt.sessions, now)
+
+			switch {
+			case tt.finish.IsZero() && got.EstimatedFinish != nil:
+				t.Errorf("EstimatedFinish = %v, want none", *got.EstimatedFinish)
+			case !tt.finish.IsZero() && (got.EstimatedFinish == nil || !got.EstimatedFinish.Equal(tt.finish)):
+				t.Errorf("EstimatedFinish = %v, want %v", got.EstimatedFinish, tt.finish)
+			}
+
+			got.EstimatedFinish = nil
+			if got != tt.want {
+				t.Errorf("CalculateProgress =\n%+v, want\n%+v", got, tt.want)
+			}
+		})
+	}
+}
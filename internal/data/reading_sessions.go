@@ -0,0 +1,228 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"readinglist/internal/validator"
+)
+
+// ReadingSession is one sitting with a book; StartPage and EndPage are where the reader picked it up and put it down,
+// so EndPage - StartPage is how many pages were read
+type ReadingSession struct {
+	ID              int64     `json:"id"`
+	UserID          int64     `json:"-"`
+	BookID          int64     `json:"book_id"`
+	StartPage       int       `json:"start_page"`
+	EndPage         int       `json:"end_page"`
+	DurationMinutes int       `json:"duration_minutes,omitempty"`
+	ReadAt          time.Time `json:"read_at"`
+	Version         int32     `json:"-"`
+}
+
+// PagesRead is how many pages the session covered
+func (s *ReadingSession) PagesRead() int {
+	return s.EndPage - s.StartPage
+}
+
+// ValidateReadingSession checks a session against the book it is for; a book without a page count can have any pages
+func ValidateReadingSession(v *validator.Validator, s *ReadingSession, book *Book, now time.Time) {
+	v.Check(s.StartPage >= 0, "start_page", "must not be negative")
+	v.Check(s.EndPage >= s.StartPage, "end_page", "must not be before start_page")
+	if book.Pages > 0 {
+		v.Check(s.EndPage <= book.Pages, "end_page", "must not be past the last page of the book")
+	}
+
+	v.Check(s.DurationMinutes >= 0, "duration_minutes", "must not be negative")
+	v.Check(s.DurationMinutes <= 24*60, "duration_minutes", "must not be more than a day")
+
+	v.Check(!s.ReadAt.IsZero(), "read_at", "must be provided")
+	v.Check(!s.ReadAt.After(now.Add(time.Minute)), "read_at", "must not be in the future")
+}
+
+// ReadingSessionModel keeps the reading sessions
+type ReadingSessionModel struct {
+	dbModel
+}
+
+func (m ReadingSessionModel) Insert(ctx context.Context, s *ReadingSession) error {
+	query := `
+	INSERT INTO reading_sessions (user_id, book_id, start_page, end_page, duration_minutes, read_at)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, version`
+
+	//read_at is sorted on, and SQLite sorts times as text, see normaliseShelfTimes
+	s.ReadAt = s.ReadAt.UTC().Truncate(time.Second)
+	args := []any{s.UserID, s.BookID, s.StartPage, s.EndPage, s.DurationMinutes, s.ReadAt}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&s.ID, &s.Version)
+	if err != nil {
+		return m.wrap(ctx, err)
+	}
+
+	return nil
+}
+
+// Get returns the user's session with the id; another user's session is ErrRecordNotFound, the same as one that doesn't exist
+func (m ReadingSessionModel) Get(ctx context.Context, userID, id int64) (*ReadingSession, error) {
+	query := `
+	SELECT id, user_id, book_id, start_page, end_page, duration_minutes, read_at, version
+	FROM reading_sessions
+	WHERE id = $1 AND user_id = $2`
+
+	var s ReadingSession
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id, userID).Scan(
+		&s.ID,
+		&s.UserID,
+		&s.BookID,
+		&s.StartPage,
+		&s.EndPage,
+		&s.DurationMinutes,
+		&s.ReadAt,
+		&s.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, m.wrap(ctx, err)
+		}
+	}
+
+	return &s, nil
+}
+
+// Update saves the session if the version still matches, the same as BookModel.Update
+func (m ReadingSessionModel) Update(ctx context.Context, s *ReadingSession) error {
+	query := `
+	UPDATE reading_sessions
+	SET start_page = $1, end_page = $2, duration_minutes = $3, read_at = $4, version = version + 1
+	WHERE id = $5 AND user_id = $6 AND version = $7
+	RETURNING version`
+
+	s.ReadAt = s.ReadAt.UTC().Truncate(time.Second)
+	args := []any{s.StartPage, s.EndPage, s.DurationMinutes, s.ReadAt, s.ID, s.UserID, s.Version}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&s.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return m.wrap(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+func (m ReadingSessionModel) Delete(ctx context.Context, userID, id int64) error {
+	query := `
+	DELETE FROM reading_sessions
+	WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return m.wrap(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return m.wrap(ctx, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// GetAllForBook returns a page of the user's sessions with the book, the most recent first
+func (m ReadingSessionModel) GetAllForBook(ctx context.Context, userID, bookID int64, filters Filters) ([]*ReadingSession, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), id, user_id, book_id, start_page, end_page, duration_minutes, read_at, version
+	FROM reading_sessions
+	WHERE user_id = $1 AND book_id = $2
+	ORDER BY read_at DESC, id DESC
+	LIMIT $3 OFFSET $4`
+
+	sessions, totalRecords, err := m.list(ctx, query, userID, bookID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return sessions, metadata, nil
+}
+
+// AllForBook returns every one of the user's sessions with the book, the most recent first, for working out the progress
+func (m ReadingSessionModel) AllForBook(ctx context.Context, userID, bookID int64) ([]*ReadingSession, error) {
+	query := `
+	SELECT count(*) OVER(), id, user_id, book_id, start_page, end_page, duration_minutes, read_at, version
+	FROM reading_sessions
+	WHERE user_id = $1 AND book_id = $2
+	ORDER BY read_at DESC, id DESC`
+
+	sessions, _, err := m.list(ctx, query, userID, bookID)
+	return sessions, err
+}
+
+// list runs one of the queries above and scans the sessions, along with the count(*) OVER() total
+func (m ReadingSessionModel) list(ctx context.Context, query string, args ...any) ([]*ReadingSession, int, error) {
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, 0, m.wrap(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	sessions := []*ReadingSession{}
+
+	for rows.Next() {
+		var s ReadingSession
+
+		err := rows.Scan(
+			&totalRecords,
+			&s.ID,
+			&s.UserID,
+			&s.BookID,
+			&s.StartPage,
+			&s.EndPage,
+			&s.DurationMinutes,
+			&s.ReadAt,
+			&s.Version,
+		)
+		if err != nil {
+			return nil, 0, m.wrap(ctx, err)
+		}
+
+		sessions = append(sessions, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, m.wrap(ctx, err)
+	}
+
+	return sessions, totalRecords, nil
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// MemoryReadingSessionModel keeps the reading sessions in memory, it behaves the same as ReadingSessionModel
+type MemoryReadingSessionModel struct {
+	s     *memoryUsers
+	books *MemoryBookModel
+}
+
+func (m MemoryReadingSessionModel) Insert(ctx context.Context, s *ReadingSession) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	//the foreign keys on reading_sessions
+	if _, ok := m.s.users[s.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+	if _, err := m.books.Get(ctx, s.BookID); err != nil {
+		return err
+	}
+
+	s.ID = m.s.nextSessionID
+	s.ReadAt = s.ReadAt.UTC().Truncate(time.Second)
+	s.Version = 1
+
+	stored := *s
+	m.s.sessions[s.ID] = &stored
+	m.s.nextSessionID++
+
+	return nil
+}
+
+func (m MemoryReadingSessionModel) Get(ctx context.Context, userID, id int64) (*ReadingSession, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	s, ok := m.s.sessions[id]
+	if !ok || s.UserID != userID {
+		return nil, ErrRecordNotFound
+	}
+
+	found := *s
+	return &found, nil
+}
+
+func (m MemoryReadingSessionModel) Update(ctx context.Context, s *ReadingSession) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	stored, ok := m.s.sessions[s.ID]
+	if !ok || stored.UserID != s.UserID || stored.Version != s.Version {
+		return ErrEditConflict
+	}
+
+	s.ReadAt = s.ReadAt.UTC().Truncate(time.Second)
+	s.Version++
+
+	updated := *s
+	m.s.sessions[s.ID] = &updated
+
+	return nil
+}
+
+func (m MemoryReadingSessionModel) Delete(ctx context.Context, userID, id int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	s, ok := m.s.sessions[id]
+	if !ok || s.UserID != userID {
+		return ErrRecordNotFound
+	}
+
+	delete(m.s.sessions, id)
+
+	return nil
+}
+
+func (m MemoryReadingSessionModel) GetAllForBook(ctx context.Context, userID, bookID int64, filters Filters) ([]*ReadingSession, Metadata, error) {
+	sessions, err := m.AllForBook(ctx, userID, bookID)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(len(sessions), filters.Page, filters.PageSize)
+
+	return paginate(sessions, filters), metadata, nil
+}
+
+func (m MemoryReadingSessionModel) AllForBook(ctx context.Context, userID, bookID int64) ([]*ReadingSession, error) {
+	m.s.mu.RLock()
+	sessions := []*ReadingSession{}
+	for _, s := range m.s.sessions {
+		if s.UserID == userID && s.BookID == bookID {
+			found := *s
+			sessions = append(sessions, &found)
+		}
+	}
+	m.s.mu.RUnlock()
+
+	//ORDER BY read_at DESC, id DESC
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].ReadAt.Equal(sessions[j].ReadAt) {
+			return sessions[i].ReadAt.After(sessions[j].ReadAt)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+
+	return sessions, nil
+}
@@ -0,0 +1,223 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// BookRevision is a copy of a book as it was straight after one change
+// the stores add one for every Insert, Update, Delete and Restore, so the history of a book can be shown and old versions brought back
+type BookRevision struct {
+	BookID    int64     `json:"book_id"`
+	Version   int32     `json:"version"`
+	Operation string    `json:"operation"` //insert, update, delete or restore (or snapshot for books that existed before revisions were kept)
+	Actor     string    `json:"actor,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Book      *Book     `json:"book"`
+}
+
+// FieldChange is one field that is different between two versions of a book
+type FieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// the actor is whoever made a change, it is kept in the context so it doesn't have to be passed to every store method
+type contextKey string
+
+const actorContextKey = contextKey("actor")
+
+// WithActor returns a copy of the context that records the actor as the one making any changes to books
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorContextKey, actor)
+}
+
+// actorFromContext returns the actor set with WithActor, or "" when it isn't known
+func actorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorContextKey).(string)
+	return actor
+}
+
+// DiffBooks lists the fields that are different between two versions of a book, in the order they appear in the Book struct
+func DiffBooks(from, to *Book) []FieldChange {
+	changes := []FieldChange{}
+
+	add := func(field string, before, after any, same bool) {
+		if !same {
+			changes = append(changes, FieldChange{Field: field, From: before, To: after})
+		}
+	}
+
+	add("title", from.Title, to.Title, from.Title == to.Title)
+	add("author", from.Author, to.Author, from.Author == to.Author)
+	add("published", from.Published, to.Published, from.Published == to.Published)
+	add("pages", from.Pages, to.Pages, from.Pages == to.Pages)
+	add("genres", from.Genres, to.Genres, slices.Equal(from.Genres, to.Genres))
+	add("rating", from.Rating, to.Rating, from.Rating == to.Rating)
+	add("isbn", from.ISBN, to.ISBN, from.ISBN == to.ISBN)
+
+	sameDeletedAt := (from.DeletedAt == nil && to.DeletedAt == nil) ||
+		(from.DeletedAt != nil && to.DeletedAt != nil && from.DeletedAt.Equal(*to.DeletedAt))
+	add("deleted_at", from.DeletedAt, to.DeletedAt, sameDeletedAt)
+
+	return changes
+}
+
+// querier is the part of *sql.DB that *sql.Tx also has, so the same code can run inside or outside a transaction
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// withTx runs fn in a transaction, which is committed if fn returns nil and rolled back otherwise
+func withTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //this does nothing once the transaction has been committed
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// the SQL below works unchanged in both postgres and SQLite, so BookModel and SQLiteBookModel share it
+// the callers turn the errors into the sentinel errors with wrapError or sqliteError
+
+// recordRevision saves a copy of the book as it is now; it is run in the same transaction as the change itself
+// so there is never a change without a revision, or a revision for a change that was rolled back
+func recordRevision(ctx context.Context, q querier, book *Book, operation string) error {
+	snapshot, err := json.Marshal(book)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO book_revisions (book_id, version, operation, actor, snapshot)
+	VALUES ($1, $2, $3, $4, $5)`
+
+	_, err = q.ExecContext(ctx, query, book.ID, book.Version, operation, actorFromContext(ctx), string(snapshot))
+	return err
+}
+
+// getRevisions returns one page of the revisions of a book, newest first
+func getRevisions(ctx context.Context, q querier, bookID int64, filters Filters) ([]*BookRevision, Metadata, error) {
+	query := `
+	SELECT count(*) OVER(), book_id, version, operation, actor, created_at, snapshot
+	FROM book_revisions
+	WHERE book_id = $1
+	ORDER BY version DESC
+	LIMIT $2 OFFSET $3`
+
+	rows, err := q.QueryContext(ctx, query, bookID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	revisions := []*BookRevision{}
+
+	for rows.Next() {
+		var revision BookRevision
+
+		if err := scanRevision(rows, &revision, &totalRecords); err != nil {
+			return nil, Metadata{}, err
+		}
+
+		revisions = append(revisions, &revision)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return revisions, metadata, nil
+}
+
+// getRevision returns a single version of a book, or ErrRecordNotFound if the book never had that version
+func getRevision(ctx context.Context, q querier, bookID int64, version int32) (*BookRevision, error) {
+	query := `
+	SELECT book_id, version, operation, actor, created_at, snapshot
+	FROM book_revisions
+	WHERE book_id = $1 AND version = $2`
+
+	var revision BookRevision
+
+	err := scanRevision(q.QueryRowContext(ctx, query, bookID, version), &revision)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &revision, nil
+}
+
+// lastRevised returns when each of the books was last changed, by id, going by its newest revision
+// the books in the trash are always in it too: moving a book to the trash takes it out of every list, so that counts as a change to them
+// idsCondition is how $1 (the ids) is matched against book_id, which postgres and SQLite write differently
+func lastRevised(ctx context.Context, q querier, idsCondition string, ids any) (map[int64]time.Time, error) {
+	query := fmt.Sprintf(`
+	SELECT r.book_id, r.created_at
+	FROM book_revisions r
+	WHERE r.version = (SELECT max(version) FROM book_revisions WHERE book_id = r.book_id)
+	AND (r.book_id %s OR r.book_id IN (SELECT id FROM books WHERE deleted_at IS NOT NULL))`, idsCondition)
+
+	rows, err := q.QueryContext(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revised := make(map[int64]time.Time)
+
+	for rows.Next() {
+		var id int64
+		var at time.Time
+
+		if err := rows.Scan(&id, &at); err != nil {
+			return nil, err
+		}
+		revised[id] = at
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revised, nil
+}
+
+// scanRevision reads a revision from a row; extra is anything selected before the revision columns (like the total count)
+func scanRevision(row interface{ Scan(...any) error }, revision *BookRevision, extra ...any) error {
+	var snapshot []byte
+
+	dest := append(extra, &revision.BookID, &revision.Version, &revision.Operation, &revision.Actor, &revision.CreatedAt, &snapshot)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+
+	revision.Book = &Book{}
+	if err := json.Unmarshal(snapshot, revision.Book); err != nil {
+		return err
+	}
+	revision.Book.Version = revision.Version
+
+	return nil
+}
@@ -0,0 +1,318 @@
+package data
+
+import (
+	"html"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// SearchResult is a single hit from BookModel.Search
+// the rank is how well the book matched (higher is better) and the snippet is the matching text with the hits wrapped in <mark> tags
+// the snippet is HTML: the book's own text in it is escaped, so the <mark> tags are the only markup a client will find there
+type SearchResult struct {
+	Book    *Book   `json:"book"`
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+// snippetStart and snippetStop are what ts_headline puts round the hits; they are control characters so they can't be confused
+// with anything in a title, and are only turned into <mark> tags once the rest of the snippet has been escaped (see snippetHTML)
+const (
+	snippetStart = "\x02"
+	snippetStop  = "\x03"
+)
+
+var snippetTags = strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>")
+
+// snippetHTML escapes a snippet from ts_headline and swaps its markers for <mark> tags
+func snippetHTML(snippet string) string {
+	return snippetTags.Replace(html.EscapeString(snippet))
+}
+
+// searchTerm is one part of a search query: a single word, or a "quoted phrase" whose words have to appear in order
+// when prefix is true the last word matches anything that starts with it
+type searchTerm struct {
+	words  []string
+	prefix bool
+}
+
+// parseSearchQuery splits what the user typed into search terms
+// every term has to match for a book to be a hit
+// anything that isn't a letter or a digit is dropped, so the terms are always safe to put in a tsquery
+func parseSearchQuery(q string) []searchTerm {
+	var terms []searchTerm
+
+	//splitting on the quotes means every odd numbered chunk was inside a pair of quotes
+	for i, chunk := range strings.Split(q, `"`) {
+		if i%2 == 1 {
+			if term, ok := newSearchTerm(strings.Fields(chunk)); ok {
+				terms = append(terms, term)
+			}
+			continue
+		}
+
+		for _, word := range strings.Fields(chunk) {
+			if term, ok := newSearchTerm([]string{word}); ok {
+				terms = append(terms, term)
+			}
+		}
+	}
+
+	return terms
+}
+
+// newSearchTerm cleans up the words of a term
+// a word like sci-fi is split into its parts, which postgres also indexes next to each other
+// only the last word of a phrase can be a prefix, postgres doesn't care but it keeps the meaning obvious
+func newSearchTerm(words []string) (searchTerm, bool) {
+	var term searchTerm
+
+	for i, word := range words {
+		lexemes := tsTerms(word)
+		if len(lexemes) == 0 {
+			continue
+		}
+
+		term.words = append(term.words, lexemes...)
+		term.prefix = strings.HasSuffix(word, "*") && i == len(words)-1
+	}
+
+	return term, len(term.words) > 0
+}
+
+// buildTSQuery turns what the user typed into a postgres tsquery string
+// terms are ANDed together, "quoted words" have to appear next to each other (phrase matching)
+// and a word ending in * matches anything starting with it (prefix matching), e.g.
+//
+//	"dune messiah" herb*  =>  (dune <-> messiah) & herb:*
+//
+// an empty string is returned when there is nothing left to search for
+func buildTSQuery(q string) string {
+	var parts []string
+
+	for _, term := range parseSearchQuery(q) {
+		words := append([]string{}, term.words...)
+		if term.prefix {
+			words[len(words)-1] += ":*"
+		}
+
+		if len(words) == 1 {
+			parts = append(parts, words[0])
+		} else {
+			parts = append(parts, "("+strings.Join(words, " <-> ")+")")
+		}
+	}
+
+	return strings.Join(parts, " & ")
+}
+
+// tsTerms lowercases the word and splits it on anything that isn't a letter or digit
+// ISBNs are the exception: 0-441-17271-7 is collapsed to 0441172717 to match the way the isbn column is indexed
+func tsTerms(word string) []string {
+	word = strings.ToLower(strings.TrimSuffix(word, "*"))
+
+	if isISBNLike(word) {
+		return []string{strings.Map(func(r rune) rune {
+			if r == '-' {
+				return -1
+			}
+			return r
+		}, word)}
+	}
+
+	return strings.FieldsFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// isISBNLike reports whether the word is only digits, hyphens and a check character of x
+func isISBNLike(word string) bool {
+	digits := 0
+
+	for i, r := range word {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '-':
+		case r == 'x' && i == len(word)-1:
+		default:
+			return false
+		}
+	}
+
+	return digits >= 9
+}
+
+// the functions below do the same kind of matching as postgres does, but in go
+// they are used by the stores that don't have postgres' full-text search to lean on
+
+// searchField is one of the fields of a book that is searched, already split into lowercase words
+// weight is how much a hit in the field is worth; these are the default ts_rank weights for A, B, C and D
+type searchField struct {
+	words  []string
+	weight float32
+}
+
+func bookSearchFields(book *Book) []searchField {
+	isbn := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(book.ISBN))
+
+	return []searchField{
+		{words: splitWords(book.Title), weight: 1.0},
+		{words: splitWords(book.Author), weight: 0.4},
+		{words: splitWords(strings.Join(book.Genres, " ")), weight: 0.2},
+		{words: strings.Fields(isbn), weight: 0.1},
+	}
+}
+
+// splitWords lowercases the text and splits it into words of letters and digits
+func splitWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// matches reports whether the term appears in the words, in order for a phrase
+func (t searchTerm) matches(words []string) bool {
+	for start := 0; start+len(t.words) <= len(words); start++ {
+		found := true
+
+		for i, want := range t.words {
+			got := words[start+i]
+
+			if t.prefix && i == len(t.words)-1 {
+				found = strings.HasPrefix(got, want)
+			} else {
+				found = got == want
+			}
+
+			if !found {
+				break
+			}
+		}
+
+		if found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scoreBook returns how well the book matches the terms, and false if any term doesn't match at all
+// each term scores the weight of the best field it was found in
+func scoreBook(book *Book, terms []searchTerm) (float32, bool) {
+	fields := bookSearchFields(book)
+
+	var rank float32
+	for _, term := range terms {
+		var best float32
+		for _, field := range fields {
+			if field.weight > best && term.matches(field.words) {
+				best = field.weight
+			}
+		}
+
+		if best == 0 {
+			return 0, false
+		}
+		rank += best
+	}
+
+	return rank, true
+}
+
+// highlightSnippet builds the same snippet as ts_headline does for postgres:
+// the title, author and genres with every word that matches one of the terms wrapped in <mark> tags, and the rest escaped
+func highlightSnippet(book *Book, terms []searchTerm) string {
+	parts := []string{book.Title}
+	if book.Author != "" {
+		parts = append(parts, book.Author)
+	}
+	if genres := strings.Join(book.Genres, " "); genres != "" {
+		parts = append(parts, genres)
+	}
+	text := strings.Join(parts, " - ")
+
+	matchesWord := func(word string) bool {
+		word = strings.ToLower(word)
+		for _, term := range terms {
+			for i, want := range term.words {
+				if word == want || (term.prefix && i == len(term.words)-1 && strings.HasPrefix(word, want)) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	var sb strings.Builder
+	var word []rune
+
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		if matchesWord(string(word)) {
+			sb.WriteString("<mark>" + string(word) + "</mark>")
+		} else {
+			sb.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			word = append(word, r)
+			continue
+		}
+		flush()
+		sb.WriteString(html.EscapeString(string(r))) //the words are only letters and digits, so this is all that can need escaping
+	}
+	flush()
+
+	return sb.String()
+}
+
+// searchBooks runs a search over books that are already in memory
+// the hits are ordered by rank, best first, and then by id, the same as BookModel.Search
+func searchBooks(books []*Book, q string, filters Filters) ([]*SearchResult, Metadata) {
+	terms := parseSearchQuery(q)
+	results := []*SearchResult{}
+
+	if len(terms) == 0 {
+		return results, Metadata{}
+	}
+
+	for _, book := range books {
+		if rank, ok := scoreBook(book, terms); ok {
+			results = append(results, &SearchResult{Book: book, Rank: rank, Snippet: highlightSnippet(book, terms)})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Book.ID < results[j].Book.ID
+	})
+
+	metadata := calculateMetadata(len(results), filters.Page, filters.PageSize)
+
+	return paginate(results, filters), metadata
+}
+
+// paginate returns the slice of items that falls on the page the filters ask for
+func paginate[T any](items []T, filters Filters) []T {
+	start := filters.offset()
+	if start >= len(items) {
+		return []T{}
+	}
+
+	end := start + filters.limit()
+	if end > len(items) {
+		end = len(items)
+	}
+
+	return items[start:end]
+}
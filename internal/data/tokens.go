@@ -0,0 +1,110 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"time"
+
+	"readinglist/internal/validator"
+)
+
+// the scopes say what a token can be used for, a token only works for its own scope
+const (
+	ScopeActivation     = "activation"
+	ScopeAuthentication = "authentication" //sent as Authorization: Bearer <token> to sign requests in as the user
+)
+
+// Token is a random string sent to a user; only its hash is saved, the plaintext is only known when it is made
+type Token struct {
+	Plaintext string    `json:"token"`
+	Hash      []byte    `json:"-"`
+	UserID    int64     `json:"-"`
+	Expiry    time.Time `json:"expiry"`
+	Scope     string    `json:"-"`
+}
+
+// generateToken makes a token that expires after ttl
+// 16 random bytes is 128 bits, far too many to guess, and base32 without padding makes them 26 characters that are safe in a url
+func generateToken(userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token := &Token{
+		UserID: userID,
+		Expiry: tokenTime(time.Now().Add(ttl)),
+		Scope:  scope,
+	}
+
+	randomBytes := make([]byte, 16)
+	if _, err := rand.Read(randomBytes); err != nil {
+		return nil, err
+	}
+
+	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+
+	hash := sha256.Sum256([]byte(token.Plaintext))
+	token.Hash = hash[:]
+
+	return token, nil
+}
+
+// tokenTime is how the expiry times are stored and compared: in UTC to the second,
+// SQLite compares the times as text, so they all have to be written the same way
+func tokenTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// ValidateTokenPlaintext checks a token that was sent by a client looks like one generateToken made
+func ValidateTokenPlaintext(v *validator.Validator, plaintext string) {
+	v.Check(plaintext != "", "token", "must be provided")
+	v.Check(len(plaintext) == 26, "token", "must be 26 bytes long")
+}
+
+// TokenModel keeps the tokens in postgres or SQLite
+type TokenModel struct {
+	dbModel
+}
+
+// New makes a token for the user and saves it
+func (m TokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	return userTx{q: m.DB, model: m.dbModel}.NewToken(ctx, userID, ttl, scope)
+}
+
+func (m TokenModel) Insert(ctx context.Context, token *Token) error {
+	return userTx{q: m.DB, model: m.dbModel}.insertToken(ctx, token)
+}
+
+// DeleteAllForUser removes every token of the scope the user has, e.g. once the account is activated the other activation tokens are no use
+func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	query := `
+	DELETE FROM tokens
+	WHERE scope = $1 AND user_id = $2`
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, scope, userID)
+	if err != nil {
+		return m.wrap(ctx, err)
+	}
+
+	return nil
+}
+
+// Delete removes one token, e.g. when a user signs out; a token that doesn't exist is not an error, it is gone either way
+func (m TokenModel) Delete(ctx context.Context, scope, plaintext string) error {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+	DELETE FROM tokens
+	WHERE scope = $1 AND hash = $2`
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, scope, hash[:])
+	if err != nil {
+		return m.wrap(ctx, err)
+	}
+
+	return nil
+}
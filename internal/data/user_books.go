@@ -0,0 +1,282 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"readinglist/internal/validator"
+)
+
+// the statuses a book on a user's shelves can have, each status is a shelf
+const (
+	StatusWantToRead   = "want-to-read"
+	StatusReading      = "reading"
+	StatusRead         = "read"
+	StatusDidNotFinish = "did-not-finish"
+)
+
+// Statuses is every status there is, in the order a book usually goes through them
+var Statuses = []string{StatusWantToRead, StatusReading, StatusRead, StatusDidNotFinish}
+
+// UserBook is one user's relationship with a book in the catalogue: which shelf it is on, when they read it and what they thought of it
+// Book is only filled in by the api, the stores just keep the BookID
+type UserBook struct {
+	BookID     int64      `json:"book_id"`
+	UserID     int64      `json:"-"`
+	Status     string     `json:"status"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Rating     float32    `json:"rating,omitempty"` //the user's own rating, 0 is not rated; the book's rating is the catalogue's
+	DNFReason  string     `json:"dnf_reason,omitempty"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Version    int32      `json:"-"`
+	Book       *Book      `json:"book,omitempty"`
+}
+
+// SetStatus moves the book to another shelf and keeps the dates in step with it:
+// starting to read stamps started_at, finishing stamps finished_at, and going back to want-to-read clears both
+// dates that are already set are kept, so a client can send its own before or after changing the status
+func (ub *UserBook) SetStatus(status string, now time.Time) {
+	now = now.UTC().Truncate(time.Second)
+
+	switch status {
+	case StatusWantToRead:
+		ub.StartedAt, ub.FinishedAt = nil, nil
+	case StatusReading:
+		if ub.StartedAt == nil || ub.Status == StatusRead || ub.Status == StatusDidNotFinish {
+			ub.StartedAt = &now //picking a finished book up again is a new read
+		}
+		ub.FinishedAt = nil
+	case StatusRead:
+		if ub.FinishedAt == nil {
+			ub.FinishedAt = &now
+		}
+	case StatusDidNotFinish:
+		ub.FinishedAt = nil
+	}
+
+	//a reason only makes sense for a book that wasn't finished
+	if status != StatusDidNotFinish {
+		ub.DNFReason = ""
+	}
+
+	ub.Status = status
+}
+
+// ValidateUserBook checks the user's entry for a book before it is saved
+func ValidateUserBook(v *validator.Validator, ub *UserBook, now time.Time) {
+	v.Check(validator.PermittedValue(ub.Status, Statuses...), "status", "must be one of want-to-read, reading, read or did-not-finish")
+
+	v.Check(ub.Rating >= 0 && ub.Rating <= 5, "rating", "must be between 0 and 5")
+
+	v.Check(ub.DNFReason == "" || ub.Status == StatusDidNotFinish, "dnf_reason", "can only be given for a book that is did-not-finish")
+	v.Check(len(ub.DNFReason) <= 500, "dnf_reason", "must not be more than 500 bytes long")
+
+	//a minute of leeway is left for clocks that are a little ahead of ours
+	v.Check(ub.StartedAt == nil || !ub.StartedAt.After(now.Add(time.Minute)), "started_at", "must not be in the future")
+	v.Check(ub.FinishedAt == nil || !ub.FinishedAt.After(now.Add(time.Minute)), "finished_at", "must not be in the future")
+	v.Check(ub.StartedAt == nil || ub.FinishedAt == nil || !ub.FinishedAt.Before(*ub.StartedAt), "finished_at", "must not be before started_at")
+}
+
+// ShelfFilters are the values for listing one shelf
+type ShelfFilters struct {
+	Status string
+	Filters
+}
+
+// normaliseShelfTimes stores the dates in UTC to the second whatever time zone the client sent them in,
+// SQLite sorts the times as text so they only sort properly if they are all written the same way
+func normaliseShelfTimes(ub *UserBook) {
+	for _, t := range []**time.Time{&ub.StartedAt, &ub.FinishedAt} {
+		if *t != nil {
+			utc := (*t).UTC().Truncate(time.Second)
+			*t = &utc
+		}
+	}
+}
+
+// UserBookModel keeps the users' shelves
+type UserBookModel struct {
+	dbModel
+}
+
+// Insert puts a book on the user's shelves; ErrDuplicate means it is already on one, so it should have been an Update
+func (m UserBookModel) Insert(ctx context.Context, ub *UserBook) error {
+	query := `
+	INSERT INTO user_books (user_id, book_id, status, started_at, finished_at, rating, dnf_reason, updated_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING version`
+
+	normaliseShelfTimes(ub)
+	ub.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	args := []any{ub.UserID, ub.BookID, ub.Status, ub.StartedAt, ub.FinishedAt, ub.Rating, ub.DNFReason, ub.UpdatedAt}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&ub.Version)
+	if err != nil {
+		return m.wrap(ctx, err)
+	}
+
+	return nil
+}
+
+// Get returns the user's entry for the book; ErrRecordNotFound means the book isn't on any of their shelves
+func (m UserBookModel) Get(ctx context.Context, userID, bookID int64) (*UserBook, error) {
+	query := `
+	SELECT book_id, user_id, status, started_at, finished_at, rating, dnf_reason, updated_at, version
+	FROM user_books
+	WHERE user_id = $1 AND book_id = $2`
+
+	var ub UserBook
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, userID, bookID).Scan(
+		&ub.BookID,
+		&ub.UserID,
+		&ub.Status,
+		&ub.StartedAt,
+		&ub.FinishedAt,
+		&ub.Rating,
+		&ub.DNFReason,
+		&ub.UpdatedAt,
+		&ub.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, m.wrap(ctx, err)
+		}
+	}
+
+	return &ub, nil
+}
+
+// Update saves the entry if the version still matches, the same as BookModel.Update
+func (m UserBookModel) Update(ctx context.Context, ub *UserBook) error {
+	query := `
+	UPDATE user_books
+	SET status = $1, started_at = $2, finished_at = $3, rating = $4, dnf_reason = $5, updated_at = $6, version = version + 1
+	WHERE user_id = $7 AND book_id = $8 AND version = $9
+	RETURNING version`
+
+	normaliseShelfTimes(ub)
+	updatedAt := time.Now().UTC().Truncate(time.Second)
+	args := []any{ub.Status, ub.StartedAt, ub.FinishedAt, ub.Rating, ub.DNFReason, updatedAt, ub.UserID, ub.BookID, ub.Version}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&ub.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return m.wrap(ctx, err)
+		}
+	}
+
+	ub.UpdatedAt = updatedAt
+	return nil
+}
+
+// Delete takes the book off the user's shelves
+func (m UserBookModel) Delete(ctx context.Context, userID, bookID int64) error {
+	query := `
+	DELETE FROM user_books
+	WHERE user_id = $1 AND book_id = $2`
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID, bookID)
+	if err != nil {
+		return m.wrap(ctx, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return m.wrap(ctx, err)
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// shelfOrder is the ORDER BY for a shelf; books without the date being sorted on go last whichever way it is sorted,
+// postgres and SQLite put NULLs at opposite ends so it is spelt out, and the book id breaks ties so the pages don't overlap
+func shelfOrder(filters Filters) string {
+	column := "user_books." + filters.sortColumn()
+	if filters.sortColumn() == "title" {
+		column = "books.title"
+	}
+
+	return fmt.Sprintf("%s IS NULL, %s %s, user_books.book_id ASC", column, column, filters.sortDirection())
+}
+
+// GetShelf returns a page of the user's books with the status
+// books that are in the trash are left out, they come back on the shelf if the book is restored
+func (m UserBookModel) GetShelf(ctx context.Context, userID int64, filters ShelfFilters) ([]*UserBook, Metadata, error) {
+	query := fmt.Sprintf(`
+	SELECT count(*) OVER(), user_books.book_id, user_books.user_id, user_books.status, user_books.started_at,
+		user_books.finished_at, user_books.rating, user_books.dnf_reason, user_books.updated_at, user_books.version
+	FROM user_books
+	INNER JOIN books ON books.id = user_books.book_id
+	WHERE user_books.user_id = $1 AND user_books.status = $2 AND books.deleted_at IS NULL
+	ORDER BY %s
+	LIMIT $3 OFFSET $4`, shelfOrder(filters.Filters))
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.Status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, m.wrap(ctx, err)
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	shelf := []*UserBook{}
+
+	for rows.Next() {
+		var ub UserBook
+
+		err := rows.Scan(
+			&totalRecords,
+			&ub.BookID,
+			&ub.UserID,
+			&ub.Status,
+			&ub.StartedAt,
+			&ub.FinishedAt,
+			&ub.Rating,
+			&ub.DNFReason,
+			&ub.UpdatedAt,
+			&ub.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, m.wrap(ctx, err)
+		}
+
+		shelf = append(shelf, &ub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, m.wrap(ctx, err)
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return shelf, metadata, nil
+}
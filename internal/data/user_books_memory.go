@@ -0,0 +1,156 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// userBookKey is the primary key of user_books
+type userBookKey struct {
+	userID, bookID int64
+}
+
+// MemoryUserBookModel keeps the users' shelves in memory, it behaves the same as UserBookModel
+// it needs the books to leave the trashed ones off the shelves and to sort by title, the same as the join in GetShelf
+type MemoryUserBookModel struct {
+	s     *memoryUsers
+	books *MemoryBookModel
+}
+
+func copyUserBook(ub *UserBook) *UserBook {
+	c := *ub
+	c.Book = nil
+	normaliseShelfTimes(&c) //this copies the dates too, so the caller's pointers aren't kept
+	return &c
+}
+
+func (m MemoryUserBookModel) Insert(ctx context.Context, ub *UserBook) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	//the foreign keys on user_books
+	if _, ok := m.s.users[ub.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+	if _, err := m.books.Get(ctx, ub.BookID); err != nil {
+		return err
+	}
+
+	key := userBookKey{ub.UserID, ub.BookID}
+	if _, ok := m.s.userBooks[key]; ok {
+		return ErrDuplicate
+	}
+
+	normaliseShelfTimes(ub)
+	ub.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	ub.Version = 1
+
+	m.s.userBooks[key] = copyUserBook(ub)
+
+	return nil
+}
+
+func (m MemoryUserBookModel) Get(ctx context.Context, userID, bookID int64) (*UserBook, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	ub, ok := m.s.userBooks[userBookKey{userID, bookID}]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	return copyUserBook(ub), nil
+}
+
+func (m MemoryUserBookModel) Update(ctx context.Context, ub *UserBook) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	key := userBookKey{ub.UserID, ub.BookID}
+
+	stored, ok := m.s.userBooks[key]
+	if !ok || stored.Version != ub.Version {
+		return ErrEditConflict
+	}
+
+	normaliseShelfTimes(ub)
+	ub.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	ub.Version++
+
+	m.s.userBooks[key] = copyUserBook(ub)
+
+	return nil
+}
+
+func (m MemoryUserBookModel) Delete(ctx context.Context, userID, bookID int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	key := userBookKey{userID, bookID}
+	if _, ok := m.s.userBooks[key]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.s.userBooks, key)
+
+	return nil
+}
+
+func (m MemoryUserBookModel) GetShelf(ctx context.Context, userID int64, filters ShelfFilters) ([]*UserBook, Metadata, error) {
+	//the books are looked up before taking the lock, MemoryBookModel has its own
+	titles := map[int64]string{}
+	for _, book := range m.books.all() {
+		titles[book.ID] = book.Title
+	}
+
+	m.s.mu.RLock()
+	shelf := []*UserBook{}
+	for key, ub := range m.s.userBooks {
+		_, inCatalogue := titles[key.bookID] //books in the trash aren't in all()
+		if key.userID == userID && ub.Status == filters.Status && inCatalogue {
+			shelf = append(shelf, copyUserBook(ub))
+		}
+	}
+	m.s.mu.RUnlock()
+
+	column, descending := filters.sortColumn(), filters.sortDirection() == "DESC"
+
+	//the same order as shelfOrder: missing dates last, then the column, then the book id
+	sort.Slice(shelf, func(i, j int) bool {
+		a, b := shelf[i], shelf[j]
+
+		var less, greater bool
+		switch column {
+		case "title":
+			less, greater = titles[a.BookID] < titles[b.BookID], titles[a.BookID] > titles[b.BookID]
+		case "rating":
+			less, greater = a.Rating < b.Rating, a.Rating > b.Rating
+		case "updated_at":
+			less, greater = a.UpdatedAt.Before(b.UpdatedAt), a.UpdatedAt.After(b.UpdatedAt)
+		default:
+			ta, tb := a.StartedAt, b.StartedAt
+			if column == "finished_at" {
+				ta, tb = a.FinishedAt, b.FinishedAt
+			}
+			if (ta == nil) != (tb == nil) {
+				return tb == nil
+			}
+			if ta != nil {
+				less, greater = ta.Before(*tb), ta.After(*tb)
+			}
+		}
+
+		if descending {
+			less, greater = greater, less
+		}
+		if less || greater {
+			return less
+		}
+		return a.BookID < b.BookID
+	})
+
+	metadata := calculateMetadata(len(shelf), filters.Page, filters.PageSize)
+
+	return paginate(shelf, filters.Filters), metadata, nil
+}
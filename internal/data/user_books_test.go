@@ -0,0 +1,107 @@
+package data
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"readinglist/internal/validator"
+)
+
+func TestSetStatus(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 30, 15, 500, time.FixedZone("CET", 3600))
+	stamped := now.UTC().Truncate(time.Second)
+	earlier := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name         string
+		from         UserBook
+		status       string
+		wantStarted  *time.Time
+		wantFinished *time.Time
+		wantReason   string
+	}{
+		{"want to read", UserBook{}, StatusWantToRead, nil, nil, ""},
+		{"start reading", UserBook{Status: StatusWantToRead}, StatusReading, &stamped, nil, ""},
+		{"start with a date already set", UserBook{Status: StatusWantToRead, StartedAt: &earlier}, StatusReading, &earlier, nil, ""},
+		{"finish", UserBook{Status: StatusReading, StartedAt: &earlier}, StatusRead, &earlier, &stamped, ""},
+		{"finish with a date already set", UserBook{Status: StatusReading, StartedAt: &earlier, FinishedAt: &earlier}, StatusRead, &earlier, &earlier, ""},
+		{"read it again", UserBook{Status: StatusRead, StartedAt: &earlier, FinishedAt: &earlier}, StatusReading, &stamped, nil, ""},
+		{"pick it up again", UserBook{Status: StatusDidNotFinish, StartedAt: &earlier, DNFReason: "too long"}, StatusReading, &stamped, nil, ""},
+		{"give up", UserBook{Status: StatusReading, StartedAt: &earlier}, StatusDidNotFinish, &earlier, nil, ""},
+		{"give up keeps the reason", UserBook{Status: StatusReading, DNFReason: "too long"}, StatusDidNotFinish, nil, nil, "too long"},
+		{"back to want to read", UserBook{Status: StatusRead, StartedAt: &earlier, FinishedAt: &earlier}, StatusWantToRead, nil, nil, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ub := tt.from
+			ub.SetStatus(tt.status, now)
+
+			if ub.Status != tt.status {
+				t.Errorf("Status = %q, want %q", ub.Status, tt.status)
+			}
+			if !sameTime(ub.StartedAt, tt.wantStarted) {
+				t.Errorf("StartedAt = %v, want %v", ub.StartedAt, tt.wantStarted)
+			}
+			if !sameTime(ub.FinishedAt, tt.wantFinished) {
+				t.Errorf("FinishedAt = %v, want %v", ub.FinishedAt, tt.wantFinished)
+			}
+			if ub.DNFReason != tt.wantReason {
+				t.Errorf("DNFReason = %q, want %q", ub.DNFReason, tt.wantReason)
+			}
+		})
+	}
+}
+
+// sameTime reports whether two optional times are both unset or both the same instant
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Equal(*b)
+}
+
+func TestValidateUserBook(t *testing.T) {
+	now := time.Now()
+	at := func(d time.Duration) *time.Time {
+		when := now.Add(d)
+		return &when
+	}
+
+	tests := []struct {
+		name string
+		ub   UserBook
+		want string //the field with the error, "" when it is valid
+	}{
+		{"valid", UserBook{Status: StatusRead, StartedAt: at(-48 * time.Hour), FinishedAt: at(-time.Hour), Rating: 4.5}, ""},
+		{"no status", UserBook{}, "status"},
+		{"a status that isn't a shelf", UserBook{Status: "lent-out"}, "status"},
+		{"rating too high", UserBook{Status: StatusRead, Rating: 5.5}, "rating"},
+		{"rating below zero", UserBook{Status: StatusRead, Rating: -1}, "rating"},
+		{"a reason for a book that was finished", UserBook{Status: StatusRead, DNFReason: "too long"}, "dnf_reason"},
+		{"a reason for a book that wasn't", UserBook{Status: StatusDidNotFinish, DNFReason: "too long"}, ""},
+		{"a reason that is too long", UserBook{Status: StatusDidNotFinish, DNFReason: strings.Repeat("x", 501)}, "dnf_reason"},
+		{"started in the future", UserBook{Status: StatusReading, StartedAt: at(time.Hour)}, "started_at"},
+		{"a clock a little ahead", UserBook{Status: StatusReading, StartedAt: at(30 * time.Second)}, ""},
+		{"finished in the future", UserBook{Status: StatusRead, FinishedAt: at(time.Hour)}, "finished_at"},
+		{"finished before it was started", UserBook{Status: StatusRead, StartedAt: at(-time.Hour), FinishedAt: at(-2 * time.Hour)}, "finished_at"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := validator.New()
+			ValidateUserBook(v, &tt.ub, now)
+
+			if tt.want == "" {
+				if !v.Valid() {
+					t.Errorf("errors = %v, want none", v.Errors)
+				}
+				return
+			}
+			if _, ok := v.Errors[tt.want]; !ok || len(v.Errors) != 1 {
+				t.Errorf("errors = %v, want only %s", v.Errors, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,321 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"readinglist/internal/validator"
+)
+
+// User is someone with an account on the api
+// the password hash and version are never sent to the client
+type User struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	Password  password  `json:"-"`
+	Activated bool      `json:"activated"`
+	Version   int32     `json:"-"`
+}
+
+// AnonymousUser is the user for a request that didn't send a token
+var AnonymousUser = &User{}
+
+// IsAnonymous reports whether the user is AnonymousUser
+func (u *User) IsAnonymous() bool {
+	return u == AnonymousUser
+}
+
+// password holds the plaintext password only while a new one is being set, so it can be validated, and the bcrypt hash that is saved
+type password struct {
+	plaintext *string
+	hash      []byte
+}
+
+// bcryptCost is how much work hashing a password takes; 12 takes a few hundred milliseconds, slow enough to make guessing expensive
+const bcryptCost = 12
+
+// Set hashes the password and keeps the plaintext around for ValidateUser
+func (p *password) Set(plaintext string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(plaintext), bcryptCost)
+	if err != nil {
+		return err
+	}
+
+	p.plaintext = &plaintext
+	p.hash = hash
+	return nil
+}
+
+// Matches reports whether the plaintext is the password that was hashed
+func (p *password) Matches(plaintext string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintext))
+	if err != nil {
+		switch {
+		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// EmailRX is the pattern the HTML spec uses for <input type="email">, it isn't perfect but it catches typos
+var EmailRX = regexp.MustCompile("^[a-zA-Z0-9.!#$%&'*+\\/=?^_`{|}~-]+@[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(?:\\.[a-zA-Z0-9](?:[a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$")
+
+func ValidateEmail(v *validator.Validator, email string) {
+	v.Check(email != "", "email", "must be provided")
+	v.Check(validator.Matches(email, EmailRX), "email", "must be a valid email address")
+}
+
+// ValidatePasswordPlaintext checks a password before it is hashed
+// bcrypt only looks at the first 72 bytes, so anything longer would quietly be cut short
+func ValidatePasswordPlaintext(v *validator.Validator, password string) {
+	v.Check(password != "", "password", "must be provided")
+	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
+	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
+}
+
+// ValidateUser checks every field of a user before it is saved, like ValidateBook does for books
+func ValidateUser(v *validator.Validator, user *User) {
+	v.Check(strings.TrimSpace(user.Name) != "", "name", "must be provided")
+	v.Check(len(user.Name) <= 500, "name", "must not be more than 500 bytes long")
+
+	ValidateEmail(v, user.Email)
+
+	if user.Password.plaintext != nil {
+		ValidatePasswordPlaintext(v, *user.Password.plaintext)
+	}
+
+	//a user without a hash is one whose password was never set, usually because it already failed ValidatePasswordPlaintext
+	v.Check(user.Password.hash != nil, "password", "must be provided")
+}
+
+// UserModel keeps the users in postgres or SQLite; unlike the books the SQL is the same for both, so there is one model (see dbModel)
+type UserModel struct {
+	dbModel
+}
+
+// WithTx runs fn inside a database transaction, see BookModel.WithTx
+func (m UserModel) WithTx(ctx context.Context, fn func(tx UserTx) error) error {
+	return withTx(ctx, m.DB, func(tx *sql.Tx) error {
+		return fn(userTx{q: tx, model: m.dbModel})
+	})
+}
+
+// Insert saves a new user; ErrDuplicate means there is already a user with the email address (ignoring case)
+func (m UserModel) Insert(ctx context.Context, user *User) error {
+	return userTx{q: m.DB, model: m.dbModel}.Insert(ctx, user)
+}
+
+// Get returns the user with the id
+func (m UserModel) Get(ctx context.Context, id int64) (*User, error) {
+	query := `
+	SELECT id, created_at, name, email, password_hash, activated, version
+	FROM users
+	WHERE id = $1`
+
+	var user User
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, m.wrap(ctx, err)
+		}
+	}
+
+	return &user, nil
+}
+
+// GetByEmail returns the user with the email address, ignoring case
+func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	query := `
+	SELECT id, created_at, name, email, password_hash, activated, version
+	FROM users
+	WHERE lower(email) = lower($1)`
+
+	var user User
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, m.wrap(ctx, err)
+		}
+	}
+
+	return &user, nil
+}
+
+// Update saves the user if the version still matches, the same as BookModel.Update
+// ErrEditConflict means the user was changed since it was read, ErrDuplicate that the new email address is taken
+func (m UserModel) Update(ctx context.Context, user *User) error {
+	query := `
+	UPDATE users
+	SET name = $1, email = $2, password_hash = $3, activated = $4, version = version + 1
+	WHERE id = $5 AND version = $6
+	RETURNING version`
+
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated, user.ID, user.Version}
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return m.wrap(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// GetForToken returns the user a token with the scope was made for; ErrRecordNotFound covers a token that doesn't exist and one that has expired
+func (m UserModel) GetForToken(ctx context.Context, scope, plaintext string) (*User, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+
+	query := `
+	SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+	FROM users
+	INNER JOIN tokens ON users.id = tokens.user_id
+	WHERE tokens.hash = $1 AND tokens.scope = $2 AND tokens.expiry > $3`
+
+	var user User
+
+	ctx, cancel := m.queryContext(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, hash[:], scope, tokenTime(time.Now())).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, m.wrap(ctx, err)
+		}
+	}
+
+	return &user, nil
+}
+
+// userTx holds the SQL for signing a user up, so the same code runs for UserModel, TokenModel and PermissionModel and inside UserModel.WithTx
+// q is either the connection pool or a transaction
+type userTx struct {
+	q     querier
+	model dbModel
+}
+
+func (t userTx) Insert(ctx context.Context, user *User) error {
+	query := `
+	INSERT INTO users (name, email, password_hash, activated)
+	VALUES ($1, $2, $3, $4)
+	RETURNING id, created_at, version`
+
+	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
+
+	ctx, cancel := t.model.queryContext(ctx)
+	defer cancel()
+
+	err := t.q.QueryRowContext(ctx, query, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	if err != nil {
+		return t.model.wrap(ctx, err)
+	}
+
+	return nil
+}
+
+// AddPermissions grants the user the permissions, see PermissionModel.AddForUser
+func (t userTx) AddPermissions(ctx context.Context, userID int64, codes ...string) error {
+	//one insert per code keeps the SQL the same for both databases, postgres would want = ANY($2) with an array for a list
+	query := `
+	INSERT INTO users_permissions (user_id, permission_id)
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = $2
+	ON CONFLICT DO NOTHING`
+
+	ctx, cancel := t.model.queryContext(ctx)
+	defer cancel()
+
+	for _, code := range codes {
+		if _, err := t.q.ExecContext(ctx, query, userID, code); err != nil {
+			return t.model.wrap(ctx, err)
+		}
+	}
+
+	return nil
+}
+
+// NewToken makes a token for the user and saves it, see TokenModel.New
+func (t userTx) NewToken(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.insertToken(ctx, token)
+	return token, err
+}
+
+func (t userTx) insertToken(ctx context.Context, token *Token) error {
+	query := `
+	INSERT INTO tokens (hash, user_id, expiry, scope)
+	VALUES ($1, $2, $3, $4)`
+
+	ctx, cancel := t.model.queryContext(ctx)
+	defer cancel()
+
+	_, err := t.q.ExecContext(ctx, query, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return t.model.wrap(ctx, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,302 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryUsers is where the in-memory store keeps the users and everything that belongs to them: tokens, permissions, shelves and reading sessions
+// the Memory*Model types for them share one, the same way the database models share a database
+type memoryUsers struct {
+	mu            sync.RWMutex
+	users         map[int64]*User
+	tokens        map[[sha256.Size]byte]*Token
+	permissions   map[int64]map[string]bool
+	userBooks     map[userBookKey]*UserBook
+	sessions      map[int64]*ReadingSession
+	nextID        int64
+	nextSessionID int64
+}
+
+func newMemoryUsers() *memoryUsers {
+	return &memoryUsers{
+		users:         make(map[int64]*User),
+		tokens:        make(map[[sha256.Size]byte]*Token),
+		permissions:   make(map[int64]map[string]bool),
+		userBooks:     make(map[userBookKey]*UserBook),
+		sessions:      make(map[int64]*ReadingSession),
+		nextID:        1,
+		nextSessionID: 1,
+	}
+}
+
+// emailTaken does the job of the unique index on lower(email); whoever calls it has to hold the lock
+func (s *memoryUsers) emailTaken(user *User) bool {
+	for id, other := range s.users {
+		if id != user.ID && strings.EqualFold(other.Email, user.Email) {
+			return true
+		}
+	}
+	return false
+}
+
+// MemoryUserModel keeps the users in memory, it behaves the same as UserModel
+type MemoryUserModel struct {
+	s *memoryUsers
+}
+
+// WithTx runs fn while holding the lock, and puts the users, tokens and permissions back the way they were if it returns an error
+func (m MemoryUserModel) WithTx(ctx context.Context, fn func(tx UserTx) error) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	users := make(map[int64]*User, len(m.s.users))
+	for id, user := range m.s.users {
+		users[id] = user
+	}
+	tokens := make(map[[sha256.Size]byte]*Token, len(m.s.tokens))
+	for hash, token := range m.s.tokens {
+		tokens[hash] = token
+	}
+	permissions := make(map[int64]map[string]bool, len(m.s.permissions))
+	for id, codes := range m.s.permissions {
+		permissions[id] = make(map[string]bool, len(codes))
+		for code := range codes {
+			permissions[id][code] = true
+		}
+	}
+	nextID := m.s.nextID
+
+	if err := fn(memoryUserTx{m.s}); err != nil {
+		m.s.users, m.s.tokens, m.s.permissions, m.s.nextID = users, tokens, permissions, nextID
+		return err
+	}
+
+	return nil
+}
+
+func (m MemoryUserModel) Insert(ctx context.Context, user *User) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	return memoryUserTx{m.s}.Insert(ctx, user)
+}
+
+func (m MemoryUserModel) Get(ctx context.Context, id int64) (*User, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	user, ok := m.s.users[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	found := *user
+	return &found, nil
+}
+
+func (m MemoryUserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	for _, user := range m.s.users {
+		if strings.EqualFold(user.Email, email) {
+			found := *user
+			return &found, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m MemoryUserModel) Update(ctx context.Context, user *User) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	stored, ok := m.s.users[user.ID]
+	if !ok || stored.Version != user.Version {
+		return ErrEditConflict
+	}
+	if m.s.emailTaken(user) {
+		return ErrDuplicate
+	}
+
+	user.Version++
+	updated := *user
+	m.s.users[user.ID] = &updated
+
+	return nil
+}
+
+func (m MemoryUserModel) GetForToken(ctx context.Context, scope, plaintext string) (*User, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	token, ok := m.s.tokens[sha256.Sum256([]byte(plaintext))]
+	if !ok || token.Scope != scope || !token.Expiry.After(time.Now()) {
+		return nil, ErrRecordNotFound
+	}
+
+	user, ok := m.s.users[token.UserID]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	found := *user
+	return &found, nil
+}
+
+// MemoryTokenModel keeps the tokens in memory, it behaves the same as TokenModel
+type MemoryTokenModel struct {
+	s *memoryUsers
+}
+
+func (m MemoryTokenModel) New(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	return memoryUserTx{m.s}.NewToken(ctx, userID, ttl, scope)
+}
+
+func (m MemoryTokenModel) Insert(ctx context.Context, token *Token) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	return memoryUserTx{m.s}.insertToken(token)
+}
+
+func (m MemoryTokenModel) DeleteAllForUser(ctx context.Context, scope string, userID int64) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for hash, token := range m.s.tokens {
+		if token.Scope == scope && token.UserID == userID {
+			delete(m.s.tokens, hash)
+		}
+	}
+
+	return nil
+}
+
+func (m MemoryTokenModel) Delete(ctx context.Context, scope, plaintext string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	hash := sha256.Sum256([]byte(plaintext))
+	if token, ok := m.s.tokens[hash]; ok && token.Scope == scope {
+		delete(m.s.tokens, hash)
+	}
+
+	return nil
+}
+
+// MemoryPermissionModel keeps the users' permissions in memory, it behaves the same as PermissionModel
+type MemoryPermissionModel struct {
+	s *memoryUsers
+}
+
+func (m MemoryPermissionModel) GetAllForUser(ctx context.Context, userID int64) (Permissions, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	permissions := Permissions{}
+	for code := range m.s.permissions[userID] {
+		permissions = append(permissions, code)
+	}
+	slices.Sort(permissions)
+
+	return permissions, nil
+}
+
+func (m MemoryPermissionModel) AddForUser(ctx context.Context, userID int64, codes ...string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	return memoryUserTx{m.s}.AddPermissions(ctx, userID, codes...)
+}
+
+func (m MemoryPermissionModel) RemoveForUser(ctx context.Context, userID int64, codes ...string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	for _, code := range codes {
+		delete(m.s.permissions[userID], code)
+	}
+
+	return nil
+}
+
+// memoryUserTx does the changes for MemoryUserModel.WithTx and the models that share its memoryUsers; whoever makes one has to hold the lock
+type memoryUserTx struct {
+	s *memoryUsers
+}
+
+func (t memoryUserTx) Insert(ctx context.Context, user *User) error {
+	if t.s.emailTaken(user) {
+		return ErrDuplicate
+	}
+
+	user.ID = t.s.nextID
+	user.CreatedAt = time.Now().Truncate(time.Second)
+	user.Version = 1
+
+	stored := *user
+	t.s.users[user.ID] = &stored
+	t.s.nextID++
+
+	return nil
+}
+
+func (t memoryUserTx) AddPermissions(ctx context.Context, userID int64, codes ...string) error {
+	//the foreign key on users_permissions.user_id
+	if _, ok := t.s.users[userID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	if t.s.permissions[userID] == nil {
+		t.s.permissions[userID] = make(map[string]bool)
+	}
+
+	for _, code := range codes {
+		//the join on the permissions table skips codes that aren't in it
+		if ValidPermission(code) {
+			t.s.permissions[userID][code] = true
+		}
+	}
+
+	return nil
+}
+
+func (t memoryUserTx) NewToken(ctx context.Context, userID int64, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.insertToken(token)
+	return token, err
+}
+
+func (t memoryUserTx) insertToken(token *Token) error {
+	//the foreign key on tokens.user_id
+	if _, ok := t.s.users[token.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	var hash [sha256.Size]byte
+	copy(hash[:], token.Hash)
+
+	if _, ok := t.s.tokens[hash]; ok {
+		return ErrDuplicate
+	}
+
+	stored := *token
+	stored.Plaintext = "" //the database doesn't keep the plaintext either
+	t.s.tokens[hash] = &stored
+
+	return nil
+}
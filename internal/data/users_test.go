@@ -0,0 +1,158 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"readinglist/internal/migrate"
+)
+
+// newSQLiteTestModels gives every test its own SQLite file with the schema migrated all the way up
+func newSQLiteTestModels(t *testing.T) Models {
+	t.Helper()
+
+	dsn := "file:" + filepath.Join(t.TempDir(), "test.db") + "?_pragma=foreign_keys(1)&_time_format=sqlite"
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := migrate.New(db, "sqlite", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSQLiteModels(db, 3*time.Second)
+}
+
+func TestUserWithTxRollsBack(t *testing.T) {
+	stores := []struct {
+		name   string
+		models func(t *testing.T) Models
+	}{
+		{"memory", func(t *testing.T) Models { return NewMemoryModels() }},
+		{"sqlite", newSQLiteTestModels},
+	}
+
+	errLater := errors.New("a later step failed")
+
+	for _, store := range stores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			models := store.models(t)
+
+			alice := &User{Name: "Alice", Email: "alice@example.com"}
+			if err := alice.Password.Set("pa55word1234"); err != nil {
+				t.Fatal(err)
+			}
+
+			err := models.Users.WithTx(ctx, func(tx UserTx) error {
+				if err := tx.Insert(ctx, alice); err != nil {
+					return err
+				}
+				if err := tx.AddPermissions(ctx, alice.ID, PermissionBooksRead); err != nil {
+					return err
+				}
+				if _, err := tx.NewToken(ctx, alice.ID, time.Hour, ScopeActivation); err != nil {
+					return err
+				}
+				return errLater
+			})
+			if !errors.Is(err, errLater) {
+				t.Fatalf("WithTx = %v, want %v", err, errLater)
+			}
+
+			if _, err := models.Users.GetByEmail(ctx, alice.Email); !errors.Is(err, ErrRecordNotFound) {
+				t.Errorf("the user was saved even though the transaction was rolled back: %v", err)
+			}
+
+			//the email address can be used to sign up again
+			var token *Token
+			err = models.Users.WithTx(ctx, func(tx UserTx) error {
+				if err := tx.Insert(ctx, alice); err != nil {
+					return err
+				}
+				if err := tx.AddPermissions(ctx, alice.ID, PermissionBooksRead); err != nil {
+					return err
+				}
+				token, err = tx.NewToken(ctx, alice.ID, time.Hour, ScopeActivation)
+				return err
+			})
+			if err != nil {
+				t.Fatalf("signing up again: %v", err)
+			}
+
+			user, err := models.Users.GetForToken(ctx, ScopeActivation, token.Plaintext)
+			if err != nil || user.ID != alice.ID {
+				t.Fatalf("GetForToken = %v, %v, want user %d", user, err, alice.ID)
+			}
+
+			permissions, err := models.Permissions.GetAllForUser(ctx, alice.ID)
+			if err != nil || !permissions.Include(PermissionBooksRead) || len(permissions) != 1 {
+				t.Errorf("permissions = %v, %v, want only %s", permissions, err, PermissionBooksRead)
+			}
+		})
+	}
+}
+
+func TestUserUpdateConflict(t *testing.T) {
+	for _, store := range bookStores {
+		t.Run(store.name, func(t *testing.T) {
+			ctx := context.Background()
+			models := store.models(t)
+
+			alice := &User{Name: "Alice", Email: "alice@example.com"}
+			if err := alice.Password.Set("pa55word1234"); err != nil {
+				t.Fatal(err)
+			}
+			if err := models.Users.Insert(ctx, alice); err != nil {
+				t.Fatal(err)
+			}
+
+			//two copies of the same version, as two requests would have
+			first, err := models.Users.GetByEmail(ctx, alice.Email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second := *first
+
+			first.Activated = true
+			if err := models.Users.Update(ctx, first); err != nil {
+				t.Fatal(err)
+			}
+			if first.Version != alice.Version+1 {
+				t.Errorf("Version = %d after an update, want %d", first.Version, alice.Version+1)
+			}
+
+			second.Name = "Alicia"
+			if err := models.Users.Update(ctx, &second); !errors.Is(err, ErrEditConflict) {
+				t.Fatalf("Update of a stale version = %v, want %v", err, ErrEditConflict)
+			}
+
+			saved, err := models.Users.GetByEmail(ctx, alice.Email)
+			if err != nil || saved.Name != "Alice" || !saved.Activated {
+				t.Errorf("GetByEmail = %+v, %v, want the first update only", saved, err)
+			}
+
+			//another user can't take the email address
+			bob := &User{Name: "Bob", Email: "ALICE@example.com", Password: alice.Password}
+			if err := models.Users.Insert(ctx, bob); !errors.Is(err, ErrDuplicate) {
+				t.Errorf("Insert with the same email in capitals = %v, want %v", err, ErrDuplicate)
+			}
+		})
+	}
+}
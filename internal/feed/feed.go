@@ -0,0 +1,215 @@
+// Package feed writes the newest books as an Atom or RSS 2.0 feed, so people can follow a reading list in a feed reader
+// each item links to the book's page in the cmd/web frontend
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"readinglist/internal/data"
+)
+
+// the content types the feeds are served with
+const (
+	AtomType = "application/atom+xml; charset=utf-8"
+	RSSType  = "application/rss+xml; charset=utf-8"
+)
+
+// Channel is what the feed as a whole is about, the same for both formats
+type Channel struct {
+	ID          string              //a stable id for the feed, used as the Atom id
+	Title       string              //e.g. "Reading list: sci-fi"
+	Description string              //RSS requires one
+	SelfURL     string              //the absolute url the feed was fetched from
+	WebURL      string              //the cmd/web frontend, e.g. http://localhost; book pages are WebURL/book/view?id=N
+	Updated     time.Time           //when anything in the feed last changed
+	Revised     map[int64]time.Time //when each book was last changed, by id; a book that isn't in it was last changed when it was added
+}
+
+// revised is when the book was last changed, for the Atom entry's updated
+func (c Channel) revised(book *data.Book) time.Time {
+	if at, ok := c.Revised[book.ID]; ok {
+		return at
+	}
+	return book.CreatedAt
+}
+
+// BookURL is the link to a book's page in the frontend
+func (c Channel) BookURL(id int64) string {
+	return strings.TrimRight(c.WebURL, "/") + "/book/view?id=" + url.QueryEscape(strconv.FormatInt(id, 10))
+}
+
+// Summary describes a book in one line for feed readers, e.g. "by Frank Herbert · published 1965 · sci-fi, classic · rated 4.5/5"
+func Summary(book *data.Book) string {
+	var parts []string
+
+	if book.Author != "" {
+		parts = append(parts, "by "+book.Author)
+	}
+	if book.Published > 0 {
+		parts = append(parts, "published "+strconv.Itoa(book.Published))
+	}
+	if len(book.Genres) > 0 {
+		parts = append(parts, strings.Join(book.Genres, ", "))
+	}
+	if book.Rating > 0 {
+		parts = append(parts, fmt.Sprintf("rated %s/5", strconv.FormatFloat(float64(book.Rating), 'f', -1, 32)))
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published"`
+	Author     *atomPerson    `xml:"author,omitempty"`
+	Categories []atomCategory `xml:"category"`
+	Summary    string         `xml:"summary"`
+	Link       atomLink       `xml:"link"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// WriteAtom writes the books as an Atom feed
+// Atom requires an author for every entry, or for the feed; the feed's author is left out so a book without one gets "unknown"
+func WriteAtom(w io.Writer, channel Channel, books []*data.Book) error {
+	feed := atomFeed{
+		ID:      channel.ID,
+		Title:   channel.Title,
+		Updated: channel.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Href: channel.SelfURL, Type: "application/atom+xml"},
+			{Rel: "alternate", Href: channel.WebURL, Type: "text/html"},
+		},
+	}
+
+	for _, book := range books {
+		entry := atomEntry{
+			ID:        fmt.Sprintf("urn:readinglist:book:%d", book.ID),
+			Title:     book.Title,
+			Updated:   channel.revised(book).UTC().Format(time.RFC3339),
+			Published: book.CreatedAt.UTC().Format(time.RFC3339),
+			Author:    &atomPerson{Name: "unknown"},
+			Summary:   Summary(book),
+			Link:      atomLink{Rel: "alternate", Href: channel.BookURL(book.ID), Type: "text/html"},
+		}
+		if book.Author != "" {
+			entry.Author.Name = book.Author
+		}
+		for _, genre := range book.Genres {
+			entry.Categories = append(entry.Categories, atomCategory{Term: genre})
+		}
+
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	return write(w, feed)
+}
+
+type rssFeed struct {
+	XMLName   xml.Name   `xml:"rss"`
+	Version   string     `xml:"version,attr"`
+	XMLNSAtom string     `xml:"xmlns:atom,attr"`
+	XMLNSDC   string     `xml:"xmlns:dc,attr"`
+	Channel   rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Self          atomLink  `xml:"atom:link"` //RSS has no self link of its own, validators ask for the Atom one
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Author      string   `xml:"dc:creator,omitempty"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// WriteRSS writes the books as an RSS 2.0 feed
+// RSS's own author element has to be an email address, so the book's author goes in dc:creator like most feeds do
+func WriteRSS(w io.Writer, channel Channel, books []*data.Book) error {
+	feed := rssFeed{
+		Version:   "2.0",
+		XMLNSAtom: "http://www.w3.org/2005/Atom",
+		XMLNSDC:   "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         channel.Title,
+			Link:          channel.WebURL,
+			Description:   channel.Description,
+			LastBuildDate: channel.Updated.UTC().Format(time.RFC1123Z),
+			Self:          atomLink{Rel: "self", Href: channel.SelfURL, Type: "application/rss+xml"},
+		},
+	}
+
+	for _, book := range books {
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       book.Title,
+			Link:        channel.BookURL(book.ID),
+			GUID:        rssGUID{Value: fmt.Sprintf("urn:readinglist:book:%d", book.ID)},
+			PubDate:     book.CreatedAt.UTC().Format(time.RFC1123Z),
+			Author:      book.Author,
+			Categories:  book.Genres,
+			Description: Summary(book),
+		})
+	}
+
+	return write(w, feed)
+}
+
+// write writes v as an indented xml document
+func write(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,177 @@
+// Package goodreads reads the CSV file Goodreads produces from My Books > Import and export
+// each row is turned into a data.Book; nothing is saved here, that is left to whoever calls Parse
+package goodreads
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"readinglist/internal/data"
+)
+
+// the exclusive shelves say whether a book has been read rather than what kind of book it is, so they never become genres
+// a user can add exclusive shelves of their own, those are named in the Exclusive Shelf column of each row
+var defaultExclusiveShelves = []string{"read", "currently-reading", "to-read"}
+
+// DefaultGenre is used for books that aren't on any shelves of their own, because a book needs at least one genre
+const DefaultGenre = "Uncategorized"
+
+// maxGenres matches the limit in data.ValidateBook
+const maxGenres = 5
+
+// Record is one row of the export
+// Line is the line of the file the row started on, so problems can be reported in a way the user can find
+// ISBNs holds every ISBN the row had (ISBN13 first), Book.ISBN is the first of them
+// Errors holds the columns that couldn't be read, e.g. a page count that isn't a number
+type Record struct {
+	Line   int
+	Book   *data.Book
+	ISBNs  []string
+	Errors map[string]string
+}
+
+// Parse reads every row of a Goodreads export
+// an error is only returned when the file as a whole can't be read; problems with single rows are put in the Record
+func Parse(r io.Reader) ([]*Record, error) {
+	reader := csv.NewReader(r)
+	reader.LazyQuotes = true    //reviews are free text and not always quoted properly
+	reader.FieldsPerRecord = -1 //short rows are allowed, missing columns read as empty
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, errors.New("the file is empty")
+		}
+		return nil, fmt.Errorf("the file is not a valid CSV file: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i //a UTF-8 byte order mark may come before the first name
+	}
+
+	for _, required := range []string{"Title", "Author"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("the file is not a Goodreads export, it has no %s column", required)
+		}
+	}
+
+	var records []*Record
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("the file is not a valid CSV file: %w", err)
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		get := func(column string) string {
+			i, ok := columns[column]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+
+		records = append(records, parseRow(line, get))
+	}
+
+	return records, nil
+}
+
+// parseRow maps the Goodreads columns onto a book
+func parseRow(line int, get func(column string) string) *Record {
+	record := &Record{Line: line, Book: &data.Book{}, Errors: map[string]string{}}
+	book := record.Book
+
+	book.Title = get("Title")
+	book.Author = get("Author")
+
+	for _, column := range []string{"ISBN13", "ISBN"} {
+		if isbn := CleanISBN(get(column)); isbn != "" {
+			record.ISBNs = append(record.ISBNs, isbn)
+		}
+	}
+	if len(record.ISBNs) > 0 {
+		book.ISBN = record.ISBNs[0]
+	}
+
+	//Year Published is the edition on the shelf, which is blank more often than the year the book first came out
+	year := get("Year Published")
+	if year == "" {
+		year = get("Original Publication Year")
+	}
+	book.Published = record.readInt("published", year)
+
+	book.Pages = record.readInt("pages", get("Number of Pages"))
+	book.Rating = float32(record.readInt("rating", get("My Rating"))) //0 means the book wasn't rated
+
+	book.Genres = shelvesToGenres(get("Bookshelves"), get("Exclusive Shelf"))
+
+	return record
+}
+
+// readInt reads a whole number column; a blank column is 0 and is left for data.ValidateBook to complain about if it matters
+func (record *Record) readInt(field, value string) int {
+	if value == "" {
+		return 0
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		record.Errors[field] = fmt.Sprintf("%q is not a whole number", value)
+		return 0
+	}
+
+	return i
+}
+
+// CleanISBN takes away the ="..." Goodreads wraps the ISBN columns in so spreadsheets don't turn them into numbers
+// ="0441172717" becomes 0441172717 and ="" becomes an empty string
+func CleanISBN(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "=")
+	s = strings.Trim(s, `"`)
+
+	return strings.TrimSpace(s)
+}
+
+// shelvesToGenres turns the comma separated Bookshelves column into genres
+// exclusive shelves are left out and so are shelves that only differ in case, and there are never more than maxGenres
+func shelvesToGenres(shelves, exclusiveShelf string) []string {
+	skip := map[string]bool{strings.ToLower(exclusiveShelf): true}
+	for _, shelf := range defaultExclusiveShelves {
+		skip[shelf] = true
+	}
+
+	genres := []string{}
+
+	for _, shelf := range strings.Split(shelves, ",") {
+		shelf = strings.TrimSpace(shelf)
+		key := strings.ToLower(shelf)
+
+		if shelf == "" || skip[key] {
+			continue
+		}
+		skip[key] = true
+
+		if len(genres) == maxGenres {
+			break
+		}
+		genres = append(genres, shelf)
+	}
+
+	if len(genres) == 0 {
+		genres = append(genres, DefaultGenre)
+	}
+
+	return genres
+}
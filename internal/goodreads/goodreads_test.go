@@ -0,0 +1,121 @@
+package goodreads
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCleanISBN(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`="0441172717"`, "0441172717"},
+		{`="9780441172719"`, "9780441172719"},
+		{`=""`, ""},
+		{` ="0441172717" `, "0441172717"},
+		{"0441172717", "0441172717"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := CleanISBN(tt.in); got != tt.want {
+			t.Errorf("CleanISBN(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	export := "\ufeffBook Id,Title,Author,ISBN,ISBN13,My Rating,Number of Pages,Year Published,Original Publication Year,Bookshelves,Exclusive Shelf\n" +
+		`234225,Dune,Frank Herbert,="0441172717",="9780441172719",5,604,1990,1965,"sci-fi, classics, read, Sci-Fi",read` + "\n" +
+		`1,No Shelves,Someone,="",="",0,,,2001,,to-read` + "\n" +
+		`2,Bad Pages,Someone,="",="",3,lots,2010,,"currently-reading, owned",currently-reading` + "\n" +
+		`3,Short Row,Someone` + "\n"
+
+	records, err := Parse(strings.NewReader(export))
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("Parse returned %d records, want 4", len(records))
+	}
+
+	dune := records[0]
+	if dune.Line != 2 {
+		t.Errorf("dune.Line = %d, want 2", dune.Line)
+	}
+	if got, want := dune.ISBNs, []string{"9780441172719", "0441172717"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dune.ISBNs = %q, want %q", got, want)
+	}
+
+	book := dune.Book
+	if book.Title != "Dune" || book.Author != "Frank Herbert" || book.ISBN != "9780441172719" {
+		t.Errorf("dune = %+v", book)
+	}
+	if book.Published != 1990 || book.Pages != 604 || book.Rating != 5 {
+		t.Errorf("dune published, pages, rating = %d, %d, %v, want 1990, 604, 5", book.Published, book.Pages, book.Rating)
+	}
+	//read is an exclusive shelf and Sci-Fi only differs from sci-fi in case
+	if got, want := book.Genres, []string{"sci-fi", "classics"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dune genres = %q, want %q", got, want)
+	}
+
+	noShelves := records[1].Book
+	if noShelves.Published != 2001 {
+		t.Errorf("the original publication year should be used when there is no year published, got %d", noShelves.Published)
+	}
+	if got, want := noShelves.Genres, []string{DefaultGenre}; !reflect.DeepEqual(got, want) {
+		t.Errorf("no shelves genres = %q, want %q", got, want)
+	}
+	if len(records[1].ISBNs) != 0 || noShelves.ISBN != "" {
+		t.Errorf("empty ISBN columns gave %q", records[1].ISBNs)
+	}
+
+	if _, ok := records[2].Errors["pages"]; !ok {
+		t.Errorf("a page count that isn't a number should be an error, got %v", records[2].Errors)
+	}
+
+	if short := records[3].Book; short.Title != "Short Row" || short.Pages != 0 {
+		t.Errorf("short row = %+v", short)
+	}
+}
+
+func TestParseNotAnExport(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"no author column", "Title,Pages\nDune,604\n"},
+		{"no title column", "Author,Pages\nFrank Herbert,604\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.in)); err == nil {
+				t.Error("Parse returned no error")
+			}
+		})
+	}
+}
+
+func TestShelvesToGenres(t *testing.T) {
+	tests := []struct {
+		shelves   string
+		exclusive string
+		want      []string
+	}{
+		{"sci-fi, classics", "read", []string{"sci-fi", "classics"}},
+		{"a, b, c, d, e, f", "read", []string{"a", "b", "c", "d", "e"}},
+		{"abandoned, horror", "abandoned", []string{"horror"}}, //a user's own exclusive shelf
+		{"to-read, currently-reading", "to-read", []string{DefaultGenre}},
+		{"", "read", []string{DefaultGenre}},
+	}
+
+	for _, tt := range tests {
+		if got := shelvesToGenres(tt.shelves, tt.exclusive); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("shelvesToGenres(%q, %q) = %q, want %q", tt.shelves, tt.exclusive, got, tt.want)
+		}
+	}
+}
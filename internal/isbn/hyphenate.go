@@ -0,0 +1,196 @@
+package isbn
+
+import "strings"
+
+// Hyphenate writes the ISBN with hyphens between its parts: prefix (ISBN-13 only), registration group, registrant, publication and check digit
+// e.g. 9780441172719 is 978-0-441-17271-9 and 0441172717 is 0-441-17271-7; an ISBN-10 stays ten digits and an ISBN-13 stays thirteen
+//
+// where the hyphens go isn't in the number itself, it depends on how each group hands out its ranges,
+// so an ISBN in a group that isn't in the ranges table gets ErrUnknownRange and the caller has to show it without hyphens
+func Hyphenate(s string) (string, error) {
+	isbn13, err := To13(s)
+	if err != nil {
+		return "", err
+	}
+
+	prefix, group, registrant, publication, err := split(isbn13)
+	if err != nil {
+		return "", err
+	}
+
+	if len(Normalize(s)) == 10 {
+		isbn10, _ := To10(isbn13)
+		return strings.Join([]string{group, registrant, publication, isbn10[9:]}, "-"), nil
+	}
+
+	return strings.Join([]string{prefix, group, registrant, publication, isbn13[12:]}, "-"), nil
+}
+
+// split cuts an ISBN-13 without its check digit into the parts that get hyphens between them
+func split(isbn13 string) (prefix, group, registrant, publication string, err error) {
+	prefix = isbn13[:3]
+	rest := isbn13[3:12]
+
+	//no group code is the start of another one, so the first length that is in the table is the group
+	for length := 1; length <= 5; length++ {
+		ranges, ok := registrantRanges[prefix+"-"+rest[:length]]
+		if !ok {
+			continue
+		}
+
+		group, rest = rest[:length], rest[length:]
+
+		//the ranges are written as the next seven digits, so a short remainder is padded with zeros to compare
+		key := (rest + "0000000")[:7]
+		for _, r := range ranges {
+			if key >= r.from && key <= r.to {
+				if r.length == 0 || r.length >= len(rest) {
+					return "", "", "", "", ErrUnknownRange
+				}
+				return prefix, group, rest[:r.length], rest[r.length:], nil
+			}
+		}
+
+		return "", "", "", "", ErrUnknownRange
+	}
+
+	return "", "", "", "", ErrUnknownRange
+}
+
+// registrantRange says how many digits the registrant (publisher) part has for the registrants from..to
+// a length of 0 is a range the group hasn't handed out yet
+type registrantRange struct {
+	from, to string
+	length   int
+}
+
+// registrantRanges is copied from the RangeMessage.xml the International ISBN Agency publishes (https://www.isbn-international.org/range_file_generation)
+// only the biggest groups are here: English, French and German speaking countries, Japan and China
+// a book from another group still validates and converts, it just can't be hyphenated; add its group from the range file when one turns up
+var registrantRanges = map[string][]registrantRange{
+	//English
+	"978-0": {
+		{"0000000", "1999999", 2},
+		{"2000000", "2279999", 3},
+		{"2280000", "2289999", 4},
+		{"2290000", "3689999", 3},
+		{"3690000", "3699999", 4},
+		{"3700000", "6389999", 3},
+		{"6390000", "6397999", 4},
+		{"6398000", "6399999", 7},
+		{"6400000", "6449999", 3},
+		{"6450000", "6459999", 7},
+		{"6460000", "6479999", 3},
+		{"6480000", "6489999", 7},
+		{"6490000", "6549999", 3},
+		{"6550000", "6559999", 4},
+		{"6560000", "6999999", 3},
+		{"7000000", "8499999", 4},
+		{"8500000", "8999999", 5},
+		{"9000000", "9499999", 6},
+		{"9500000", "9999999", 7},
+	},
+	"978-1": {
+		{"0000000", "0999999", 2},
+		{"1000000", "3999999", 3},
+		{"4000000", "5499999", 4},
+		{"5500000", "7319999", 5},
+		{"7320000", "7399999", 7},
+		{"7400000", "7749999", 5},
+		{"7750000", "7753999", 7},
+		{"7754000", "7763999", 5},
+		{"7764000", "7764999", 7},
+		{"7765000", "7769999", 5},
+		{"7770000", "7782999", 7},
+		{"7783000", "7899999", 5},
+		{"7900000", "7999999", 4},
+		{"8000000", "8671999", 5},
+		{"8672000", "8675999", 4},
+		{"8676000", "8697999", 5},
+		{"8698000", "9159999", 6},
+		{"9160000", "9165059", 7},
+		{"9165060", "9168699", 6},
+		{"9168700", "9169079", 7},
+		{"9169080", "9195999", 6},
+		{"9196000", "9196549", 7},
+		{"9196550", "9729999", 6},
+		{"9730000", "9877999", 4},
+		{"9878000", "9989999", 6},
+		{"9990000", "9999999", 7},
+	},
+	//United States, where most English language self-published books get their ISBNs now
+	"979-8": {
+		{"0000000", "1999999", 0},
+		{"2000000", "2299999", 3},
+		{"2300000", "3499999", 0},
+		{"3500000", "3999999", 4},
+		{"4000000", "8499999", 4},
+		{"8500000", "8849999", 4},
+		{"8850000", "8999999", 5},
+		{"9000000", "9849999", 0},
+		{"9850000", "9899999", 7},
+		{"9900000", "9999999", 0},
+	},
+	//French
+	"978-2": {
+		{"0000000", "1999999", 2},
+		{"2000000", "3499999", 3},
+		{"3500000", "3999999", 5},
+		{"4000000", "4899999", 3},
+		{"4900000", "4949999", 6},
+		{"4950000", "4959999", 3},
+		{"4960000", "4966999", 4},
+		{"4967000", "4969999", 5},
+		{"4970000", "5279999", 3},
+		{"5280000", "5299999", 4},
+		{"5300000", "6999999", 3},
+		{"7000000", "8399999", 4},
+		{"8400000", "8999999", 5},
+		{"9000000", "9197999", 6},
+		{"9198000", "9198099", 5},
+		{"9198100", "9199429", 6},
+		{"9199430", "9199689", 7},
+		{"9199690", "9499999", 6},
+		{"9500000", "9999999", 7},
+	},
+	"979-10": {
+		{"0000000", "1999999", 2},
+		{"2000000", "6999999", 3},
+		{"7000000", "8999999", 4},
+		{"9000000", "9759999", 5},
+		{"9760000", "9999999", 6},
+	},
+	//German
+	"978-3": {
+		{"0000000", "0299999", 2},
+		{"0300000", "0339999", 3},
+		{"0340000", "0369999", 4},
+		{"0370000", "0399999", 5},
+		{"0400000", "1999999", 2},
+		{"2000000", "6999999", 3},
+		{"7000000", "8499999", 4},
+		{"8500000", "8999999", 5},
+		{"9000000", "9499999", 6},
+		{"9500000", "9539999", 7},
+		{"9540000", "9699999", 5},
+		{"9700000", "9849999", 7},
+		{"9850000", "9999999", 5},
+	},
+	//Japan
+	"978-4": {
+		{"0000000", "1999999", 2},
+		{"2000000", "6999999", 3},
+		{"7000000", "8499999", 4},
+		{"8500000", "8999999", 5},
+		{"9000000", "9499999", 6},
+		{"9500000", "9999999", 7},
+	},
+	//China
+	"978-7": {
+		{"0000000", "0999999", 2},
+		{"1000000", "4999999", 3},
+		{"5000000", "7999999", 4},
+		{"8000000", "8999999", 5},
+		{"9000000", "9999999", 6},
+	},
+}
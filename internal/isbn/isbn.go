@@ -0,0 +1,116 @@
+// Package isbn checks, converts and formats International Standard Book Numbers
+// an ISBN can be written as ten digits (before 2007) or thirteen, with or without hyphens, so the same book can be written lots of ways;
+// To13 turns any of them into the one canonical form the books are stored and looked up by
+package isbn
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrInvalid is returned for anything that isn't ten or thirteen digits with a check digit that adds up (and 978 or 979 in front of thirteen)
+	ErrInvalid = errors.New("not a valid ISBN-10 or ISBN-13")
+
+	// ErrNoISBN10 is returned by To10 for an ISBN-13 that starts with 979, those were never given ISBN-10s
+	ErrNoISBN10 = errors.New("only ISBN-13s starting with 978 have an ISBN-10")
+
+	// ErrUnknownRange is returned by Hyphenate when the registration group or publisher range isn't in the range table
+	ErrUnknownRange = errors.New("the ISBN is not in a known registration range")
+)
+
+// Normalize drops the hyphens and spaces from an ISBN and upper cases the X check digit, it doesn't check anything
+func Normalize(s string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(s)))
+}
+
+// Valid reports whether s is an ISBN-10 or ISBN-13 with the right check digit, ignoring any hyphens or spaces
+// ISBN-10: the digits are weighted 10 down to 1 and the sum has to divide by 11 (the last one can be X, meaning 10)
+// ISBN-13: the digits are weighted 1, 3, 1, 3... and the sum has to divide by 10, and it has to start with 978 or 979;
+// any other EAN-13 barcode adds up the same way but is a product, not a book
+func Valid(s string) bool {
+	s = Normalize(s)
+
+	switch len(s) {
+	case 10:
+		return digits(s[:9]) && (isDigit(s[9]) || s[9] == 'X') && checkDigit10(s[:9]) == s[9]
+	case 13:
+		return digits(s) && (strings.HasPrefix(s, "978") || strings.HasPrefix(s, "979")) && checkDigit13(s[:12]) == s[12]
+	default:
+		return false
+	}
+}
+
+// To13 returns the ISBN-13 for s, without hyphens; an ISBN-10 gets 978 in front and a new check digit
+func To13(s string) (string, error) {
+	if !Valid(s) {
+		return "", ErrInvalid
+	}
+
+	s = Normalize(s)
+	if len(s) == 13 {
+		return s, nil
+	}
+
+	body := "978" + s[:9]
+	return body + string(checkDigit13(body)), nil
+}
+
+// To10 returns the ISBN-10 for s, without hyphens
+func To10(s string) (string, error) {
+	if !Valid(s) {
+		return "", ErrInvalid
+	}
+
+	s = Normalize(s)
+	if len(s) == 10 {
+		return s, nil
+	}
+	if !strings.HasPrefix(s, "978") {
+		return "", ErrNoISBN10
+	}
+
+	body := s[3:12]
+	return body + string(checkDigit10(body)), nil
+}
+
+// checkDigit10 works out the last character of an ISBN-10 from the nine before it
+func checkDigit10(body string) byte {
+	sum := 0
+	for i := 0; i < 9; i++ {
+		sum += int(body[i]-'0') * (10 - i)
+	}
+
+	check := (11 - sum%11) % 11
+	if check == 10 {
+		return 'X'
+	}
+	return byte('0' + check)
+}
+
+// checkDigit13 works out the last digit of an ISBN-13 from the twelve before it
+func checkDigit13(body string) byte {
+	sum := 0
+	for i := 0; i < 12; i++ {
+		weight := 1
+		if i%2 == 1 {
+			weight = 3
+		}
+		sum += int(body[i]-'0') * weight
+	}
+
+	return byte('0' + (10-sum%10)%10)
+}
+
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,105 @@
+package isbn
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValid(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"0441172717", true},
+		{"0-441-17271-7", true},
+		{"0 441 17271 7", true},
+		{"080442957X", true},
+		{"080442957x", true},
+		{"9780441172719", true},
+		{"978-0-441-17271-9", true},
+		{"9798642138427", true},
+		{"0441172718", false},    //wrong check digit
+		{"9780441172710", false}, //wrong check digit
+		{"4006381333931", false}, //a valid EAN-13, but a product and not a book
+		{"X441172717", false},    //X can only be the check digit
+		{"044117271", false},
+		{"97804411727190", false},
+		{"", false},
+		{"abcdefghij", false},
+	}
+
+	for _, tt := range tests {
+		if got := Valid(tt.in); got != tt.want {
+			t.Errorf("Valid(%q) = %t, want %t", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTo13(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{"0441172717", "9780441172719", nil},
+		{"0-441-17271-7", "9780441172719", nil},
+		{"080442957X", "9780804429573", nil},
+		{"978-0-441-17271-9", "9780441172719", nil},
+		{"9798642138427", "9798642138427", nil},
+		{"0441172718", "", ErrInvalid},
+		{"4006381333931", "", ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		got, err := To13(tt.in)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("To13(%q) = %q, %v, want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestTo10(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{"9780441172719", "0441172717", nil},
+		{"978-0-8044-2957-3", "080442957X", nil},
+		{"0441172717", "0441172717", nil},
+		{"9798642138427", "", ErrNoISBN10},
+		{"9780441172710", "", ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		got, err := To10(tt.in)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("To10(%q) = %q, %v, want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestHyphenate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  error
+	}{
+		{"9780441172719", "978-0-441-17271-9", nil},
+		{"0441172717", "0-441-17271-7", nil},
+		{"9798642138427", "979-8-6421-3842-7", nil},
+		{"9798212345675", "979-8-212-34567-5", nil},
+		{"9791032705537", "979-10-327-0553-7", nil},
+		{"9783161484100", "978-3-16-148410-0", nil},
+		{"9798012345677", "", ErrUnknownRange}, //979-8 hasn't handed out 0000000 to 1999999
+		{"9786070000003", "", ErrUnknownRange}, //a group that isn't in the table
+		{"0441172718", "", ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		got, err := Hyphenate(tt.in)
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("Hyphenate(%q) = %q, %v, want %q, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
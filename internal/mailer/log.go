@@ -0,0 +1,57 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Log stands in for a mail server while developing
+// with a Dir each message is written there as an .eml file that any mail program can open, without one the plain text is written to the log
+type Log struct {
+	Logger *log.Logger
+	Dir    string
+	Sender string
+}
+
+func (m Log) Send(msg *Message) error {
+	if m.Dir == "" {
+		m.Logger.Printf("email to %s: %s\n%s", msg.To, msg.Subject, msg.PlainBody)
+		return nil
+	}
+
+	body, err := msg.Bytes(m.Sender)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+
+	//the time first so the files sort in the order they were sent
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405.000000"), fileSafe(msg.To))
+	path := filepath.Join(m.Dir, name)
+
+	if err := os.WriteFile(path, body, 0o644); err != nil {
+		return err
+	}
+
+	m.Logger.Printf("email to %s written to %s", msg.To, path)
+	return nil
+}
+
+// fileSafe keeps the letters, digits, dots and @ of an email address so it can go in a file name
+func fileSafe(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '@', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,138 @@
+// Package mailer sends the emails the api sends to users, like the one with the token that activates a new account
+// the emails are Go templates in templates/, each with a subject, a plain text body and an HTML body
+// Mailer is an interface so it can be SMTP for real or Log while developing, when there is no mail server to hand
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	ttemplate "text/template"
+	"time"
+)
+
+//go:embed templates
+var templateFS embed.FS
+
+// Mailer sends a message that was made with Render
+type Mailer interface {
+	Send(msg *Message) error
+}
+
+// Message is one email, ready to send
+type Message struct {
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Render fills in the template (e.g. "user_welcome.tmpl") with data and returns the email for the recipient
+// the subject and plain text body go through text/template and the HTML body through html/template, so only the HTML is escaped
+func Render(recipient, templateFile string, data any) (*Message, error) {
+	textTmpl, err := ttemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlTmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &Message{To: recipient}
+
+	var buf bytes.Buffer
+	for _, part := range []struct {
+		name string
+		dst  *string
+		tmpl interface {
+			ExecuteTemplate(w io.Writer, name string, data any) error
+		}
+	}{
+		{"subject", &msg.Subject, textTmpl},
+		{"plainBody", &msg.PlainBody, textTmpl},
+		{"htmlBody", &msg.HTMLBody, htmlTmpl},
+	} {
+		buf.Reset()
+		if err := part.tmpl.ExecuteTemplate(&buf, part.name, data); err != nil {
+			return nil, err
+		}
+		*part.dst = strings.TrimSpace(buf.String())
+	}
+
+	return msg, nil
+}
+
+// Bytes writes the message out as a MIME email from sender, with the plain text and HTML bodies as alternatives
+func (msg *Message) Bytes(sender string) ([]byte, error) {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	for _, alternative := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.PlainBody},
+		{"text/html; charset=utf-8", msg.HTMLBody},
+	} {
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Type", alternative.contentType)
+		header.Set("Content-Transfer-Encoding", "8bit")
+
+		w, err := parts.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(crlf(alternative.content) + "\r\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+
+	headers := [][2]string{
+		{"From", sender},
+		{"To", msg.To},
+		{"Subject", mime.QEncoding.Encode("utf-8", msg.Subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID(sender)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + parts.Boundary()},
+	}
+	for _, header := range headers {
+		fmt.Fprintf(&out, "%s: %s\r\n", header[0], header[1])
+	}
+
+	out.WriteString("\r\n")
+	out.Write(body.Bytes())
+
+	return out.Bytes(), nil
+}
+
+// crlf turns the line endings into the \r\n email needs
+func crlf(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+}
+
+// messageID makes a unique id in the sender's domain, some spam filters mark down email without one
+func messageID(sender string) string {
+	random := make([]byte, 12)
+	_, _ = rand.Read(random)
+
+	domain := "localhost"
+	if at := strings.LastIndex(sender, "@"); at >= 0 {
+		domain = strings.TrimRight(sender[at+1:], "> ")
+	}
+
+	return "<" + hex.EncodeToString(random) + "@" + domain + ">"
+}
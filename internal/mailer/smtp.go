@@ -0,0 +1,88 @@
+package mailer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"time"
+)
+
+// SMTP sends the messages through a mail server
+// the connection is upgraded with STARTTLS when the server offers it, and the username and password are only sent when one is set
+type SMTP struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	Sender   string        // e.g. "Reading List <no-reply@example.com>"
+	Timeout  time.Duration // how long the whole conversation with the server can take, 10 seconds if it isn't set
+}
+
+func (m SMTP) Send(msg *Message) error {
+	from, err := mail.ParseAddress(m.Sender)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", m.Sender, err)
+	}
+
+	body, err := msg.Bytes(m.Sender)
+	if err != nil {
+		return err
+	}
+
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	//smtp.SendMail would do most of this, but it has no timeout and a mail server that hangs would leave the goroutine sending the email stuck forever
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(m.Host, fmt.Sprint(m.Port)), timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: m.Host}); err != nil {
+			return err
+		}
+	}
+
+	//PlainAuth refuses to send the password over a connection that isn't encrypted, unless the server is on localhost
+	if m.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
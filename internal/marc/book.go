@@ -0,0 +1,267 @@
+package marc
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"readinglist/internal/citation"
+	"readinglist/internal/data"
+	"readinglist/internal/isbn"
+)
+
+// the fields a book is mapped to and from:
+//
+//	020 $a  ISBN (every 020 is kept as one of the record's ISBNs, the first is the book's)
+//	100 $a  author, "Family, Given" in MARC and "Given Family" in a book
+//	245 $a  title, with $b (the subtitle) after a colon
+//	264 $c  year of publication (260 $c in older records)
+//	300 $a  number of pages, e.g. "412 pages" or "xii, 412 p."
+//	650 $a  topical subjects and 655 $a genre terms, both become genres
+//
+// MARC has nowhere for a rating, so ratings aren't exported and imported books have none
+
+// DefaultGenre is used for records with no subjects, because a book needs at least one genre (the Goodreads import does the same)
+const DefaultGenre = "Uncategorized"
+
+// maxGenres matches the limit in data.ValidateBook
+const maxGenres = 5
+
+// ToBook maps a record onto a book
+// isbns holds every ISBN in the record; problems holds the fields that couldn't be read, keyed by the book field like a validator
+func ToBook(record *Record) (book *data.Book, isbns []string, problems map[string]string) {
+	book = &data.Book{}
+	problems = map[string]string{}
+
+	for _, field := range record.Fields("020") {
+		//the ISBN is often followed by a qualifier, e.g. "0441172717 (pbk.)"
+		if isbn := firstWord(field.Subfield('a')); isbn != "" {
+			isbns = append(isbns, isbn)
+		}
+	}
+	if len(isbns) > 0 {
+		book.ISBN = isbns[0]
+	}
+
+	if fields := record.Fields("100"); len(fields) > 0 {
+		book.Author = directOrder(trimPunctuation(fields[0].Subfield('a')))
+	}
+
+	if fields := record.Fields("245"); len(fields) > 0 {
+		title := trimPunctuation(fields[0].Subfield('a'))
+		if subtitle := trimPunctuation(fields[0].Subfield('b')); subtitle != "" {
+			title += ": " + subtitle
+		}
+		book.Title = title
+	}
+
+	//264 with a second indicator of 1 is the publication statement, other 264s are about production, distribution and so on
+	var published string
+	for _, field := range record.Fields("264") {
+		if field.Ind2 == '1' && published == "" {
+			published = field.Subfield('c')
+		}
+	}
+	for _, field := range record.Fields("260") {
+		if published == "" {
+			published = field.Subfield('c')
+		}
+	}
+	if published != "" {
+		if year := yearPattern.FindString(published); year != "" {
+			book.Published, _ = strconv.Atoi(year)
+		} else {
+			problems["published"] = fmt.Sprintf("%q does not have a year in it", published)
+		}
+	}
+
+	if fields := record.Fields("300"); len(fields) > 0 {
+		extent := fields[0].Subfield('a')
+		if pages := numberPattern.FindAllString(extent, -1); len(pages) > 0 {
+			//the last number is the page count, the ones before are things like volumes or roman numbered front matter
+			book.Pages, _ = strconv.Atoi(pages[len(pages)-1])
+		} else if extent != "" {
+			problems["pages"] = fmt.Sprintf("%q does not have a page count in it", extent)
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, tag := range []string{"650", "655"} {
+		for _, field := range record.Fields(tag) {
+			genre := trimPunctuation(field.Subfield('a'))
+			key := strings.ToLower(genre)
+
+			if genre == "" || seen[key] || len(book.Genres) == maxGenres {
+				continue
+			}
+			seen[key] = true
+			book.Genres = append(book.Genres, genre)
+		}
+	}
+	if len(book.Genres) == 0 {
+		book.Genres = []string{DefaultGenre}
+	}
+
+	return book, isbns, problems
+}
+
+var (
+	yearPattern   = regexp.MustCompile(`\d{4}`)
+	numberPattern = regexp.MustCompile(`\d+`)
+)
+
+// FromBook maps a book onto a record; 001 is the book's id so a record sent back can be matched to the book
+func FromBook(book *data.Book) *Record {
+	record := &Record{Leader: DefaultLeader}
+
+	record.ControlFields = []ControlField{
+		{Tag: "001", Value: strconv.FormatInt(book.ID, 10)},
+		{Tag: "008", Value: fixedLengthData(book)},
+	}
+
+	if book.ISBN != "" {
+		record.DataFields = append(record.DataFields, DataField{
+			Tag: "020", Ind1: ' ', Ind2: ' ',
+			Subfields: []Subfield{{Code: 'a', Value: isbn.Normalize(book.ISBN)}},
+		})
+	}
+
+	//the first indicator of 245 says whether there is a 1XX author field, the second how many characters to skip when sorting ("The " is 4)
+	titleInd1 := byte('0')
+	if book.Author != "" {
+		titleInd1 = '1'
+		record.DataFields = append(record.DataFields, DataField{
+			Tag: "100", Ind1: '1', Ind2: ' ',
+			Subfields: []Subfield{{Code: 'a', Value: withFullStop(invertedOrder(book.Author))}},
+		})
+	}
+
+	record.DataFields = append(record.DataFields, DataField{
+		Tag: "245", Ind1: titleInd1, Ind2: nonfilingCharacters(book.Title),
+		Subfields: []Subfield{{Code: 'a', Value: withFullStop(book.Title)}},
+	})
+
+	if book.Published > 0 {
+		record.DataFields = append(record.DataFields, DataField{
+			Tag: "264", Ind1: ' ', Ind2: '1',
+			Subfields: []Subfield{{Code: 'c', Value: strconv.Itoa(book.Published) + "."}},
+		})
+	}
+
+	if book.Pages > 0 {
+		record.DataFields = append(record.DataFields, DataField{
+			Tag: "300", Ind1: ' ', Ind2: ' ',
+			Subfields: []Subfield{{Code: 'a', Value: fmt.Sprintf("%d pages", book.Pages)}},
+		})
+	}
+
+	//a second indicator of 4 means the subject doesn't come from a named thesaurus like LCSH, which a free text genre doesn't
+	for _, genre := range book.Genres {
+		record.DataFields = append(record.DataFields, DataField{
+			Tag: "650", Ind1: ' ', Ind2: '4',
+			Subfields: []Subfield{{Code: 'a', Value: withFullStop(genre)}},
+		})
+	}
+
+	return record
+}
+
+// fixedLengthData is the 40 character 008 field; only the date entered, the year and the record source are known,
+// the language is "und" (undetermined) and the country is "xx " (unknown)
+func fixedLengthData(book *data.Book) string {
+	entered := book.CreatedAt
+	if entered.IsZero() {
+		entered = time.Now()
+	}
+
+	year := "    "
+	dateType := "n" //n means the date is unknown
+	if book.Published > 0 {
+		year = fmt.Sprintf("%04d", book.Published)
+		dateType = "s" //s means a single known date
+	}
+
+	return entered.UTC().Format("060102") + dateType + year + "    " + "xx " + strings.Repeat(" ", 17) + "und" + " " + "d"
+}
+
+// nonfilingCharacters is how many characters at the start of the title are skipped when sorting
+func nonfilingCharacters(title string) byte {
+	lower := strings.ToLower(title)
+	for _, article := range []string{"the ", "an ", "a "} {
+		if strings.HasPrefix(lower, article) {
+			return byte('0' + len(article))
+		}
+	}
+	return '0'
+}
+
+// invertedOrder turns "Frank Herbert" into "Herbert, Frank", the way MARC name headings are written
+func invertedOrder(author string) string {
+	name, ok := citation.ParseName(author)
+	if !ok || name.Given == "" {
+		return strings.TrimSpace(author)
+	}
+
+	inverted := name.Family + ", " + name.Given
+	if name.Suffix != "" {
+		inverted += ", " + name.Suffix
+	}
+	return inverted
+}
+
+// directOrder turns "Herbert, Frank" back into "Frank Herbert"
+func directOrder(heading string) string {
+	name, ok := citation.ParseName(heading)
+	if !ok || name.Given == "" || !strings.Contains(heading, ",") {
+		return heading
+	}
+
+	direct := name.Given + " " + name.Family
+	if name.Suffix != "" {
+		direct += " " + name.Suffix
+	}
+	return direct
+}
+
+// trimPunctuation takes off the punctuation MARC puts at the end of fields to separate them when they are printed,
+// e.g. "Dune /" and "Herbert, Frank," and "Science fiction."
+// a full stop after an initial ("Le Guin, Ursula K.") is kept
+func trimPunctuation(s string) string {
+	s = strings.TrimSpace(s)
+
+	for {
+		trimmed := strings.TrimRight(s, " /:;,=")
+		if strings.HasSuffix(trimmed, ".") && !endsWithInitial(trimmed) {
+			trimmed = strings.TrimSuffix(trimmed, ".")
+		}
+		if trimmed == s {
+			return s
+		}
+		s = trimmed
+	}
+}
+
+// withFullStop ends a field with a full stop the way catalogues do, unless it already ends with one (or a ? or !)
+func withFullStop(s string) string {
+	if strings.HasSuffix(s, ".") || strings.HasSuffix(s, "?") || strings.HasSuffix(s, "!") {
+		return s
+	}
+	return s + "."
+}
+
+// endsWithInitial is true for "Ursula K." but not "Dune."
+func endsWithInitial(s string) bool {
+	s = strings.TrimSuffix(s, ".")
+	i := strings.LastIndex(s, " ")
+	return len(s)-i-1 == 1
+}
+
+func firstWord(s string) string {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ""
+	}
+	return fields[0]
+}
@@ -0,0 +1,313 @@
+// Package marc reads and writes MARC 21 bibliographic records, the format library catalogues share records in
+// records can be binary ISO 2709 (usually .mrc files) or MARCXML, and ToBook and FromBook map them to and from data.Book
+package marc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// the separators ISO 2709 uses between the parts of a record
+const (
+	subfieldDelimiter = 0x1F
+	fieldTerminator   = 0x1E
+	recordTerminator  = 0x1D
+)
+
+// the leader and each directory entry are fixed length
+const (
+	leaderLength    = 24
+	directoryLength = 12
+)
+
+// Record is one MARC record
+// control fields (tags 001 to 009) only have a value, data fields have two indicators and a list of subfields
+type Record struct {
+	Leader        string
+	ControlFields []ControlField
+	DataFields    []DataField
+}
+
+type ControlField struct {
+	Tag   string
+	Value string
+}
+
+type DataField struct {
+	Tag       string
+	Ind1      byte
+	Ind2      byte
+	Subfields []Subfield
+}
+
+type Subfield struct {
+	Code  byte
+	Value string
+}
+
+// Fields returns the data fields with the tag, in the order they are in the record
+func (r *Record) Fields(tag string) []DataField {
+	var fields []DataField
+	for _, field := range r.DataFields {
+		if field.Tag == tag {
+			fields = append(fields, field)
+		}
+	}
+	return fields
+}
+
+// Control returns the value of the control field with the tag, or "" if there isn't one
+func (r *Record) Control(tag string) string {
+	for _, field := range r.ControlFields {
+		if field.Tag == tag {
+			return field.Value
+		}
+	}
+	return ""
+}
+
+// Subfield returns the first subfield with the code, or "" if there isn't one
+func (f DataField) Subfield(code byte) string {
+	for _, subfield := range f.Subfields {
+		if subfield.Code == code {
+			return subfield.Value
+		}
+	}
+	return ""
+}
+
+// isControlTag is true for 001 to 009, which are control fields and have no indicators or subfields
+func isControlTag(tag string) bool {
+	return len(tag) == 3 && tag[0] == '0' && tag[1] == '0' && tag[2] >= '1' && tag[2] <= '9'
+}
+
+// Reader reads ISO 2709 records one at a time
+// each record is read up to its record terminator rather than by the length in its leader,
+// so a record with a broken leader or directory only loses that record and the next one can still be read
+type Reader struct {
+	r *bufio.Reader
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Read returns the next record, or io.EOF when there are no more
+// a *RecordError means that record couldn't be read but the ones after it can be
+func (r *Reader) Read() (*Record, error) {
+	raw, err := r.r.ReadBytes(recordTerminator)
+	if err != nil && !(errors.Is(err, io.EOF) && len(bytes.TrimSpace(raw)) > 0) {
+		return nil, err
+	}
+
+	//files sometimes have line breaks between the records
+	raw = bytes.TrimLeft(raw, "\r\n")
+
+	record, parseErr := parseRecord(raw)
+	if parseErr != nil {
+		return nil, &RecordError{Err: parseErr}
+	}
+
+	return record, nil
+}
+
+// RecordError is returned for a record that is broken; reading can carry on with the next record
+type RecordError struct {
+	Err error
+}
+
+func (e *RecordError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RecordError) Unwrap() error {
+	return e.Err
+}
+
+// parseRecord reads one record, raw ends with the record terminator (unless it was the end of the file)
+func parseRecord(raw []byte) (*Record, error) {
+	if len(raw) < leaderLength+1 {
+		return nil, errors.New("the record is too short to be a MARC record")
+	}
+
+	leader := string(raw[:leaderLength])
+
+	baseAddress, ok := parseDigits(raw[12:17])
+	if !ok || baseAddress <= leaderLength || baseAddress > len(raw) {
+		return nil, errors.New("the record's leader has an invalid base address")
+	}
+
+	//leader/09 is 'a' for UTF-8; anything else is MARC-8, which is the same as ASCII for the plain letters but not for accents
+	if leader[9] != 'a' && !isASCII(raw) {
+		return nil, errors.New("only UTF-8 records are supported, this one is MARC-8")
+	}
+
+	directory := raw[leaderLength : baseAddress-1] //the directory ends with a field terminator just before the base address
+	if len(directory)%directoryLength != 0 {
+		return nil, errors.New("the record's directory is invalid")
+	}
+
+	data := raw[baseAddress:]
+	record := &Record{Leader: leader}
+
+	for i := 0; i < len(directory); i += directoryLength {
+		entry := directory[i : i+directoryLength]
+
+		tag := string(entry[:3])
+		length, ok1 := parseDigits(entry[3:7])
+		start, ok2 := parseDigits(entry[7:12])
+		if !ok1 || !ok2 || length < 1 || start+length > len(data) {
+			return nil, fmt.Errorf("the directory entry for field %s is invalid", tag)
+		}
+
+		field := bytes.TrimSuffix(data[start:start+length], []byte{fieldTerminator})
+
+		if isControlTag(tag) {
+			record.ControlFields = append(record.ControlFields, ControlField{Tag: tag, Value: string(field)})
+			continue
+		}
+
+		if len(field) < 2 {
+			return nil, fmt.Errorf("field %s is too short to have indicators", tag)
+		}
+
+		dataField := DataField{Tag: tag, Ind1: field[0], Ind2: field[1]}
+
+		//the first chunk is empty because the subfields start with a delimiter
+		for _, chunk := range bytes.Split(field[2:], []byte{subfieldDelimiter})[1:] {
+			if len(chunk) == 0 {
+				continue
+			}
+			dataField.Subfields = append(dataField.Subfields, Subfield{Code: chunk[0], Value: string(chunk[1:])})
+		}
+
+		record.DataFields = append(record.DataFields, dataField)
+	}
+
+	return record, nil
+}
+
+// parseDigits reads one of the fixed width numbers in the leader or the directory
+// strconv.Atoi would take a sign or spaces too, and a negative offset from a broken (or hostile) upload would then slice out of range
+func parseDigits(b []byte) (int, bool) {
+	if len(b) == 0 {
+		return 0, false
+	}
+
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, true
+}
+
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// Writer writes ISO 2709 records
+type Writer struct {
+	w io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Write writes one record; the lengths and offsets in the leader and the directory are worked out here,
+// so the ones in record.Leader don't have to be right (or there at all)
+func (w *Writer) Write(record *Record) error {
+	var directory, data bytes.Buffer
+
+	addField := func(tag string, field []byte) error {
+		if len(tag) != 3 {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+
+		field = append(field, fieldTerminator)
+		if len(field) > 9999 || data.Len() > 99999 {
+			return fmt.Errorf("field %s is too long for an ISO 2709 record", tag)
+		}
+
+		fmt.Fprintf(&directory, "%s%04d%05d", tag, len(field), data.Len())
+		data.Write(field)
+		return nil
+	}
+
+	for _, field := range record.ControlFields {
+		if err := addField(field.Tag, []byte(field.Value)); err != nil {
+			return err
+		}
+	}
+
+	for _, field := range record.DataFields {
+		raw := []byte{indicator(field.Ind1), indicator(field.Ind2)}
+		for _, subfield := range field.Subfields {
+			raw = append(raw, subfieldDelimiter, subfield.Code)
+			raw = append(raw, subfield.Value...)
+		}
+
+		if err := addField(field.Tag, raw); err != nil {
+			return err
+		}
+	}
+
+	directory.WriteByte(fieldTerminator)
+
+	baseAddress := leaderLength + directory.Len()
+	recordLength := baseAddress + data.Len() + 1
+	if recordLength > 99999 {
+		return errors.New("the record is too long for ISO 2709")
+	}
+
+	leader := []byte(normalizeLeader(record.Leader))
+	copy(leader[0:5], fmt.Sprintf("%05d", recordLength))
+	copy(leader[12:17], fmt.Sprintf("%05d", baseAddress))
+
+	var out bytes.Buffer
+	out.Write(leader)
+	out.Write(directory.Bytes())
+	out.Write(data.Bytes())
+	out.WriteByte(recordTerminator)
+
+	_, err := w.w.Write(out.Bytes())
+	return err
+}
+
+// DefaultLeader is the leader FromBook uses: a new (n) record for printed text (a) that is a monograph (m), in UTF-8 (a)
+// the zeros are the lengths, which Writer fills in
+const DefaultLeader = "00000nam a2200000 i 4500"
+
+// normalizeLeader fills in the parts of a leader that are always the same, so a record from MARCXML with a sloppy leader still writes out valid
+func normalizeLeader(leader string) string {
+	if len(leader) != leaderLength {
+		leader = DefaultLeader
+	}
+
+	b := []byte(leader)
+	b[9] = 'a'  //everything is written as UTF-8
+	b[10] = '2' //two indicators
+	b[11] = '2' //subfield codes are two bytes: the delimiter and the code
+	copy(b[20:24], "4500")
+
+	return string(b)
+}
+
+// a blank indicator is a space, a zero byte would break the record
+func indicator(b byte) byte {
+	if b == 0 {
+		return ' '
+	}
+	return b
+}
@@ -0,0 +1,141 @@
+package marc
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func testRecord() *Record {
+	return &Record{
+		Leader: DefaultLeader,
+		ControlFields: []ControlField{
+			{Tag: "001", Value: "42"},
+		},
+		DataFields: []DataField{
+			{Tag: "100", Ind1: '1', Ind2: ' ', Subfields: []Subfield{{Code: 'a', Value: "Le Guin, Ursula K."}}},
+			{Tag: "245", Ind1: '1', Ind2: '4', Subfields: []Subfield{
+				{Code: 'a', Value: "The dispossessed :"},
+				{Code: 'b', Value: "an ambiguous utopia"},
+			}},
+		},
+	}
+}
+
+func writeRecord(t *testing.T, record *Record) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Write(record); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestRoundTrip(t *testing.T) {
+	want := testRecord()
+	raw := writeRecord(t, want)
+
+	r := NewReader(bytes.NewReader(append(raw, raw...)))
+
+	for i := 0; i < 2; i++ {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("Read record %d: %v", i, err)
+		}
+
+		//the writer fills in the lengths, so only the rest of the leader is compared
+		if got.Leader[5:12] != want.Leader[5:12] || got.Leader[17:] != want.Leader[17:] {
+			t.Errorf("leader = %q, want %q apart from the lengths", got.Leader, want.Leader)
+		}
+		if !reflect.DeepEqual(got.ControlFields, want.ControlFields) {
+			t.Errorf("control fields = %+v, want %+v", got.ControlFields, want.ControlFields)
+		}
+		if !reflect.DeepEqual(got.DataFields, want.DataFields) {
+			t.Errorf("data fields = %+v, want %+v", got.DataFields, want.DataFields)
+		}
+	}
+
+	if _, err := r.Read(); err != io.EOF {
+		t.Errorf("Read after the last record = %v, want io.EOF", err)
+	}
+}
+
+func TestReadMalformed(t *testing.T) {
+	valid := writeRecord(t, testRecord())
+
+	//the first directory entry starts straight after the leader: tag (3), length (4), start (5)
+	const entry = leaderLength
+
+	corrupt := func(offset int, s string) []byte {
+		raw := bytes.Clone(valid)
+		copy(raw[offset:], s)
+		return raw
+	}
+
+	//leader/09 blank says MARC-8, which is only read when it is plain ASCII
+	marc8 := bytes.Replace(corrupt(9, " "), []byte("Le Guin"), []byte("Lé Guin"), 1)
+
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"too short", []byte("00000nam\x1d")},
+		{"signed base address", corrupt(12, "-0001")},
+		{"base address with spaces", corrupt(12, "  037")},
+		{"base address inside the leader", corrupt(12, "00010")},
+		{"base address past the end", corrupt(12, "99999")},
+		{"negative start", corrupt(entry+7, "-0001")},
+		{"signed start", corrupt(entry+7, "+0000")},
+		{"negative length", corrupt(entry+3, "-001")},
+		{"zero length", corrupt(entry+3, "0000")},
+		{"length past the end", corrupt(entry+3, "9999")},
+		{"start past the end", corrupt(entry+7, "99999")},
+		{"directory not a whole number of entries", corrupt(12, "00036")},
+		{"MARC-8 with accents", marc8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//a good record after the broken one should still be read
+			r := NewReader(bytes.NewReader(append(bytes.Clone(tt.raw), valid...)))
+
+			_, err := r.Read()
+
+			var recordErr *RecordError
+			if !errors.As(err, &recordErr) {
+				t.Fatalf("Read = %v, want a *RecordError", err)
+			}
+
+			if _, err := r.Read(); err != nil {
+				t.Errorf("Read of the record after it = %v, want it to be read", err)
+			}
+		})
+	}
+}
+
+func TestParseDigits(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"00000", 0, true},
+		{"01234", 1234, true},
+		{"99999", 99999, true},
+		{"-0001", 0, false},
+		{"+0001", 0, false},
+		{" 0001", 0, false},
+		{"0001a", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseDigits([]byte(tt.in))
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("parseDigits(%q) = %d, %t, want %d, %t", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
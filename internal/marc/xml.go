@@ -0,0 +1,188 @@
+package marc
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Namespace is the MARCXML namespace, see https://www.loc.gov/standards/marcxml/
+const Namespace = "http://www.loc.gov/MARC21/slim"
+
+// xmlRecord is how a record looks in MARCXML
+type xmlRecord struct {
+	XMLName       xml.Name          `xml:"record"`
+	Leader        string            `xml:"leader"`
+	ControlFields []xmlControlField `xml:"controlfield"`
+	DataFields    []xmlDataField    `xml:"datafield"`
+}
+
+type xmlControlField struct {
+	Tag   string `xml:"tag,attr"`
+	Value string `xml:",chardata"`
+}
+
+type xmlDataField struct {
+	Tag       string        `xml:"tag,attr"`
+	Ind1      string        `xml:"ind1,attr"`
+	Ind2      string        `xml:"ind2,attr"`
+	Subfields []xmlSubfield `xml:"subfield"`
+}
+
+type xmlSubfield struct {
+	Code  string `xml:"code,attr"`
+	Value string `xml:",chardata"`
+}
+
+// XMLReader reads the records of a MARCXML document one at a time
+// the document can be a <collection> of records or a single <record>
+type XMLReader struct {
+	dec *xml.Decoder
+}
+
+func NewXMLReader(r io.Reader) *XMLReader {
+	return &XMLReader{dec: xml.NewDecoder(r)}
+}
+
+// Read returns the next record, or io.EOF when there are no more
+// like Reader.Read, a *RecordError is for a record that can't be used and reading can carry on
+func (r *XMLReader) Read() (*Record, error) {
+	for {
+		token, err := r.dec.Token()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("the file is not valid XML: %w", err)
+		}
+
+		//records are matched by name only, some systems leave the namespace out
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "record" {
+			continue
+		}
+
+		var raw xmlRecord
+		if err := r.dec.DecodeElement(&raw, &start); err != nil {
+			return nil, fmt.Errorf("the file is not valid XML: %w", err)
+		}
+
+		record, err := raw.record()
+		if err != nil {
+			return nil, &RecordError{Err: err}
+		}
+
+		return record, nil
+	}
+}
+
+func (raw xmlRecord) record() (*Record, error) {
+	record := &Record{Leader: raw.Leader}
+
+	for _, field := range raw.ControlFields {
+		record.ControlFields = append(record.ControlFields, ControlField{Tag: field.Tag, Value: field.Value})
+	}
+
+	for _, field := range raw.DataFields {
+		if len(field.Tag) != 3 {
+			return nil, fmt.Errorf("datafield tag %q is not three characters long", field.Tag)
+		}
+
+		dataField := DataField{Tag: field.Tag, Ind1: xmlIndicator(field.Ind1), Ind2: xmlIndicator(field.Ind2)}
+
+		for _, subfield := range field.Subfields {
+			if len(subfield.Code) != 1 {
+				return nil, fmt.Errorf("field %s has a subfield code %q that is not one character long", field.Tag, subfield.Code)
+			}
+			dataField.Subfields = append(dataField.Subfields, Subfield{Code: subfield.Code[0], Value: subfield.Value})
+		}
+
+		record.DataFields = append(record.DataFields, dataField)
+	}
+
+	return record, nil
+}
+
+func xmlIndicator(s string) byte {
+	if s == "" {
+		return ' '
+	}
+	return s[0]
+}
+
+// XMLWriter writes records into a <collection> element
+// nothing is written until the first record (or Close), and Close has to be called to finish the document
+type XMLWriter struct {
+	w       io.Writer
+	enc     *xml.Encoder
+	started bool
+}
+
+func NewXMLWriter(w io.Writer) *XMLWriter {
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	return &XMLWriter{w: w, enc: enc}
+}
+
+var collection = xml.StartElement{Name: xml.Name{Local: "collection"}, Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns"}, Value: Namespace}}}
+
+func (w *XMLWriter) start() error {
+	w.started = true
+
+	if _, err := io.WriteString(w.w, xml.Header); err != nil {
+		return err
+	}
+
+	return w.enc.EncodeToken(collection)
+}
+
+// Write writes one record and flushes it, so a long export goes out a record at a time
+func (w *XMLWriter) Write(record *Record) error {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+
+	raw := xmlRecord{Leader: normalizeLeader(record.Leader)}
+
+	for _, field := range record.ControlFields {
+		raw.ControlFields = append(raw.ControlFields, xmlControlField{Tag: field.Tag, Value: field.Value})
+	}
+
+	for _, field := range record.DataFields {
+		dataField := xmlDataField{Tag: field.Tag, Ind1: string(indicator(field.Ind1)), Ind2: string(indicator(field.Ind2))}
+		for _, subfield := range field.Subfields {
+			dataField.Subfields = append(dataField.Subfields, xmlSubfield{Code: string(subfield.Code), Value: subfield.Value})
+		}
+		raw.DataFields = append(raw.DataFields, dataField)
+	}
+
+	//the namespace is already on <collection>, so it is left off each record
+	if err := w.enc.EncodeElement(raw, xml.StartElement{Name: xml.Name{Local: "record"}}); err != nil {
+		return err
+	}
+
+	return w.enc.Flush()
+}
+
+// Close ends the <collection>; with no records written it is an empty collection
+func (w *XMLWriter) Close() error {
+	if !w.started {
+		if err := w.start(); err != nil {
+			return err
+		}
+	}
+
+	if err := w.enc.EncodeToken(collection.End()); err != nil {
+		return err
+	}
+	if err := w.enc.Flush(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w.w, "\n")
+	return err
+}
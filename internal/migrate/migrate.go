@@ -0,0 +1,370 @@
+// Package migrate applies the numbered SQL files in the migrations package to a database
+// the versions that have been applied are recorded in a schema_migrations table,
+// so running it again only applies what is new
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"readinglist/migrations"
+)
+
+// lockKey is the number used for the postgres advisory lock
+// any two programs that take a lock with the same number wait for each other, so it just has to be the same everywhere
+const lockKey = 7_365_117_802
+
+// ErrUnknownVersion is returned by To when there is no migration with the version asked for
+var ErrUnknownVersion = errors.New("unknown migration version")
+
+// Migration is one numbered change to the schema
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// Status is a migration along with when it was applied, which is nil if it hasn't been
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+// Migrator runs the migrations for one database
+// Dialect is either "postgres" or "sqlite" and picks the folder the SQL files come from
+type Migrator struct {
+	DB         *sql.DB
+	Dialect    string
+	Logger     *log.Logger
+	migrations []Migration
+}
+
+// New loads the migrations for the dialect from the files built into the program
+func New(db *sql.DB, dialect string, logger *log.Logger) (*Migrator, error) {
+	files, err := fs.Sub(migrations.FS, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	ms, err := load(files)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ms) == 0 {
+		return nil, fmt.Errorf("no migrations found for %s", dialect)
+	}
+
+	return &Migrator{DB: db, Dialect: dialect, Logger: logger, migrations: ms}, nil
+}
+
+// fileRX matches names like 000002_add_books_search.up.sql
+var fileRX = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// load reads the SQL files and pairs up the up and down file for each version
+// every version needs both, otherwise there would be no way to undo it
+func load(files fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(files, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+
+	for _, name := range names {
+		match := fileRX.FindStringSubmatch(path.Base(name))
+		if match == nil {
+			return nil, fmt.Errorf("badly named migration file %q", name)
+		}
+
+		version, _ := strconv.Atoi(match[1])
+
+		contents, err := fs.ReadFile(files, name)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two different names: %s and %s", version, m.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			m.up = string(contents)
+		} else {
+			m.down = string(contents)
+		}
+	}
+
+	ms := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		ms = append(ms, *m)
+	}
+
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+
+	return ms, nil
+}
+
+// Latest returns the version of the newest migration
+func (m *Migrator) Latest() int {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every migration that hasn't been applied yet
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.To(ctx, m.Latest())
+}
+
+// Down undoes the most recently applied migration
+func (m *Migrator) Down(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		//the target is the version before the current one, or 0 (an empty database) if it is the first
+		target := 0
+		for _, migration := range m.migrations {
+			if migration.Version < current {
+				target = migration.Version
+			}
+		}
+
+		return m.migrate(ctx, conn, current, target)
+	})
+}
+
+// To moves the schema up or down to the version; 0 undoes every migration
+func (m *Migrator) To(ctx context.Context, version int) error {
+	if version != 0 && m.find(version) == nil {
+		return fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+
+	return m.withLock(ctx, func(conn *sql.Conn) error {
+		current, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		return m.migrate(ctx, conn, current, version)
+	})
+}
+
+// Version returns the version of the newest migration that has been applied, or 0 if none have
+// it doesn't create the schema_migrations table, so it is safe to call from the healthcheck
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	exists, err := m.tableExists(ctx)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int
+	err = m.DB.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+
+	return version, err
+}
+
+// Status lists every migration and when it was applied
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	applied := map[int]time.Time{}
+
+	exists, err := m.tableExists(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if exists {
+		rows, err := m.DB.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations`)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var version int
+			var appliedAt time.Time
+
+			if err := rows.Scan(&version, &appliedAt); err != nil {
+				return nil, err
+			}
+			applied[version] = appliedAt
+		}
+
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]Status, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = Status{Version: migration.Version, Name: migration.Name}
+		if appliedAt, ok := applied[migration.Version]; ok {
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+
+	return statuses, nil
+}
+
+// migrate applies the up migrations from current to target, or the down migrations if target is lower
+// each migration runs in its own transaction together with the change to schema_migrations,
+// so a migration that fails part way through leaves the database as it was before that migration
+func (m *Migrator) migrate(ctx context.Context, conn *sql.Conn, current, target int) error {
+	if target >= current {
+		for _, migration := range m.migrations {
+			if migration.Version <= current || migration.Version > target {
+				continue
+			}
+
+			m.logf("applying migration %d_%s", migration.Version, migration.Name)
+
+			err := m.inTx(ctx, conn, migration.up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	}
+
+	for i := len(m.migrations) - 1; i >= 0; i-- {
+		migration := m.migrations[i]
+		if migration.Version > current || migration.Version <= target {
+			continue
+		}
+
+		m.logf("rolling back migration %d_%s", migration.Version, migration.Name)
+
+		err := m.inTx(ctx, conn, migration.down,
+			`DELETE FROM schema_migrations WHERE version = $1`, migration.Version)
+		if err != nil {
+			return fmt.Errorf("rolling back migration %d_%s: %w", migration.Version, migration.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// inTx runs the migration SQL and the bookkeeping statement in one transaction
+func (m *Migrator) inTx(ctx context.Context, conn *sql.Conn, migrationSQL, bookkeeping string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //this does nothing once the transaction has been committed
+
+	if _, err := tx.ExecContext(ctx, migrationSQL); err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// withLock runs fn while holding the migration lock, so two instances of the api starting at once can't both migrate
+// postgres advisory locks belong to a connection, so everything runs on one connection taken from the pool
+// SQLite only ever lets one connection write at a time, so it doesn't need a lock of its own
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.Dialect == "postgres" {
+		if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, lockKey); err != nil {
+			return err
+		}
+
+		//a fresh context is used to unlock so the lock is still released if ctx has been cancelled
+		defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, lockKey)
+	}
+
+	if err := m.createTable(ctx, conn); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) createTable(ctx context.Context, conn *sql.Conn) error {
+	query := `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamp(0) with time zone NOT NULL DEFAULT NOW()
+	)`
+
+	if m.Dialect == "sqlite" {
+		query = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`
+	}
+
+	_, err := conn.ExecContext(ctx, query)
+	return err
+}
+
+func (m *Migrator) tableExists(ctx context.Context) (bool, error) {
+	query := `SELECT to_regclass('schema_migrations') IS NOT NULL`
+
+	if m.Dialect == "sqlite" {
+		query = `SELECT count(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`
+	}
+
+	var exists bool
+	err := m.DB.QueryRowContext(ctx, query).Scan(&exists)
+
+	return exists, err
+}
+
+func (m *Migrator) currentVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+
+	return version, err
+}
+
+func (m *Migrator) find(version int) *Migration {
+	for i := range m.migrations {
+		if m.migrations[i].Version == version {
+			return &m.migrations[i]
+		}
+	}
+
+	return nil
+}
+
+func (m *Migrator) logf(format string, args ...any) {
+	if m.Logger != nil {
+		m.Logger.Printf(format, args...)
+	}
+}
@@ -0,0 +1,165 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"log"
+	"path/filepath"
+	"slices"
+	"testing"
+	"testing/fstest"
+
+	_ "modernc.org/sqlite"
+)
+
+// newSQLiteMigrator gives every test its own empty SQLite file
+func newSQLiteMigrator(t *testing.T) *Migrator {
+	t.Helper()
+
+	db, err := sql.Open("sqlite", "file:"+filepath.Join(t.TempDir(), "test.db")+"?_pragma=foreign_keys(1)&_time_format=sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := New(db, "sqlite", log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// tableExists reports whether SQLite has a table with the name
+func tableExists(t *testing.T, db *sql.DB, name string) bool {
+	t.Helper()
+
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = $1`, name).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+func TestUpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	m := newSQLiteMigrator(t)
+
+	//a brand new database has nothing applied, and asking doesn't create the schema_migrations table
+	if version, err := m.Version(ctx); err != nil || version != 0 {
+		t.Fatalf("Version = %d, %v before any migrations, want 0", version, err)
+	}
+	if tableExists(t, m.DB, "schema_migrations") {
+		t.Error("Version created the schema_migrations table")
+	}
+
+	steps := []struct {
+		name    string
+		run     func() error
+		version int
+		tables  map[string]bool
+	}{
+		{"up", func() error { return m.Up(ctx) }, m.Latest(), map[string]bool{"books": true, "book_revisions": true, "reading_sessions": true}},
+		{"up again does nothing", func() error { return m.Up(ctx) }, m.Latest(), map[string]bool{"books": true, "reading_sessions": true}},
+		{"down", func() error { return m.Down(ctx) }, m.Latest() - 1, map[string]bool{"books": true, "reading_sessions": false}},
+		{"to 3", func() error { return m.To(ctx, 3) }, 3, map[string]bool{"books": true, "book_revisions": false, "users": false}},
+		{"to 0", func() error { return m.To(ctx, 0) }, 0, map[string]bool{"books": false}},
+		{"down with nothing applied", func() error { return m.Down(ctx) }, 0, map[string]bool{"books": false}},
+		{"up from nothing", func() error { return m.Up(ctx) }, m.Latest(), map[string]bool{"books": true, "reading_sessions": true}},
+	}
+
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+
+		version, err := m.Version(ctx)
+		if err != nil || version != step.version {
+			t.Fatalf("%s: Version = %d, %v, want %d", step.name, version, err, step.version)
+		}
+
+		for table, want := range step.tables {
+			if got := tableExists(t, m.DB, table); got != want {
+				t.Errorf("%s: table %s exists = %t, want %t", step.name, table, got, want)
+			}
+		}
+
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			t.Fatalf("%s: Status: %v", step.name, err)
+		}
+		if len(statuses) != len(m.migrations) {
+			t.Fatalf("%s: Status has %d migrations, want %d", step.name, len(statuses), len(m.migrations))
+		}
+		for _, status := range statuses {
+			if applied := status.AppliedAt != nil; applied != (status.Version <= step.version) {
+				t.Errorf("%s: migration %d_%s applied = %t", step.name, status.Version, status.Name, applied)
+			}
+		}
+	}
+
+	if err := m.To(ctx, 999); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("To(999) = %v, want %v", err, ErrUnknownVersion)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+		want  []int //the versions in order, nil when load should fail
+	}{
+		{
+			name: "sorted by version",
+			files: fstest.MapFS{
+				"000010_later.up.sql":   file("SELECT 10"),
+				"000010_later.down.sql": file("SELECT -10"),
+				"000002_first.up.sql":   file("SELECT 2"),
+				"000002_first.down.sql": file("SELECT -2"),
+			},
+			want: []int{2, 10},
+		},
+		{
+			name:  "no down file",
+			files: fstest.MapFS{"000001_first.up.sql": file("SELECT 1")},
+		},
+		{
+			name: "two names for one version",
+			files: fstest.MapFS{
+				"000001_first.up.sql":   file("SELECT 1"),
+				"000001_other.down.sql": file("SELECT -1"),
+			},
+		},
+		{
+			name:  "badly named",
+			files: fstest.MapFS{"first.up.sql": file("SELECT 1")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ms, err := load(tt.files)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("load returned no error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []int
+			for _, m := range ms {
+				got = append(got, m.Version)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("versions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -17,6 +17,7 @@ type Book struct { //type for each book in the envelopes
 	Genres    []string `json:"genres"`
 	Rating    float32  `json:"rating"`
 	ISBN      string   `json:"isbn"`
+	ETag      string   `json:"-"` //this comes from the ETag header, not the json; sending it back in If-Match stops us overwriting someone else's edit
 }
 
 type BookResponse struct { //type for enveloped single-book json responses
@@ -24,17 +25,49 @@ type BookResponse struct { //type for enveloped single-book json responses
 }
 
 type BooksResponse struct { //type for enveloped multi-book json responses
-	Books *[]Book `json:"books"` //pointer to a slice of books
+	Books    *[]Book  `json:"books"`    //pointer to a slice of books
+	Metadata Metadata `json:"metadata"` //which page this is and how many there are
+}
+
+type Metadata struct { //the paging information the web service sends with a list of books
+	CurrentPage int `json:"current_page"`
+	LastPage    int `json:"last_page"`
 }
 
 type ReadinglistModel struct { //this type is what all of the methods "hang on to"
 	Endpoint string //this is the url to the web service
+	Token    string //the web service only lets signed-in users add books, this is sent as "Authorization: Bearer <token>"
 }
 
 // the method below returns all of the book records in the database for the homepage
 // it doesn't take any values but it returns a slice of books and an error
+// the web service sends the books a page at a time, so this keeps asking for the next page until it has had the last one
 func (m *ReadinglistModel) GetAll() (*[]Book, error) { //it is a method that hangs off of the dereferenced pointer to ReadinglistModel
-	resp, err := http.Get(m.Endpoint) //this is what passes the url into the web service
+	books := []Book{}
+
+	for page := 1; ; page++ {
+		booksResp, err := m.getPage(page)
+		if err != nil {
+			return nil, err
+		}
+
+		if booksResp.Books != nil {
+			books = append(books, *booksResp.Books...)
+		}
+
+		//an empty library has no metadata at all, so a last page of 0 means this was the only page
+		if page >= booksResp.Metadata.LastPage {
+			break
+		}
+	}
+
+	return &books, nil
+}
+
+// getPage fetches one page of books, 100 at a time because that is the biggest page the web service allows
+func (m *ReadinglistModel) getPage(page int) (*BooksResponse, error) {
+	url := fmt.Sprintf("%s?page=%d&page_size=100", m.Endpoint, page)
+	resp, err := http.Get(url) //this is what passes the url into the web service
 	if err != nil {
 		return nil, err
 	}
@@ -56,7 +89,7 @@ func (m *ReadinglistModel) GetAll() (*[]Book, error) { //it is a method that han
 		return nil, err
 	}
 
-	return booksResp.Books, nil //this returns the specific books data inside the envelope (does not return the envelope)
+	return &booksResp, nil
 }
 
 // this method takes in an id and returns a pointer to a book and an error - it returns a specific book by id
@@ -85,5 +118,9 @@ func (m *ReadinglistModel) Get(id int64) (*Book, error) {
 		return nil, err
 	}
 
+	if bookResp.Book != nil {
+		bookResp.Book.ETag = resp.Header.Get("ETag")
+	}
+
 	return bookResp.Book, nil //this returns the singular book without the envelope
 }
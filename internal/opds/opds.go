@@ -0,0 +1,205 @@
+// Package opds builds the Atom feeds of an OPDS 1.2 catalog (https://specs.opds.io/opds-1.2), which is how e-reader apps like KOReader browse a library
+// there are two kinds of feed: navigation feeds, whose entries link to other feeds, and acquisition feeds, whose entries are books
+package opds
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"readinglist/internal/data"
+	"readinglist/internal/isbn"
+)
+
+// the content types the catalog is served with, e-readers use the kind to decide how to show a feed
+const (
+	NavigationType  = "application/atom+xml;profile=opds-catalog;kind=navigation"
+	AcquisitionType = "application/atom+xml;profile=opds-catalog;kind=acquisition"
+	OpenSearchType  = "application/opensearchdescription+xml"
+)
+
+// the link relations OPDS adds to the Atom ones
+const (
+	RelSortNew    = "http://opds-spec.org/sort/new"
+	RelSubsection = "subsection"
+)
+
+// Feed is an Atom feed; the namespaces are always declared so the dc:, opensearch: and thr: names can be used in any feed
+type Feed struct {
+	XMLName         xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+	XMLNSDC         string   `xml:"xmlns:dc,attr"`
+	XMLNSOpenSearch string   `xml:"xmlns:opensearch,attr"`
+	XMLNSThread     string   `xml:"xmlns:thr,attr"`
+
+	ID      string    `xml:"id"`
+	Title   string    `xml:"title"`
+	Updated time.Time `xml:"updated"`
+	Author  *Author   `xml:"author,omitempty"`
+	Links   []Link    `xml:"link"`
+
+	//these tell the e-reader how many books there are in total when a feed is split into pages
+	TotalResults int `xml:"opensearch:totalResults,omitempty"`
+	ItemsPerPage int `xml:"opensearch:itemsPerPage,omitempty"`
+
+	Entries []Entry `xml:"entry"`
+}
+
+// NewFeed returns a feed with nothing in it yet
+func NewFeed(id, title string, updated time.Time) *Feed {
+	return &Feed{
+		XMLNSDC:         "http://purl.org/dc/terms/",
+		XMLNSOpenSearch: "http://a9.com/-/spec/opensearch/1.1/",
+		XMLNSThread:     "http://purl.org/syndication/thread/1.0",
+		ID:              id,
+		Title:           title,
+		Updated:         updated.UTC().Truncate(time.Second),
+		Author:          &Author{Name: "readinglist"},
+	}
+}
+
+// Entry is one entry of a feed, either a book or a link to another feed
+type Entry struct {
+	ID         string     `xml:"id"`
+	Title      string     `xml:"title"`
+	Updated    time.Time  `xml:"updated"`
+	Authors    []Author   `xml:"author"`
+	Issued     string     `xml:"dc:issued,omitempty"`
+	Identifier string     `xml:"dc:identifier,omitempty"`
+	Categories []Category `xml:"category"`
+	Content    *Content   `xml:"content,omitempty"`
+	Links      []Link     `xml:"link"`
+}
+
+type Author struct {
+	Name string `xml:"name"`
+}
+
+type Category struct {
+	Term  string `xml:"term,attr"`
+	Label string `xml:"label,attr,omitempty"`
+}
+
+type Content struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Link is an Atom link; Count is the thr:count OPDS uses to say how many books are behind a navigation link
+type Link struct {
+	Rel   string `xml:"rel,attr,omitempty"`
+	Href  string `xml:"href,attr"`
+	Type  string `xml:"type,attr,omitempty"`
+	Title string `xml:"title,attr,omitempty"`
+	Count int    `xml:"thr:count,attr,omitempty"`
+}
+
+// NavigationEntry is an entry that leads to another feed, like "All books" or one of the genres
+func NavigationEntry(id, title, description, href, feedType string, updated time.Time) Entry {
+	return Entry{
+		ID:      id,
+		Title:   title,
+		Updated: updated.UTC().Truncate(time.Second),
+		Content: &Content{Type: "text", Body: description},
+		Links:   []Link{{Rel: RelSubsection, Href: href, Type: feedType}},
+	}
+}
+
+// BookID is the Atom id of a book's entry, it has to stay the same for as long as the book exists
+func BookID(id int64) string {
+	return fmt.Sprintf("urn:readinglist:book:%d", id)
+}
+
+// BookEntry turns a book into an acquisition feed entry
+// there are no ebook files to download, so instead of acquisition links the entry links to the book in the api and to its citation
+func BookEntry(book *data.Book) Entry {
+	entry := Entry{
+		ID:      BookID(book.ID),
+		Title:   book.Title,
+		Updated: book.CreatedAt.UTC(), //books don't keep when they were last changed, so the entry is as old as the book
+		Content: &Content{Type: "text", Body: bookSummary(book)},
+		Links: []Link{
+			{Rel: "alternate", Href: fmt.Sprintf("/v1/books/%d", book.ID), Type: "application/json"},
+			{Rel: "related", Href: fmt.Sprintf("/v1/books/%d/citation", book.ID), Type: "application/x-bibtex", Title: "BibTeX citation"},
+		},
+	}
+
+	if book.Author != "" {
+		entry.Authors = []Author{{Name: book.Author}}
+	}
+	if book.Published > 0 {
+		entry.Issued = strconv.Itoa(book.Published)
+	}
+	if book.ISBN != "" {
+		entry.Identifier = "urn:isbn:" + isbn.Normalize(book.ISBN)
+	}
+
+	for _, genre := range book.Genres {
+		entry.Categories = append(entry.Categories, Category{Term: genre, Label: genre})
+	}
+
+	return entry
+}
+
+// bookSummary is the short description the e-reader shows under the title, e.g. "1965 · 412 pages · rated 4.5/5"
+func bookSummary(book *data.Book) string {
+	var parts []string
+
+	if book.Published > 0 {
+		parts = append(parts, strconv.Itoa(book.Published))
+	}
+	if book.Pages > 0 {
+		parts = append(parts, fmt.Sprintf("%d pages", book.Pages))
+	}
+	if book.Rating > 0 {
+		parts = append(parts, fmt.Sprintf("rated %s/5", strconv.FormatFloat(float64(book.Rating), 'f', -1, 32)))
+	}
+
+	return strings.Join(parts, " · ")
+}
+
+// OpenSearchDescription tells the e-reader how to search the catalog
+// template is the search url with {searchTerms} where the search goes, it has to be absolute
+type OpenSearchDescription struct {
+	XMLName        xml.Name      `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName      string        `xml:"ShortName"`
+	Description    string        `xml:"Description"`
+	InputEncoding  string        `xml:"InputEncoding"`
+	OutputEncoding string        `xml:"OutputEncoding"`
+	URL            OpenSearchURL `xml:"Url"`
+}
+
+type OpenSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// NewOpenSearchDescription returns the description of a search whose results are an acquisition feed
+func NewOpenSearchDescription(template string) *OpenSearchDescription {
+	return &OpenSearchDescription{
+		ShortName:      "readinglist",
+		Description:    "Search the reading list by title or author",
+		InputEncoding:  "UTF-8",
+		OutputEncoding: "UTF-8",
+		URL:            OpenSearchURL{Type: AcquisitionType, Template: template},
+	}
+}
+
+// Write writes v (a *Feed or an *OpenSearchDescription) as an xml document
+func Write(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,64 @@
+package validator
+
+// this package collects validation errors so they can all be sent back to the client at once
+// instead of stopping at the first thing that is wrong
+// Credit: Alex Edwards, Let's Go Further
+
+import "regexp"
+
+// Validator holds a map of field names to the error message for that field
+type Validator struct {
+	Errors map[string]string
+}
+
+// New returns a Validator with an empty errors map ready to use
+func New() *Validator {
+	return &Validator{Errors: make(map[string]string)}
+}
+
+// Valid returns true when no errors have been added
+func (v *Validator) Valid() bool {
+	return len(v.Errors) == 0
+}
+
+// AddError adds an error message for the field
+// only the first message for each field is kept, so the most basic problem is the one that gets reported
+func (v *Validator) AddError(key, message string) {
+	if _, exists := v.Errors[key]; !exists {
+		v.Errors[key] = message
+	}
+}
+
+// Check adds the error message for the field if ok is false
+func (v *Validator) Check(ok bool, key, message string) {
+	if !ok {
+		v.AddError(key, message)
+	}
+}
+
+// PermittedValue returns true if the value is one of the permitted values
+func PermittedValue[T comparable](value T, permittedValues ...T) bool {
+	for i := range permittedValues {
+		if value == permittedValues[i] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Matches returns true if the string matches the regular expression
+func Matches(value string, rx *regexp.Regexp) bool {
+	return rx.MatchString(value)
+}
+
+// Unique returns true if every value in the slice is different
+func Unique[T comparable](values []T) bool {
+	uniqueValues := make(map[T]bool)
+
+	for _, value := range values {
+		uniqueValues[value] = true
+	}
+
+	return len(values) == len(uniqueValues)
+}
@@ -0,0 +1,14 @@
+// Package migrations holds the numbered SQL files that build up the database schema
+// there is one folder per database because postgres and SQLite don't speak exactly the same SQL
+// every change has a file with the same number in both folders so the schema version means the same thing whichever database is used
+//
+// the files are named NNNNNN_description.up.sql and NNNNNN_description.down.sql
+// up makes the change and down undoes it; they are run by the internal/migrate package
+package migrations
+
+import "embed"
+
+// FS has the SQL files built into the program so they don't need to be shipped next to it
+//
+//go:embed postgres/*.sql sqlite/*.sql
+var FS embed.FS
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS books (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    title text NOT NULL,
+    author text,
+    published integer NOT NULL,
+    pages integer NOT NULL,
+    genres text[] NOT NULL,
+    rating real NOT NULL,
+    isbn text,
+    version integer NOT NULL DEFAULT 1
+);
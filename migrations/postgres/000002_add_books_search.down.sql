@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS books_search_vector_idx;
+
+ALTER TABLE books DROP COLUMN IF EXISTS search_vector;
+
+DROP FUNCTION IF EXISTS books_genres_text(text[]);
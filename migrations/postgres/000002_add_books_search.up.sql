@@ -0,0 +1,15 @@
+/*array_to_string is only STABLE, so it is wrapped in an IMMUTABLE function to use it in a generated column*/
+CREATE OR REPLACE FUNCTION books_genres_text(genres text[]) RETURNS text AS $$
+    SELECT array_to_string(genres, ' ')
+$$ LANGUAGE sql IMMUTABLE;
+
+/*the weights rank a match in the title above the author, genres and isbn*/
+/*the isbn is indexed without hyphens so 0-441-17271-7 and 0441172717 both match*/
+ALTER TABLE books ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', coalesce(title, '')), 'A') ||
+    setweight(to_tsvector('simple', coalesce(author, '')), 'B') ||
+    setweight(to_tsvector('simple', books_genres_text(genres)), 'C') ||
+    setweight(to_tsvector('simple', regexp_replace(coalesce(isbn, ''), '[^0-9Xx]', '', 'g')), 'D')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS books_search_vector_idx ON books USING GIN (search_vector);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS books_deleted_at_idx;
+
+ALTER TABLE books DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,5 @@
+/*a book with a deleted_at is in the trash; it is hidden from the api until it is restored or purged*/
+ALTER TABLE books ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+/*only the trashed rows are indexed, which is what the trash listing and the purger look for*/
+CREATE INDEX IF NOT EXISTS books_deleted_at_idx ON books (deleted_at) WHERE deleted_at IS NOT NULL;
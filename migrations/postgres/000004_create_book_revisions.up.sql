@@ -0,0 +1,21 @@
+/*every insert, update, delete and restore of a book adds a row here with a copy of the book as it was afterwards*/
+/*the history goes when the book itself is deleted permanently*/
+CREATE TABLE IF NOT EXISTS book_revisions (
+    id bigserial PRIMARY KEY,
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    version integer NOT NULL,
+    operation text NOT NULL,
+    actor text NOT NULL DEFAULT '',
+    snapshot jsonb NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    UNIQUE (book_id, version)
+);
+
+/*the books that already exist start their history with a snapshot of how they are now*/
+INSERT INTO book_revisions (book_id, version, operation, snapshot)
+SELECT id, version, 'snapshot', jsonb_build_object(
+    'id', id, 'title', title, 'author', author, 'published', published, 'pages', pages,
+    'genres', to_jsonb(genres), 'rating', rating, 'isbn', isbn, 'deleted_at', deleted_at
+)
+FROM books
+ON CONFLICT DO NOTHING;
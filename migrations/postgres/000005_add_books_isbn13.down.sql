@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS books_isbn13_idx;
+
+ALTER TABLE books DROP COLUMN IF EXISTS isbn13;
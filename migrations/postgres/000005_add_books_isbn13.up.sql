@@ -0,0 +1,31 @@
+/*isbn is kept the way it was typed in; isbn13 is the same ISBN as thirteen digits with no hyphens, which is what lookups and the unique index use*/
+/*it is NULL for books without an ISBN, and the api works it out with the isbn package whenever a book is saved*/
+ALTER TABLE books ADD COLUMN IF NOT EXISTS isbn13 text;
+
+/*the existing books are filled in here; an ISBN-10 gets 978 in front and its check digit worked out again,*/
+/*(10 - the sum of the digits weighted 1, 3, 1, 3...) mod 10, where 38 is what 9, 7 and 8 add up to*/
+WITH normalized AS (
+    SELECT id, upper(replace(replace(isbn, '-', ''), ' ', '')) AS n
+    FROM books
+)
+UPDATE books
+SET isbn13 = CASE
+    WHEN n ~ '^97[89][0-9]{10}$' THEN n
+    WHEN n ~ '^[0-9]{9}[0-9X]$' THEN '978' || left(n, 9) || ((10 - (38
+        + 3 * substr(n, 1, 1)::int + substr(n, 2, 1)::int + 3 * substr(n, 3, 1)::int
+        + substr(n, 4, 1)::int + 3 * substr(n, 5, 1)::int + substr(n, 6, 1)::int
+        + 3 * substr(n, 7, 1)::int + substr(n, 8, 1)::int + 3 * substr(n, 9, 1)::int) % 10) % 10)::text
+    END
+FROM normalized
+WHERE books.id = normalized.id;
+
+/*if the same book was added twice, only the oldest one keeps its isbn13 so the index can be built; the isbn itself is left alone*/
+UPDATE books
+SET isbn13 = NULL
+WHERE isbn13 IS NOT NULL AND deleted_at IS NULL AND EXISTS (
+    SELECT 1 FROM books older
+    WHERE older.isbn13 = books.isbn13 AND older.deleted_at IS NULL AND older.id < books.id
+);
+
+/*two books in the library can't have the same ISBN, books in the trash don't count until they are restored*/
+CREATE UNIQUE INDEX IF NOT EXISTS books_isbn13_idx ON books (isbn13) WHERE deleted_at IS NULL;
@@ -0,0 +1,14 @@
+/*people who can sign in to the api; password_hash is a bcrypt hash, the password itself is never stored*/
+/*a user can't do anything until activated is set, which happens when they use the token that was emailed to them*/
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    name text NOT NULL,
+    email text NOT NULL,
+    password_hash bytea NOT NULL,
+    activated boolean NOT NULL DEFAULT false,
+    version integer NOT NULL DEFAULT 1
+);
+
+/*email addresses are compared without case, so Alice@example.com can't register a second time as alice@example.com*/
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (lower(email));
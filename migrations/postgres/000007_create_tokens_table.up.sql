@@ -0,0 +1,8 @@
+/*short lived tokens that are sent to a user, e.g. the one that activates a new account*/
+/*only a SHA-256 hash of the token is kept, so someone who can read the table still can't use the tokens in it*/
+CREATE TABLE IF NOT EXISTS tokens (
+    hash bytea PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    expiry timestamp(0) with time zone NOT NULL,
+    scope text NOT NULL
+);
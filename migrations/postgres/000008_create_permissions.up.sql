@@ -0,0 +1,20 @@
+/*what a user is allowed to do; books:read and books:write cover the books and the imports, admin can grant and revoke permissions*/
+CREATE TABLE IF NOT EXISTS permissions (
+    id bigserial PRIMARY KEY,
+    code text NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+INSERT INTO permissions (code)
+VALUES ('books:read'), ('books:write'), ('admin');
+
+/*until now every activated user could change the books, so the users that already exist keep being able to*/
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id
+FROM users CROSS JOIN permissions
+WHERE permissions.code IN ('books:read', 'books:write');
@@ -0,0 +1,17 @@
+/*each user's own shelves: where they are with a book, when they started and finished it, and their own rating (0 is not rated)*/
+/*the books table is the shared catalogue, so none of this can go on it*/
+CREATE TABLE IF NOT EXISTS user_books (
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    status text NOT NULL CHECK (status IN ('want-to-read', 'reading', 'read', 'did-not-finish')),
+    started_at timestamp(0) with time zone,
+    finished_at timestamp(0) with time zone,
+    rating real NOT NULL DEFAULT 0,
+    dnf_reason text NOT NULL DEFAULT '',
+    updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    version integer NOT NULL DEFAULT 1,
+    PRIMARY KEY (user_id, book_id)
+);
+
+/*a shelf is one user's books with one status*/
+CREATE INDEX IF NOT EXISTS user_books_shelf_idx ON user_books (user_id, status);
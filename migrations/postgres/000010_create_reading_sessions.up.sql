@@ -0,0 +1,14 @@
+/*one sitting with a book, e.g. pages 120 to 164 on the train; the pages are where the reader started and stopped, not how many they read*/
+CREATE TABLE IF NOT EXISTS reading_sessions (
+    id bigserial PRIMARY KEY,
+    user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+    book_id bigint NOT NULL REFERENCES books ON DELETE CASCADE,
+    start_page integer NOT NULL CHECK (start_page >= 0),
+    end_page integer NOT NULL,
+    duration_minutes integer NOT NULL DEFAULT 0 CHECK (duration_minutes >= 0),
+    read_at timestamp(0) with time zone NOT NULL,
+    version integer NOT NULL DEFAULT 1,
+    CHECK (end_page >= start_page)
+);
+
+CREATE INDEX IF NOT EXISTS reading_sessions_user_book_idx ON reading_sessions (user_id, book_id, read_at);
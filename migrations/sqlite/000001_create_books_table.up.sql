@@ -0,0 +1,13 @@
+/*SQLite has no array type, so genres holds a JSON array*/
+CREATE TABLE IF NOT EXISTS books (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    title TEXT NOT NULL,
+    author TEXT NOT NULL DEFAULT '',
+    published INTEGER NOT NULL,
+    pages INTEGER NOT NULL,
+    genres TEXT NOT NULL DEFAULT '[]',
+    rating REAL NOT NULL,
+    isbn TEXT NOT NULL DEFAULT '',
+    version INTEGER NOT NULL DEFAULT 1
+);
@@ -0,0 +1 @@
+/*nothing was added by the up migration*/
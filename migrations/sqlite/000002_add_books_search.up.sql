@@ -0,0 +1 @@
+/*SQLite has no tsvector; SQLiteBookModel.Search matches the books in go instead, so there is nothing to add*/
@@ -0,0 +1,4 @@
+/*a book with a deleted_at is in the trash; it is hidden from the api until it is restored or purged*/
+ALTER TABLE books ADD COLUMN deleted_at DATETIME;
+
+CREATE INDEX IF NOT EXISTS books_deleted_at_idx ON books (deleted_at) WHERE deleted_at IS NOT NULL;
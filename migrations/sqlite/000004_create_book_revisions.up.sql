@@ -0,0 +1,19 @@
+/*the same as the postgres table, with the snapshot stored as JSON text*/
+CREATE TABLE IF NOT EXISTS book_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+    operation TEXT NOT NULL,
+    actor TEXT NOT NULL DEFAULT '',
+    snapshot TEXT NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (book_id, version)
+);
+
+/*deleted_at is turned into RFC 3339 so it reads back into a time.Time like the snapshots written by the api*/
+INSERT OR IGNORE INTO book_revisions (book_id, version, operation, snapshot)
+SELECT id, version, 'snapshot', json_object(
+    'id', id, 'title', title, 'author', author, 'published', published, 'pages', pages,
+    'genres', json(genres), 'rating', rating, 'isbn', isbn, 'deleted_at', strftime('%Y-%m-%dT%H:%M:%SZ', deleted_at)
+)
+FROM books;
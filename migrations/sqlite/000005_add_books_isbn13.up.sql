@@ -0,0 +1,23 @@
+/*the same as the postgres migration; SQLite has no regular expressions, so the ISBNs are checked with GLOB*/
+ALTER TABLE books ADD COLUMN isbn13 TEXT;
+
+UPDATE books
+SET isbn13 = (
+    SELECT CASE
+        WHEN length(n) = 13 AND (n GLOB '978*' OR n GLOB '979*') AND n NOT GLOB '*[^0-9]*' THEN n
+        WHEN length(n) = 10 AND substr(n, 1, 9) NOT GLOB '*[^0-9]*' AND substr(n, 10, 1) GLOB '[0-9X]' THEN '978' || substr(n, 1, 9) || ((10 - (38
+            + 3 * substr(n, 1, 1) + substr(n, 2, 1) + 3 * substr(n, 3, 1)
+            + substr(n, 4, 1) + 3 * substr(n, 5, 1) + substr(n, 6, 1)
+            + 3 * substr(n, 7, 1) + substr(n, 8, 1) + 3 * substr(n, 9, 1)) % 10) % 10)
+    END
+    FROM (SELECT upper(replace(replace(books.isbn, '-', ''), ' ', '')) AS n)
+);
+
+UPDATE books
+SET isbn13 = NULL
+WHERE isbn13 IS NOT NULL AND deleted_at IS NULL AND EXISTS (
+    SELECT 1 FROM books older
+    WHERE older.isbn13 = books.isbn13 AND older.deleted_at IS NULL AND older.id < books.id
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS books_isbn13_idx ON books (isbn13) WHERE deleted_at IS NULL;
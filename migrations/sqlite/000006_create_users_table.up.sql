@@ -0,0 +1,12 @@
+/*the same as the postgres table; SQLite keeps the boolean as 0 or 1*/
+CREATE TABLE IF NOT EXISTS users (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    name TEXT NOT NULL,
+    email TEXT NOT NULL,
+    password_hash BLOB NOT NULL,
+    activated INTEGER NOT NULL DEFAULT 0,
+    version INTEGER NOT NULL DEFAULT 1
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_idx ON users (lower(email));
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS permissions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    code TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS users_permissions (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    permission_id INTEGER NOT NULL REFERENCES permissions (id) ON DELETE CASCADE,
+    PRIMARY KEY (user_id, permission_id)
+);
+
+INSERT INTO permissions (code)
+VALUES ('books:read'), ('books:write'), ('admin');
+
+INSERT INTO users_permissions (user_id, permission_id)
+SELECT users.id, permissions.id
+FROM users CROSS JOIN permissions
+WHERE permissions.code IN ('books:read', 'books:write');
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS user_books (
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    status TEXT NOT NULL CHECK (status IN ('want-to-read', 'reading', 'read', 'did-not-finish')),
+    started_at DATETIME,
+    finished_at DATETIME,
+    rating REAL NOT NULL DEFAULT 0,
+    dnf_reason TEXT NOT NULL DEFAULT '',
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    version INTEGER NOT NULL DEFAULT 1,
+    PRIMARY KEY (user_id, book_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_books_shelf_idx ON user_books (user_id, status);
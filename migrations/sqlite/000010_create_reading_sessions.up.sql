@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS reading_sessions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    book_id INTEGER NOT NULL REFERENCES books (id) ON DELETE CASCADE,
+    start_page INTEGER NOT NULL CHECK (start_page >= 0),
+    end_page INTEGER NOT NULL,
+    duration_minutes INTEGER NOT NULL DEFAULT 0 CHECK (duration_minutes >= 0),
+    read_at DATETIME NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    CHECK (end_page >= start_page)
+);
+
+CREATE INDEX IF NOT EXISTS reading_sessions_user_book_idx ON reading_sessions (user_id, book_id, read_at);